@@ -0,0 +1,525 @@
+package lemon
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"sort"
+	"time"
+)
+
+type aggFunc uint8
+
+const (
+	countAgg aggFunc = iota + 1
+	sumAgg
+	avgAgg
+	minAgg
+	maxAgg
+	groupByTagAgg
+	groupBySegmentAgg
+)
+
+func (fn aggFunc) String() string {
+	switch fn {
+	case countAgg:
+		return "count"
+	case sumAgg:
+		return "sum"
+	case avgAgg:
+		return "avg"
+	case minAgg:
+		return "min"
+	case maxAgg:
+		return "max"
+	}
+
+	return "group"
+}
+
+// Aggregation - an aggregate function or a grouping passed to Aggregate
+type Aggregation struct {
+	fn      aggFunc
+	tag     string
+	path    JSONPath
+	segment int
+	name    string
+}
+
+// Count - number of matched documents
+func Count() *Aggregation {
+	return &Aggregation{fn: countAgg}
+}
+
+// SumTag - sum of values of an int or float tag
+func SumTag(name string) *Aggregation {
+	return &Aggregation{fn: sumAgg, tag: name}
+}
+
+// AvgTag - average of values of an int or float tag
+func AvgTag(name string) *Aggregation {
+	return &Aggregation{fn: avgAgg, tag: name}
+}
+
+// MinTag - minimum value of an int or float tag
+func MinTag(name string) *Aggregation {
+	return &Aggregation{fn: minAgg, tag: name}
+}
+
+// MaxTag - maximum value of an int or float tag
+func MaxTag(name string) *Aggregation {
+	return &Aggregation{fn: maxAgg, tag: name}
+}
+
+// Sum - sum of numbers at a path of JSON documents
+func Sum(path JSONPath) *Aggregation {
+	return &Aggregation{fn: sumAgg, path: path}
+}
+
+// Avg - average of numbers at a path of JSON documents
+func Avg(path JSONPath) *Aggregation {
+	return &Aggregation{fn: avgAgg, path: path}
+}
+
+// Min - minimum of numbers at a path of JSON documents
+func Min(path JSONPath) *Aggregation {
+	return &Aggregation{fn: minAgg, path: path}
+}
+
+// Max - maximum of numbers at a path of JSON documents
+func Max(path JSONPath) *Aggregation {
+	return &Aggregation{fn: maxAgg, path: path}
+}
+
+// GroupByTag - aggregates are calculated separately for every value of a tag,
+// documents without the tag fall into a group with nil key
+func GroupByTag(name string) *Aggregation {
+	return &Aggregation{fn: groupByTagAgg, tag: name}
+}
+
+// GroupByKeySegment - aggregates are calculated separately for every value
+// of a primary key segment, segments are counted from 0, e.g. 1 for `country` in `user:country:id`
+func GroupByKeySegment(segment int) *Aggregation {
+	return &Aggregation{fn: groupBySegmentAgg, segment: segment}
+}
+
+// As - sets a name of the aggregate in results
+func (a *Aggregation) As(name string) *Aggregation {
+	a.name = name
+	return a
+}
+
+// Name - of the aggregate in results, e.g. `count`, `sum(price)` or `avg(user.age)`
+func (a *Aggregation) Name() string {
+	if a.name != "" {
+		return a.name
+	}
+
+	switch {
+	case a.fn == countAgg:
+		return a.fn.String()
+	case a.tag != "":
+		return fmt.Sprintf("%s(%s)", a.fn, a.tag)
+	}
+
+	return fmt.Sprintf("%s(%s)", a.fn, a.path)
+}
+
+func (a *Aggregation) grouping() bool {
+	return a.fn == groupByTagAgg || a.fn == groupBySegmentAgg
+}
+
+func (a *Aggregation) validate() error {
+	switch a.fn {
+	case countAgg:
+		return nil
+	case groupByTagAgg:
+		if a.tag == "" {
+			return errors.Wrap(ErrInvalidQueryOptions, "group by tag name cannot be empty")
+		}
+	case groupBySegmentAgg:
+		if a.segment < 0 {
+			return errors.Wrap(ErrInvalidQueryOptions, "group by key segment cannot be negative")
+		}
+	case sumAgg, avgAgg, minAgg, maxAgg:
+		if a.tag == "" && a.path == "" {
+			return errors.Wrapf(ErrInvalidQueryOptions, "%s requires a tag name or a JSON path", a.fn)
+		}
+	default:
+		return errors.Wrapf(ErrInvalidQueryOptions, "unknown aggregate function %d", a.fn)
+	}
+
+	return nil
+}
+
+// number - value to aggregate taken from a tag or a JSON path,
+// values that are not numbers are ignored
+func (a *Aggregation) number(ent *entry) (float64, bool) {
+	if a.tag != "" {
+		t, ok := ent.tags[a.tag]
+		if !ok {
+			return 0, false
+		}
+
+		return tagNumber(t.data)
+	}
+
+	res := gjson.GetBytes(ent.value, string(a.path))
+	if res.Type != gjson.Number {
+		return 0, false
+	}
+
+	return res.Num, true
+}
+
+func (a *Aggregation) groupKey(ent *entry) interface{} {
+	if a.fn == groupByTagAgg {
+		if t, ok := ent.tags[a.tag]; ok {
+			return t.data
+		}
+
+		return nil
+	}
+
+	if a.segment < len(ent.key.segments) {
+		return ent.key.segments[a.segment]
+	}
+
+	return nil
+}
+
+func tagNumber(v interface{}) (float64, bool) {
+	switch typedValue := v.(type) {
+	case int:
+		return float64(typedValue), true
+	case float64:
+		return typedValue, true
+	}
+
+	return 0, false
+}
+
+// AggregateGroup - aggregated values of one group, Key is nil when results are not grouped
+type AggregateGroup struct {
+	Key    interface{}
+	Values map[string]float64
+}
+
+// Value - aggregated value by name, false when there was nothing to aggregate,
+// e.g. min of a tag that no matched document has
+func (g *AggregateGroup) Value(name string) (float64, bool) {
+	v, ok := g.Values[name]
+	return v, ok
+}
+
+// AggregateResult - groups are ordered by their keys, there is always a single group
+// when no grouping was requested
+type AggregateResult struct {
+	Groups []*AggregateGroup
+}
+
+// Group - finds a group by key
+func (r *AggregateResult) Group(key interface{}) (*AggregateGroup, bool) {
+	for _, g := range r.Groups {
+		if g.Key == key {
+			return g, true
+		}
+	}
+
+	return nil, false
+}
+
+type aggState struct {
+	count int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (s *aggState) add(v float64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+
+	s.count++
+	s.sum += v
+}
+
+type aggGroup struct {
+	key    interface{}
+	docs   int
+	states []aggState
+}
+
+// aggregator - collects aggregates of entries passed to it by a scanner
+type aggregator struct {
+	aggs    []*Aggregation
+	groupBy *Aggregation
+	groups  map[interface{}]*aggGroup
+}
+
+func newAggregator(aggs []*Aggregation) (*aggregator, error) {
+	ag := &aggregator{groups: make(map[interface{}]*aggGroup)}
+
+	for _, a := range aggs {
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+
+		if !a.grouping() {
+			ag.aggs = append(ag.aggs, a)
+			continue
+		}
+
+		if ag.groupBy != nil {
+			return nil, errors.Wrap(ErrInvalidQueryOptions, "only one grouping is allowed")
+		}
+
+		ag.groupBy = a
+	}
+
+	if len(ag.aggs) == 0 {
+		return nil, errors.Wrap(ErrInvalidQueryOptions, "at least one aggregate function is required")
+	}
+
+	return ag, nil
+}
+
+func (ag *aggregator) needsValues() bool {
+	for _, a := range ag.aggs {
+		if a.fn != countAgg && a.tag == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fromIndexEdges - when nothing is filtered and only min or max of tags are requested
+// they can be taken straight from the edges of tag indexes
+func (ag *aggregator) fromIndexEdges(qo *QueryOptions) bool {
+	if ag.groupBy != nil || !qo.unfiltered() {
+		return false
+	}
+
+	for _, a := range ag.aggs {
+		if (a.fn != minAgg && a.fn != maxAgg) || a.tag == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ag *aggregator) group(ent *entry) *aggGroup {
+	var key interface{}
+	if ag.groupBy != nil {
+		key = ag.groupBy.groupKey(ent)
+	}
+
+	g, ok := ag.groups[key]
+	if !ok {
+		g = &aggGroup{key: key, states: make([]aggState, len(ag.aggs))}
+		ag.groups[key] = g
+	}
+
+	return g
+}
+
+func (ag *aggregator) add(ent *entry) {
+	g := ag.group(ent)
+	g.docs++
+
+	for i, a := range ag.aggs {
+		if a.fn == countAgg {
+			continue
+		}
+
+		if v, ok := a.number(ent); ok {
+			g.states[i].add(v)
+		}
+	}
+}
+
+func (ag *aggregator) result() *AggregateResult {
+	if ag.groupBy == nil && len(ag.groups) == 0 {
+		ag.groups[nil] = &aggGroup{states: make([]aggState, len(ag.aggs))}
+	}
+
+	r := &AggregateResult{Groups: make([]*AggregateGroup, 0, len(ag.groups))}
+	for _, g := range ag.groups {
+		values := make(map[string]float64, len(ag.aggs))
+
+		for i, a := range ag.aggs {
+			s := g.states[i]
+
+			switch a.fn {
+			case countAgg:
+				values[a.Name()] = float64(g.docs)
+			case sumAgg:
+				values[a.Name()] = s.sum
+			case avgAgg:
+				if s.count > 0 {
+					values[a.Name()] = s.sum / float64(s.count)
+				}
+			case minAgg:
+				if s.count > 0 {
+					values[a.Name()] = s.min
+				}
+			case maxAgg:
+				if s.count > 0 {
+					values[a.Name()] = s.max
+				}
+			}
+		}
+
+		r.Groups = append(r.Groups, &AggregateGroup{Key: g.key, Values: values})
+	}
+
+	sort.Slice(r.Groups, func(i, j int) bool {
+		return lessGroupKeys(r.Groups[i].Key, r.Groups[j].Key)
+	})
+
+	return r
+}
+
+// lessGroupKeys - values of a tag share the same type, key segments are compared
+// the same way as in primary keys, nil group goes last
+func lessGroupKeys(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return b == nil && a != nil
+	}
+
+	switch typedA := a.(type) {
+	case int:
+		return typedA < b.(int)
+	case float64:
+		return typedA < b.(float64)
+	case bool:
+		return !typedA && b.(bool)
+	case string:
+		if typedB, ok := b.(string); ok {
+			pkA, pkB := newPK(typedA), newPK(typedB)
+			return pkA.Less(pkB)
+		}
+	}
+
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// unfiltered - query matches every document in the database
+func (qo *QueryOptions) unfiltered() bool {
+	return qo.keyRange == nil &&
+		qo.prefix == "" &&
+		(len(qo.patterns) == 0 || (len(qo.patterns) == 1 && qo.patterns[0] == "*")) &&
+		qo.keyRegex == nil &&
+		(qo.tags == nil || qo.tags.empty()) &&
+		qo.byTagName == "" &&
+		qo.text == nil &&
+		len(qo.where) == 0 &&
+		qo.limit == 0 &&
+		qo.offset == 0 &&
+		qo.after == nil
+}
+
+// Aggregate - calculates aggregates over documents matched by query options,
+// e.g. `tx.Aggregate(lemon.Q().Prefix("order"), lemon.Count(), lemon.SumTag("total"), lemon.GroupByTag("status"))`
+func (x *Tx) Aggregate(qo *QueryOptions, aggs ...*Aggregation) (*AggregateResult, error) {
+	if qo == nil {
+		qo = Q()
+	}
+
+	ag, err := newAggregator(aggs)
+	if err != nil {
+		return nil, err
+	}
+
+	if ag.fromIndexEdges(qo) {
+		return x.aggregateIndexEdges(ag)
+	}
+
+	loadValues := ag.needsValues()
+	ir := func(ent *entry) bool {
+		if loadValues {
+			withValue, err := x.withValue(ent)
+			if err != nil {
+				x.lg.Error(err)
+			} else {
+				ent = withValue
+			}
+		}
+
+		ag.add(ent)
+		return true
+	}
+
+	if err := x.applyScanner(x.ctx, qo, ir); err != nil {
+		return nil, err
+	}
+
+	return ag.result(), nil
+}
+
+func (x *Tx) aggregateIndexEdges(ag *aggregator) (*AggregateResult, error) {
+	values := make(map[string]float64, len(ag.aggs))
+	now := x.ee.Now()
+
+	for _, a := range ag.aggs {
+		order := AscOrder
+		if a.fn == maxAgg {
+			order = DescOrder
+		}
+
+		v, ok, err := x.ee.TagEdge(a.tag, order, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			values[a.Name()] = v
+		}
+	}
+
+	return &AggregateResult{Groups: []*AggregateGroup{{Values: values}}}, nil
+}
+
+// TagEdge - the smallest value of an int or float tag in ascending order or the largest in descending order,
+// values only held by entries expired at now are skipped
+func (ee *defaultEngine) TagEdge(name string, order Order, now time.Time) (float64, bool, error) {
+	if ee.closed {
+		return 0, false, ErrDatabaseAlreadyClosed
+	}
+
+	idx, ok := ee.tags.data[name]
+	if !ok || (idx.dt != intDataType && idx.dt != floatDataType) {
+		return 0, false, nil
+	}
+
+	var result float64
+	var found bool
+
+	iter := func(item interface{}) bool {
+		for _, ent := range item.(entryContainer).getEntries() {
+			if ent.expired(now) {
+				continue
+			}
+
+			result, found = tagNumber(item.(entryContainer).getValue())
+			return false
+		}
+
+		return true
+	}
+
+	if order == DescOrder {
+		idx.btr.Descend(nil, iter)
+	} else {
+		idx.btr.Ascend(nil, iter)
+	}
+
+	return result, found, nil
+}
@@ -0,0 +1,141 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDB_Aggregate(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	db, closer, err := lemon.Open(lemon.InMemory, &lemon.Config{Clock: clock, DisableExpiredKeysReaper: true})
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	orders := []struct {
+		key    string
+		status string
+		total  float64
+		items  int
+	}{
+		{key: "order:hu:1", status: "paid", total: 10.5, items: 1},
+		{key: "order:hu:2", status: "paid", total: 20, items: 3},
+		{key: "order:at:3", status: "new", total: 5, items: 2},
+		{key: "order:at:4", status: "paid", total: 100, items: 10},
+		{key: "order:cz:5", status: "cancelled", total: 7.5, items: 1},
+	}
+
+	ctx := context.Background()
+
+	for _, o := range orders {
+		require.NoError(t, db.Insert(o.key, lemon.M{"total": o.total, "items": o.items}, lemon.WithTags().
+			Str("status", o.status).
+			Float("total", o.total).
+			Int("items", o.items),
+		))
+	}
+
+	require.NoError(t, db.Insert("order:hu:6", lemon.M{"total": 1000}, lemon.WithTags().
+		Str("status", "paid").
+		Float("total", 1000).
+		Int("items", 50), lemon.WithTTL(time.Minute),
+	))
+
+	clock.advance(2 * time.Minute)
+
+	t.Run("totals over all documents", func(t *testing.T) {
+		r, err := db.Aggregate(ctx, lemon.Q(),
+			lemon.Count(), lemon.SumTag("total"), lemon.AvgTag("items"), lemon.MinTag("total"), lemon.MaxTag("total"),
+		)
+		require.NoError(t, err)
+		require.Len(t, r.Groups, 1)
+
+		g := r.Groups[0]
+		assert.Nil(t, g.Key)
+		assert.Equal(t, map[string]float64{
+			"count":      5,
+			"sum(total)": 143,
+			"avg(items)": 3.4,
+			"min(total)": 5,
+			"max(total)": 100,
+		}, g.Values)
+	})
+
+	t.Run("min and max from index edges skip expired documents", func(t *testing.T) {
+		r, err := db.Aggregate(ctx, nil, lemon.MinTag("items"), lemon.MaxTag("items").As("most"), lemon.MaxTag("unknown"))
+		require.NoError(t, err)
+		require.Len(t, r.Groups, 1)
+		assert.Equal(t, map[string]float64{"min(items)": 1, "most": 10}, r.Groups[0].Values)
+	})
+
+	t.Run("json paths with a filter", func(t *testing.T) {
+		r, err := db.Aggregate(ctx, lemon.Q().HasAllTags(lemon.QT().StrTagEq("status", "paid")),
+			lemon.Count(), lemon.Sum("total"), lemon.Max("items"), lemon.Min("missing"),
+		)
+		require.NoError(t, err)
+		require.Len(t, r.Groups, 1)
+		assert.Equal(t, map[string]float64{"count": 3, "sum(total)": 130.5, "max(items)": 10}, r.Groups[0].Values)
+
+		_, ok := r.Groups[0].Value("min(missing)")
+		assert.False(t, ok)
+	})
+
+	t.Run("group by tag", func(t *testing.T) {
+		r, err := db.Aggregate(ctx, lemon.Q(), lemon.GroupByTag("status"), lemon.Count(), lemon.SumTag("total"))
+		require.NoError(t, err)
+		require.Len(t, r.Groups, 3)
+
+		assert.Equal(t, "cancelled", r.Groups[0].Key)
+		assert.Equal(t, "new", r.Groups[1].Key)
+		assert.Equal(t, "paid", r.Groups[2].Key)
+
+		paid, ok := r.Group("paid")
+		require.True(t, ok)
+		assert.Equal(t, map[string]float64{"count": 3, "sum(total)": 130.5}, paid.Values)
+	})
+
+	t.Run("group by key segment", func(t *testing.T) {
+		r, err := db.Aggregate(ctx, lemon.Q().Prefix("order"), lemon.GroupByKeySegment(1), lemon.Avg("total"))
+		require.NoError(t, err)
+		require.Len(t, r.Groups, 3)
+
+		assert.Equal(t, "at", r.Groups[0].Key)
+		assert.Equal(t, 52.5, r.Groups[0].Values["avg(total)"])
+		assert.Equal(t, "cz", r.Groups[1].Key)
+		assert.Equal(t, "hu", r.Groups[2].Key)
+		assert.Equal(t, 15.25, r.Groups[2].Values["avg(total)"])
+	})
+
+	t.Run("nothing matched", func(t *testing.T) {
+		r, err := db.Aggregate(ctx, lemon.Q().Prefix("zzz"), lemon.Count(), lemon.MaxTag("total"))
+		require.NoError(t, err)
+		require.Len(t, r.Groups, 1)
+		assert.Equal(t, map[string]float64{"count": 0}, r.Groups[0].Values)
+
+		r, err = db.Aggregate(ctx, lemon.Q().Prefix("zzz"), lemon.GroupByTag("status"), lemon.Count())
+		require.NoError(t, err)
+		assert.Len(t, r.Groups, 0)
+	})
+
+	t.Run("invalid aggregations", func(t *testing.T) {
+		for _, aggs := range [][]*lemon.Aggregation{
+			{},
+			{lemon.GroupByTag("status")},
+			{lemon.Count(), lemon.GroupByTag("status"), lemon.GroupByKeySegment(0)},
+			{lemon.SumTag("")},
+		} {
+			_, err := db.Aggregate(ctx, lemon.Q(), aggs...)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+		}
+	})
+}
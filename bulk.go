@@ -0,0 +1,310 @@
+package lemon
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+const defaultBulkChunkSize = 10000
+
+type DuplicatePolicy uint8
+
+const (
+	// FailOnDuplicate - bulk load stops with ErrKeyAlreadyExists
+	FailOnDuplicate DuplicatePolicy = iota
+	// SkipDuplicates - existing documents are left untouched
+	SkipDuplicates
+	// OverwriteDuplicates - existing documents are replaced
+	OverwriteDuplicates
+)
+
+// BulkItem - a single document to be bulk loaded,
+// Meta accepts the same appliers as Insert e.g. lemon.M or WithTags()
+type BulkItem struct {
+	Key  string
+	Data interface{}
+	Meta []MetaApplier
+}
+
+// BulkIterator - streams documents into BulkLoad
+type BulkIterator interface {
+	Next() bool
+	Item() BulkItem
+	Err() error
+}
+
+type sliceBulkIterator struct {
+	items []BulkItem
+	cur   int
+}
+
+// NewSliceBulkIterator - creates a bulk iterator over items that are already in memory
+func NewSliceBulkIterator(items []BulkItem) BulkIterator {
+	return &sliceBulkIterator{items: items, cur: -1}
+}
+
+func (it *sliceBulkIterator) Next() bool {
+	it.cur++
+	return it.cur < len(it.items)
+}
+
+func (it *sliceBulkIterator) Item() BulkItem {
+	return it.items[it.cur]
+}
+
+func (it *sliceBulkIterator) Err() error {
+	return nil
+}
+
+type BulkStats struct {
+	Loaded      int
+	Overwritten int
+	Skipped     int
+}
+
+type BulkOptions struct {
+	// ChunkSize - how many documents are written to the database file at once
+	ChunkSize   int
+	OnDuplicate DuplicatePolicy
+	// OnProgress - is called after each chunk is written
+	OnProgress func(stats BulkStats)
+}
+
+type bulkLoader struct {
+	ee      *defaultEngine
+	opts    *BulkOptions
+	stats   BulkStats
+	pending BulkStats
+	builder *tagIndexBuilder
+
+	commands []serializable
+	added    []*entry
+	replaced []*entry
+}
+
+// BulkLoad - streams documents into the database writing them in chunks,
+// on an empty database primary keys and secondary indexes are built bottom-up,
+// which is much faster with documents sorted by key.
+// Unlike a transaction bulk load is not atomic: chunks written before
+// an error remain in the database and the chunk in progress is discarded.
+func (ee *defaultEngine) BulkLoad(
+	ctx context.Context,
+	it BulkIterator,
+	opts *BulkOptions,
+) (BulkStats, error) {
+	ee.Lock()
+	defer ee.Unlock()
+
+	if ee.closed {
+		return BulkStats{}, ErrDatabaseAlreadyClosed
+	}
+
+	if opts == nil {
+		opts = &BulkOptions{}
+	}
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultBulkChunkSize
+	}
+
+	bl := &bulkLoader{ee: ee, opts: opts}
+	if ee.pks.Len() == 0 {
+		bl.builder = newTagIndexBuilder()
+	}
+
+	err := bl.load(ctx, it)
+
+	// indexes are built from everything that was successfully written
+	if bl.builder != nil {
+		bl.builder.build(ee.tags)
+	}
+
+	return bl.stats, err
+}
+
+func (bl *bulkLoader) load(ctx context.Context, it BulkIterator) error {
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			bl.discard()
+			return err
+		}
+
+		if err := bl.add(it.Item()); err != nil {
+			bl.discard()
+			return err
+		}
+
+		if len(bl.added) >= bl.opts.ChunkSize {
+			if err := bl.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		bl.discard()
+		return errors.Wrap(err, "bulk iterator failed")
+	}
+
+	return bl.flush()
+}
+
+func (bl *bulkLoader) add(item BulkItem) error {
+	v, contentTypeIdentifier, err := serializeToValue(item.Data)
+	if err != nil {
+		return err
+	}
+
+	ent := newEntry(item.Key, v)
+	ent.tags = newTags()
+	metaAppliers := make([]MetaApplier, 0, len(item.Meta)+1)
+	metaAppliers = append(metaAppliers, item.Meta...)
+	metaAppliers = append(metaAppliers, WithContentType(contentTypeIdentifier))
+	if err := applyMetaAt(ent, metaAppliers, bl.ee.Now()); err != nil {
+		return err
+	}
+
+	if err := bl.ee.IndexFields(ent); err != nil {
+		return err
+	}
+
+	found := bl.ee.pks.Get(ent)
+	if found == nil {
+		if err := bl.ee.CheckUnique(ent.key, ent.tags); err != nil {
+			return err
+		}
+
+		bl.ee.pks.Load(ent)
+		if err := bl.addTags(ent); err != nil {
+			return err
+		}
+
+		bl.added = append(bl.added, ent)
+		bl.commands = append(bl.commands, ent)
+		bl.pending.Loaded++
+
+		return nil
+	}
+
+	existing := found.(*entry)
+	if !existing.expired(bl.ee.Now()) {
+		switch bl.opts.OnDuplicate {
+		case SkipDuplicates:
+			bl.pending.Skipped++
+			return nil
+		case OverwriteDuplicates:
+			bl.pending.Overwritten++
+		default:
+			return errors.Wrapf(ErrKeyAlreadyExists, "key: %s", item.Key)
+		}
+	} else {
+		bl.pending.Loaded++
+	}
+
+	if err := bl.ee.CheckUnique(ent.key, ent.tags); err != nil {
+		return err
+	}
+
+	preserveCreatedAt(existing, ent)
+	bl.removeTags(existing)
+	bl.ee.pks.Set(ent)
+	if err := bl.addTags(ent); err != nil {
+		return err
+	}
+
+	bl.added = append(bl.added, ent)
+	bl.replaced = append(bl.replaced, existing)
+	if existing.committed {
+		bl.commands = append(bl.commands, &deleteCmd{key: existing.key, pos: existing.pos})
+	}
+	bl.commands = append(bl.commands, ent)
+
+	return nil
+}
+
+func (bl *bulkLoader) addTags(ent *entry) error {
+	if bl.builder != nil {
+		if err := bl.builder.add(ent); err != nil {
+			return err
+		}
+	} else if err := bl.ee.setEntityTags(ent); err != nil {
+		return err
+	}
+
+	bl.ee.indexComposite(ent)
+	bl.ee.indexUnique(ent)
+	return bl.ee.indexText(ent)
+}
+
+func (bl *bulkLoader) removeTags(ent *entry) {
+	bl.ee.unindexText(ent)
+	bl.ee.unindexComposite(ent)
+	bl.ee.unindexUnique(ent)
+
+	if bl.builder != nil {
+		bl.builder.remove(ent)
+		return
+	}
+
+	bl.ee.clearEntityTags(ent)
+}
+
+// flush - writes current chunk to the database file
+func (bl *bulkLoader) flush() error {
+	if len(bl.added) == 0 && bl.pending.Skipped == 0 {
+		return nil
+	}
+
+	if err := bl.ee.Persist(bl.commands); err != nil {
+		bl.discard()
+		return err
+	}
+
+	for _, ent := range bl.added {
+		ent.committed = true
+	}
+
+	bl.stats.Loaded += bl.pending.Loaded
+	bl.stats.Overwritten += bl.pending.Overwritten
+	bl.stats.Skipped += bl.pending.Skipped
+	bl.reset()
+
+	if bl.opts.OnProgress != nil {
+		bl.opts.OnProgress(bl.stats)
+	}
+
+	return nil
+}
+
+// discard - removes entries of the chunk that was not written
+// and restores the ones they replaced
+func (bl *bulkLoader) discard() {
+	for i := len(bl.added) - 1; i >= 0; i-- {
+		ent := bl.added[i]
+		if bl.ee.pks.Get(ent) == ent {
+			bl.removeTags(ent)
+			bl.ee.pks.Delete(ent)
+		}
+	}
+
+	// only entries written before the chunk are restored
+	for _, ent := range bl.replaced {
+		if !ent.committed {
+			continue
+		}
+
+		bl.ee.pks.Set(ent)
+		if err := bl.addTags(ent); err != nil {
+			bl.ee.lg.Error(err)
+		}
+	}
+
+	bl.reset()
+}
+
+func (bl *bulkLoader) reset() {
+	bl.pending = BulkStats{}
+	bl.commands = nil
+	bl.added = nil
+	bl.replaced = nil
+}
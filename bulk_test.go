@@ -0,0 +1,180 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDB_BulkLoad(t *testing.T) {
+	suite.Run(t, &bulkLoadTestSuite{})
+}
+
+type bulkLoadTestSuite struct {
+	suite.Suite
+	fixture string
+}
+
+func (bts *bulkLoadTestSuite) SetupTest() {
+	bts.fixture = "./__fixtures__/bulk_db1.ldb"
+	_ = os.Remove(bts.fixture)
+}
+
+func (bts *bulkLoadTestSuite) TearDownTest() {
+	if err := os.Remove(bts.fixture); err != nil && !os.IsNotExist(err) {
+		bts.Require().NoError(err)
+	}
+}
+
+func (bts *bulkLoadTestSuite) open() (*lemon.DB, lemon.Closer) {
+	db, closer, err := lemon.Open(bts.fixture, &lemon.Config{
+		DisableAutoVacuum:   true,
+		PersistenceStrategy: lemon.Sync,
+	})
+
+	bts.Require().NoError(err)
+
+	return db, closer
+}
+
+func generateBulkItems(from, to int) []lemon.BulkItem {
+	var items []lemon.BulkItem
+	for i := from; i <= to; i++ {
+		items = append(items, lemon.BulkItem{
+			Key:  fmt.Sprintf("product:%04d", i),
+			Data: lemon.M{"id": i},
+			Meta: []lemon.MetaApplier{
+				lemon.WithTags().Int("price", i%10).Bool("even", i%2 == 0),
+			},
+		})
+	}
+
+	return items
+}
+
+type failingBulkIterator struct {
+	lemon.BulkIterator
+	err error
+}
+
+func (it *failingBulkIterator) Err() error {
+	return it.err
+}
+
+func (bts *bulkLoadTestSuite) TestLoadIntoEmptyDatabase() {
+	db, closer := bts.open()
+
+	var progress []lemon.BulkStats
+	it := lemon.NewSliceBulkIterator(generateBulkItems(1, 2500))
+	stats, err := db.BulkLoad(context.Background(), it, &lemon.BulkOptions{
+		ChunkSize:  1000,
+		OnProgress: func(s lemon.BulkStats) { progress = append(progress, s) },
+	})
+
+	bts.Require().NoError(err)
+	bts.Assert().Equal(lemon.BulkStats{Loaded: 2500}, stats)
+	bts.Require().Len(progress, 3)
+	bts.Assert().Equal(1000, progress[0].Loaded)
+	bts.Assert().Equal(2000, progress[1].Loaded)
+	bts.Assert().Equal(2500, progress[2].Loaded)
+
+	bts.Assert().Equal(2500, db.Count())
+
+	docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagEq("price", 3)))
+	bts.Require().NoError(err)
+	bts.Assert().Len(docs, 250)
+
+	bts.Require().NoError(closer())
+
+	contents := string(loadFixtureContents(bts.T(), bts.fixture))
+	bts.Assert().Equal(2500, strings.Count(contents, "+set"))
+
+	db, closer = bts.open()
+	defer func() {
+		bts.Require().NoError(closer())
+	}()
+
+	bts.Assert().Equal(2500, db.Count())
+
+	doc, err := db.Get("product:1234")
+	bts.Require().NoError(err)
+	bts.Assert().Equal(1234, doc.JSON().IntOrDefault("id", 0))
+	bts.Assert().Equal(lemon.M{"price": 4, "even": true}, doc.Tags())
+}
+
+func (bts *bulkLoadTestSuite) TestDuplicatePolicies() {
+	db, closer := bts.open()
+	defer func() {
+		bts.Require().NoError(closer())
+	}()
+
+	_, err := db.BulkLoad(context.Background(), lemon.NewSliceBulkIterator(generateBulkItems(1, 10)))
+	bts.Require().NoError(err)
+
+	items := []lemon.BulkItem{
+		{Key: "product:0011", Data: lemon.M{"id": 11}},
+		{Key: "product:0001", Data: lemon.M{"id": 100}, Meta: []lemon.MetaApplier{lemon.M{"price": 100}}},
+		{Key: "product:0012", Data: lemon.M{"id": 12}},
+	}
+
+	bts.Run("fail on duplicate discards the chunk", func() {
+		stats, err := db.BulkLoad(context.Background(), lemon.NewSliceBulkIterator(items))
+		bts.Require().Error(err)
+		bts.Assert().True(errors.Is(err, lemon.ErrKeyAlreadyExists))
+		bts.Assert().Equal(lemon.BulkStats{}, stats)
+		bts.Assert().False(db.Has("product:0011"))
+		bts.Assert().Equal(10, db.Count())
+	})
+
+	bts.Run("skip duplicates", func() {
+		stats, err := db.BulkLoad(context.Background(), lemon.NewSliceBulkIterator(items), &lemon.BulkOptions{
+			OnDuplicate: lemon.SkipDuplicates,
+		})
+
+		bts.Require().NoError(err)
+		bts.Assert().Equal(lemon.BulkStats{Loaded: 2, Skipped: 1}, stats)
+
+		doc, err := db.Get("product:0001")
+		bts.Require().NoError(err)
+		bts.Assert().Equal(1, doc.JSON().IntOrDefault("id", 0))
+	})
+
+	bts.Run("overwrite duplicates", func() {
+		stats, err := db.BulkLoad(context.Background(), lemon.NewSliceBulkIterator(items[1:2]), &lemon.BulkOptions{
+			OnDuplicate: lemon.OverwriteDuplicates,
+		})
+
+		bts.Require().NoError(err)
+		bts.Assert().Equal(lemon.BulkStats{Overwritten: 1}, stats)
+
+		doc, err := db.Get("product:0001")
+		bts.Require().NoError(err)
+		bts.Assert().Equal(100, doc.JSON().IntOrDefault("id", 0))
+		bts.Assert().Equal(lemon.M{"price": 100}, doc.Tags())
+
+		docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagEq("price", 100)))
+		bts.Require().NoError(err)
+		bts.Require().Len(docs, 1)
+		bts.Assert().Equal("product:0001", docs[0].Key())
+
+		docs, err = db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagEq("price", 1)))
+		bts.Require().NoError(err)
+		bts.Assert().Len(docs, 0)
+	})
+
+	bts.Run("iterator error discards the chunk", func() {
+		it := &failingBulkIterator{
+			BulkIterator: lemon.NewSliceBulkIterator(generateBulkItems(20, 25)),
+			err:          errors.New("broken export"),
+		}
+
+		_, err := db.BulkLoad(context.Background(), it)
+		bts.Require().Error(err)
+		bts.Assert().False(db.Has("product:0020"))
+	})
+}
@@ -92,3 +92,26 @@ func (flushAllCmd) serialize(rs *respSerializer) error {
 func (flushAllCmd) deserialize(e executionEngine) error {
 	return e.FlushAll(func(*entry) {})
 }
+
+// incrCmd - stores the resulting value of an incremented integer document
+// without repeating its tags, so that frequently updated counters stay compact in the log
+type incrCmd struct {
+	ent  *entry
+	prev position
+}
+
+func (cmd *incrCmd) serialize(rs *respSerializer) error {
+	return rs.serializeIncrCommand(cmd)
+}
+
+func (cmd *incrCmd) deserialize(e executionEngine) error {
+	ent, err := e.FindByKey(cmd.ent.key.String())
+	if err != nil {
+		return errors.Wrapf(err, "could not deserialize incr command for key %s", cmd.ent.key.String())
+	}
+
+	ent.pos = cmd.ent.pos
+	ent.value = cmd.ent.value
+
+	return nil
+}
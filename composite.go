@@ -0,0 +1,562 @@
+package lemon
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tidwall/btree"
+	"sort"
+	"strings"
+)
+
+// compositeItem - values of tags of a composite index of a single entry,
+// a missing tag is nil and sorts before any value
+type compositeItem struct {
+	values []interface{}
+	ent    *entry
+}
+
+// compositeIndex - entries ordered by values of several tags and then by keys,
+// only its definition is persisted, items are rebuilt from tags when the database is loaded
+type compositeIndex struct {
+	name   string
+	fields []string
+	btr    *btree.BTree
+	items  map[string]*compositeItem
+}
+
+func newCompositeIndex(name string, fields []string) *compositeIndex {
+	ci := &compositeIndex{name: name, fields: fields}
+	ci.reset()
+
+	return ci
+}
+
+func (ci *compositeIndex) reset() {
+	ci.btr = btree.NewNonConcurrent(byCompositeValues)
+	ci.items = make(map[string]*compositeItem)
+}
+
+// add - puts current values of tags of the entry into the index replacing the previous ones,
+// entries without the first tag are left out
+func (ci *compositeIndex) add(ent *entry) {
+	key := ent.key.String()
+	ci.remove(key)
+
+	if _, ok := ent.tags[ci.fields[0]]; !ok {
+		return
+	}
+
+	item := &compositeItem{values: make([]interface{}, len(ci.fields)), ent: ent}
+	for i, name := range ci.fields {
+		if t, ok := ent.tags[name]; ok {
+			item.values[i] = t.data
+		}
+	}
+
+	ci.btr.Set(item)
+	ci.items[key] = item
+}
+
+func (ci *compositeIndex) remove(key string) {
+	item, ok := ci.items[key]
+	if !ok {
+		return
+	}
+
+	ci.btr.Delete(item)
+	delete(ci.items, key)
+}
+
+// match - entries with values equal to conditions on leading tags of the index
+// and optionally within range of a condition on the next tag, nothing is matched
+// when there is no equality condition on the first tag or when more than bound entries match
+func (ci *compositeIndex) match(conditions []tagCondition, bound int) ([]*entry, bool) {
+	eq := make([]interface{}, 0, len(ci.fields))
+	var rng *tagCondition
+
+	for _, name := range ci.fields {
+		if c := findTagCondition(conditions, name, equal); c != nil {
+			eq = append(eq, c.value)
+			continue
+		}
+
+		for _, comp := range []comparator{greaterThan, greaterThanOrEqual, lessThan, lessThanOrEqual, between, prefix} {
+			if rng = findTagCondition(conditions, name, comp); rng != nil {
+				break
+			}
+		}
+
+		break
+	}
+
+	if len(eq) == 0 {
+		return nil, false
+	}
+
+	pivot := &compositeItem{values: eq}
+	if rng != nil && rng.key.comp != lessThan && rng.key.comp != lessThanOrEqual {
+		pivot = &compositeItem{values: append(append([]interface{}{}, eq...), rng.value)}
+	}
+
+	var ents []*entry
+	exceeded := false
+
+	ci.btr.Ascend(pivot, func(item interface{}) bool {
+		found := item.(*compositeItem)
+		for i, v := range eq {
+			if compareTagValues(found.values[i], v) != 0 {
+				return false
+			}
+		}
+
+		if rng != nil {
+			v := found.values[len(eq)]
+			if v == nil {
+				return true
+			}
+
+			if _, dt, err := newEntryContainer(v); err != nil || !rng.matchesTag(&tag{dt: dt, data: v}) {
+				// values equal to the lower bound precede the matching ones,
+				// any other mismatch means that the range is over
+				return rng.key.comp == greaterThan && compareTagValues(v, rng.value) == 0
+			}
+		}
+
+		ents = append(ents, found.ent)
+		if bound >= 0 && len(ents) > bound {
+			exceeded = true
+			return false
+		}
+
+		return true
+	})
+
+	return ents, !exceeded
+}
+
+// compositeUpperBound - sorts after values of any type, a pivot ending with it
+// follows every item sharing the values preceding it
+type compositeUpperBound struct{}
+
+// orderedPrefix - values of equality conditions on all the tags preceding the sort tag in the index,
+// nothing is returned when the sort tag is the first one, is not in the index or a preceding tag has no equality
+func (ci *compositeIndex) orderedPrefix(conditions []tagCondition, sortTag string) ([]interface{}, bool) {
+	var eq []interface{}
+	for _, name := range ci.fields {
+		if name == sortTag {
+			return eq, len(eq) > 0
+		}
+
+		c := findTagCondition(conditions, name, equal)
+		if c == nil {
+			return nil, false
+		}
+
+		eq = append(eq, c.value)
+	}
+
+	return nil, false
+}
+
+// orderedScan - walks items sharing equality values in order of the next tag of the index,
+// entries sharing a value are sorted by the rest of sort keys and entries without the tag
+// come after all the values, the same way a sorted tag scan does
+func (ci *compositeIndex) orderedScan(eq []interface{}) scanner {
+	return func(ctx context.Context, q *QueryOptions, it entryIterator) error {
+		rest := q.sortBy[1:]
+		stopped := false
+
+		emit := func(ents []*entry) bool {
+			sort.Slice(ents, func(i, j int) bool {
+				return lessBySortKeys(rest, ents[i], ents[j])
+			})
+
+			for _, ent := range ents {
+				if ctx.Err() != nil || !it(ent) {
+					stopped = true
+					return false
+				}
+			}
+
+			return true
+		}
+
+		var group, missing []*entry
+		var groupValue interface{}
+
+		walk := func(item interface{}) bool {
+			found := item.(*compositeItem)
+			for i, v := range eq {
+				if compareTagValues(found.values[i], v) != 0 {
+					return false
+				}
+			}
+
+			if !q.matchesKey(found.ent.key) {
+				return true
+			}
+
+			v := found.values[len(eq)]
+			if v == nil {
+				missing = append(missing, found.ent)
+				return true
+			}
+
+			if len(group) > 0 && compareTagValues(v, groupValue) != 0 {
+				if !emit(group) {
+					return false
+				}
+
+				group = group[:0]
+			}
+
+			group, groupValue = append(group, found.ent), v
+			return true
+		}
+
+		if q.sortBy[0].order == DescOrder {
+			ci.btr.Descend(&compositeItem{values: append(append([]interface{}{}, eq...), compositeUpperBound{})}, walk)
+		} else {
+			ci.btr.Ascend(&compositeItem{values: eq}, walk)
+		}
+
+		if stopped || (len(group) > 0 && !emit(group)) {
+			return nil
+		}
+
+		emit(missing)
+		return nil
+	}
+}
+
+func (ci *compositeIndex) serialize(rs *respSerializer) error {
+	return rs.serializeCompositeIndexCommand(ci)
+}
+
+func (ci *compositeIndex) deserialize(e executionEngine) error {
+	return e.DefineCompositeIndex(ci)
+}
+
+// andConditions - conditions every matching entry has to meet, collected from nested AND groups
+func andConditions(qt *QueryTags) []tagCondition {
+	if qt.op != andOp {
+		return nil
+	}
+
+	conditions := append([]tagCondition{}, qt.conditions...)
+	for _, g := range qt.groups {
+		conditions = append(conditions, andConditions(g)...)
+	}
+
+	return conditions
+}
+
+func findTagCondition(conditions []tagCondition, name string, comp comparator) *tagCondition {
+	for i := range conditions {
+		if conditions[i].key.name == name && conditions[i].key.comp == comp {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func byCompositeValues(a, b interface{}) bool {
+	i1, i2 := a.(*compositeItem), b.(*compositeItem)
+
+	n := len(i1.values)
+	if len(i2.values) < n {
+		n = len(i2.values)
+	}
+
+	for i := 0; i < n; i++ {
+		if c := compareTagValues(i1.values[i], i2.values[i]); c != 0 {
+			return c < 0
+		}
+	}
+
+	// pivots with fewer values precede all the items they are a prefix of
+	if len(i1.values) != len(i2.values) {
+		return len(i1.values) < len(i2.values)
+	}
+
+	if i1.ent == nil || i2.ent == nil {
+		return i1.ent == nil && i2.ent != nil
+	}
+
+	return i1.ent.key.Less(i2.ent.key)
+}
+
+// compareTagValues - orders tag values the same way tag indexes do,
+// nil precedes any value and values of different types are ordered by type
+func compareTagValues(a, b interface{}) int {
+	if ra, rb := tagValueRank(a), tagValueRank(b); ra != rb {
+		if ra < rb {
+			return -1
+		}
+
+		return 1
+	}
+
+	switch av := a.(type) {
+	case int:
+		bv := b.(int)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	case string:
+		return strings.Compare(av, b.(string))
+	case bool:
+		bv := b.(bool)
+		switch {
+		case !av && bv:
+			return -1
+		case av && !bv:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func tagValueRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int:
+		return 2
+	case float64:
+		return 3
+	case string:
+		return 4
+	case compositeUpperBound:
+		return 6
+	}
+
+	return 5
+}
+
+// CreateCompositeIndex - builds an index ordered by values of several tags from existing entries,
+// from now on it is maintained on every change of tags, only the definition is persisted
+// and the index is rebuilt from tags when the database is reopened
+func (ee *defaultEngine) CreateCompositeIndex(name string, tagNames ...string) error {
+	ee.Lock()
+	defer ee.Unlock()
+
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if name == "" {
+		return errors.Wrap(ErrInvalidIndexType, "index name cannot be empty")
+	}
+
+	if len(tagNames) < 2 {
+		return errors.Wrapf(ErrInvalidIndexType, "composite index %s needs at least two tags", name)
+	}
+
+	seen := make(map[string]bool, len(tagNames))
+	for _, tn := range tagNames {
+		if tn == "" || seen[tn] {
+			return errors.Wrapf(ErrInvalidIndexType, "composite index %s has an empty or repeated tag", name)
+		}
+
+		seen[tn] = true
+	}
+
+	if ee.indexExists(name) {
+		return errors.Wrapf(ErrIndexAlreadyExists, "%s", name)
+	}
+
+	ci := newCompositeIndex(name, append([]string{}, tagNames...))
+	if err := ee.Persist([]serializable{ci}); err != nil {
+		return err
+	}
+
+	ee.buildCompositeIndex(ci)
+	ee.compositeIndexes[name] = ci
+
+	return nil
+}
+
+// DefineCompositeIndex - registers a composite index, it is built after the whole log is loaded
+func (ee *defaultEngine) DefineCompositeIndex(ci *compositeIndex) error {
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	ee.compositeIndexes[ci.name] = ci
+	return nil
+}
+
+// indexExists - names are shared by field, text and composite indexes
+func (ee *defaultEngine) indexExists(name string) bool {
+	_, isField := ee.fieldIndexes[name]
+	_, isText := ee.textIndexes[name]
+	_, isComposite := ee.compositeIndexes[name]
+
+	return isField || isText || isComposite
+}
+
+func (ee *defaultEngine) buildCompositeIndex(ci *compositeIndex) {
+	ci.reset()
+	ee.pks.Ascend(nil, func(item interface{}) bool {
+		ci.add(item.(*entry))
+		return true
+	})
+}
+
+func (ee *defaultEngine) rebuildCompositeIndexes() {
+	for _, ci := range ee.compositeIndexes {
+		ee.buildCompositeIndex(ci)
+	}
+}
+
+// rebuildCompositeIndexesOf - rebuilds composite indexes covering a tag
+func (ee *defaultEngine) rebuildCompositeIndexesOf(tagName string) {
+	for _, ci := range ee.compositeIndexes {
+		for _, name := range ci.fields {
+			if name == tagName {
+				ee.buildCompositeIndex(ci)
+				break
+			}
+		}
+	}
+}
+
+// indexComposite - puts current tags of the entry into composite indexes,
+// composite indexes are rebuilt after the log is replayed, so nothing is done while loading
+func (ee *defaultEngine) indexComposite(ent *entry) {
+	if ee.replaying {
+		return
+	}
+
+	for _, ci := range ee.compositeIndexes {
+		ci.add(ent)
+	}
+}
+
+func (ee *defaultEngine) unindexComposite(ent *entry) {
+	key := ent.key.String()
+	for _, ci := range ee.compositeIndexes {
+		if item, ok := ci.items[key]; ok && item.ent == ent {
+			ci.remove(key)
+		}
+	}
+}
+
+// planCompositeScan - candidates are taken from the composite index matching the fewest entries
+// of the tag conditions combined with AND, no more than bound, the rest of the tags is checked on every candidate
+func (ee *defaultEngine) planCompositeScan(q *QueryOptions, bound int) *queryPlan {
+	if q.tags.op != andOp || len(ee.compositeIndexes) == 0 {
+		return nil
+	}
+
+	conditions := ee.compositeConditions(q.tags)
+
+	var best *compositeIndex
+	var bestEnts []*entry
+
+	for _, name := range ee.compositeIndexNames() {
+		ci := ee.compositeIndexes[name]
+
+		ents, ok := ci.match(conditions, bound)
+		if !ok || (best != nil && len(ents) >= len(bestEnts)) {
+			continue
+		}
+
+		best, bestEnts = ci, ents
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	p := &queryPlan{
+		strategy:  CompositeIndexScan,
+		indexes:   []string{best.name},
+		estimated: len(bestEnts),
+		tags:      q.tags,
+		sink:      newFilteredEntriesSink(q),
+	}
+
+	p.sink.add(bestEnts...)
+
+	return p
+}
+
+// planOrderedCompositeScan - walks a composite index in order of the first sort key when all the tags
+// preceding it in the index have equality conditions, so a limit stops the query early without sorting,
+// the index with the most equality conditions is used and the rest of the tags is checked on every entry
+func (ee *defaultEngine) planOrderedCompositeScan(q *QueryOptions) (*queryPlan, error) {
+	sortTag := q.sortBy[0].tag
+	if sortTag == "" || q.tags == nil || q.tags.op != andOp || len(ee.compositeIndexes) == 0 {
+		return nil, nil
+	}
+
+	conditions := ee.compositeConditions(q.tags)
+
+	var best *compositeIndex
+	var bestEq []interface{}
+
+	for _, name := range ee.compositeIndexNames() {
+		ci := ee.compositeIndexes[name]
+		if eq, ok := ci.orderedPrefix(conditions, sortTag); ok && len(eq) > len(bestEq) {
+			best, bestEq = ci, eq
+		}
+	}
+
+	if best == nil {
+		return nil, nil
+	}
+
+	rows, err := newTagMatcher(ee.tags, ee.allEntries, ee.pks.Len()).estimate(q.tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queryPlan{
+		strategy:  CompositeIndexScan,
+		indexes:   []string{best.name},
+		estimated: rows,
+		tags:      q.tags,
+		scan:      best.orderedScan(bestEq),
+		ordered:   true,
+	}, nil
+}
+
+// compositeConditions - conditions combined with AND with values of the types of their tag indexes
+func (ee *defaultEngine) compositeConditions(qt *QueryTags) []tagCondition {
+	conditions := andConditions(qt)
+	for i := range conditions {
+		if idx := ee.tags.data[conditions[i].key.name]; idx != nil {
+			conditions[i] = conditions[i].coerce(idx.dt)
+		}
+	}
+
+	return conditions
+}
+
+func (ee *defaultEngine) compositeIndexNames() []string {
+	names := make([]string, 0, len(ee.compositeIndexes))
+	for name := range ee.compositeIndexes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,326 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func seedTickets(t *testing.T, db *lemon.DB) {
+	t.Helper()
+
+	statuses := []string{"open", "closed", "pending", "spam"}
+	for i := 1; i <= 24; i++ {
+		tenant := "acme"
+		if i%2 == 0 {
+			tenant = "globex"
+		}
+
+		require.NoError(t, db.Insert(
+			fmt.Sprintf("ticket:%d", i),
+			lemon.M{"id": i},
+			lemon.WithTags().Str("tenant", tenant).Str("status", statuses[(i/2)%4]).Int("rank", i),
+		))
+	}
+}
+
+func TestDB_CompositeIndex(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	seedTickets(t, db)
+	require.NoError(t, db.CreateCompositeIndex("tenant_status_rank", "tenant", "status", "rank"))
+
+	tt := []struct {
+		name string
+		tags *lemon.QueryTags
+		keys []string
+	}{
+		{
+			name: "all the fields",
+			tags: lemon.QT().StrTagEq("tenant", "acme").StrTagEq("status", "pending").IntTagEq("rank", 5),
+			keys: []string{"ticket:5"},
+		},
+		{
+			name: "leading fields",
+			tags: lemon.QT().StrTagEq("tenant", "acme").StrTagEq("status", "closed"),
+			keys: []string{"ticket:3", "ticket:11", "ticket:19"},
+		},
+		{
+			name: "range on the last field",
+			tags: lemon.QT().StrTagEq("tenant", "globex").StrTagEq("status", "open").IntTagGt("rank", 8),
+			keys: []string{"ticket:16", "ticket:24"},
+		},
+		{
+			name: "between on the last field",
+			tags: lemon.QT().StrTagEq("tenant", "globex").StrTagEq("status", "open").IntTagBetween("rank", 0, 16),
+			keys: []string{"ticket:8", "ticket:16"},
+		},
+		{
+			name: "range on the second field",
+			tags: lemon.QT().StrTagEq("tenant", "acme").StrTagPrefix("status", "sp"),
+			keys: []string{"ticket:7", "ticket:15", "ticket:23"},
+		},
+		{
+			name: "other conditions are checked on matched documents",
+			tags: lemon.QT().StrTagEq("tenant", "acme").StrTagEq("status", "closed").IntTagGte("rank", 4).IntTagLt("rank", 12),
+			keys: []string{"ticket:11"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			q := lemon.Q().HasAllTags(tc.tags)
+
+			docs, err := db.Find(q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+
+			e, err := db.Explain(q)
+			require.NoError(t, err)
+			assert.Equal(t, lemon.CompositeIndexScan, e.Strategy)
+			assert.Equal(t, []string{"tenant_status_rank"}, e.Indexes)
+			assert.Equal(t, len(tc.keys), e.ActualRows)
+		})
+	}
+
+	t.Run("not used without the first tag", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().HasAllTags(lemon.QT().StrTagEq("status", "spam").IntTagGt("rank", 20)))
+		require.NoError(t, err)
+		assert.NotEqual(t, lemon.CompositeIndexScan, e.Strategy)
+		assert.Equal(t, 2, e.ActualRows)
+	})
+
+	t.Run("follows changes of tags", func(t *testing.T) {
+		q := lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "acme").StrTagEq("status", "closed"))
+
+		require.NoError(t, db.Tag("ticket:1", lemon.M{"status": "closed"}))
+		require.NoError(t, db.Untag("ticket:3", "status"))
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.Remove("ticket:11"); err != nil {
+				return err
+			}
+
+			return tx.Insert("ticket:25", lemon.M{"id": 25}, lemon.WithTags().Str("tenant", "acme").Str("status", "closed"))
+		}))
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.InsertOrReplace("ticket:19", lemon.M{"id": 19}, lemon.WithTags().Str("tenant", "globex").Str("status", "closed"))
+		}))
+
+		docs, err := db.Find(q)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ticket:1", "ticket:25"}, keysOf(docs))
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		err := db.CreateCompositeIndex("tenant_status_rank", "tenant", "rank")
+		assert.True(t, errors.Is(err, lemon.ErrIndexAlreadyExists))
+
+		err = db.CreateCompositeIndex("single", "tenant")
+		assert.True(t, errors.Is(err, lemon.ErrInvalidIndexType))
+
+		err = db.CreateCompositeIndex("repeated", "tenant", "tenant")
+		assert.True(t, errors.Is(err, lemon.ErrInvalidIndexType))
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		require.NoError(t, db.DropIndex("tenant_status_rank"))
+
+		q := lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "acme").StrTagEq("status", "pending"))
+		e, err := db.Explain(q)
+		require.NoError(t, err)
+		assert.NotEqual(t, lemon.CompositeIndexScan, e.Strategy)
+		assert.Equal(t, 3, e.ActualRows)
+	})
+}
+
+func TestDB_CompositeIndexPersistence(t *testing.T) {
+	fixture := "./__fixtures__/composite_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	open := func() (*lemon.DB, lemon.Closer) {
+		db, closer, err := lemon.Open(fixture, &lemon.Config{
+			DisableAutoVacuum:   true,
+			PersistenceStrategy: lemon.Sync,
+		})
+
+		require.NoError(t, err)
+		return db, closer
+	}
+
+	db, closer := open()
+	require.NoError(t, db.CreateCompositeIndex("tenant_status", "tenant", "status"))
+	seedTickets(t, db)
+	require.NoError(t, db.Untag("ticket:3", "status"))
+	require.NoError(t, closer())
+
+	q := lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "acme").StrTagEq("status", "closed"))
+
+	check := func(db *lemon.DB) {
+		e, err := db.Explain(q)
+		require.NoError(t, err)
+		assert.Equal(t, lemon.CompositeIndexScan, e.Strategy)
+
+		docs, err := db.Find(q)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ticket:11", "ticket:19"}, keysOf(docs))
+	}
+
+	db, closer = open()
+	check(db)
+	require.NoError(t, db.Vacuum(context.Background()))
+	require.NoError(t, closer())
+
+	db, closer = open()
+	defer func() {
+		require.NoError(t, closer())
+	}()
+
+	check(db)
+}
+
+func TestDB_CompositeIndexQueryLiterals(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	for i := 1; i <= 6; i++ {
+		require.NoError(t, db.Insert(
+			fmt.Sprintf("item:%d", i),
+			lemon.M{"id": i},
+			lemon.WithTags().Str("kind", []string{"book", "pen"}[i%2]).Float("price", float64(i)),
+		))
+	}
+
+	require.NoError(t, db.CreateCompositeIndex("kind_price", "kind", "price"))
+
+	tt := []struct {
+		query string
+		keys  []string
+	}{
+		{query: "WHERE tag.kind = 'book' AND tag.price = 4", keys: []string{"item:4"}},
+		{query: "WHERE tag.kind = 'pen' AND tag.price > 1", keys: []string{"item:3", "item:5"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := lemon.ParseQuery(tc.query)
+			require.NoError(t, err)
+
+			docs, err := db.Find(q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+
+			e, err := db.Explain(q)
+			require.NoError(t, err)
+			assert.Equal(t, lemon.CompositeIndexScan, e.Strategy)
+		})
+	}
+}
+
+func TestDB_CompositeIndexOrderedScan(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	seedTickets(t, db)
+	require.NoError(t, db.Insert("ticket:30", lemon.M{"id": 30}, lemon.WithTags().Str("tenant", "globex").Str("status", "open")))
+	require.NoError(t, db.Insert("ticket:31", lemon.M{"id": 31}, lemon.WithTags().Str("tenant", "globex").Str("status", "spam").Int("rank", 4)))
+	require.NoError(t, db.CreateCompositeIndex("tenant_status_rank", "tenant", "status", "rank"))
+	require.NoError(t, db.CreateCompositeIndex("tenant_rank", "tenant", "rank"))
+
+	tt := []struct {
+		name    string
+		q       *lemon.QueryOptions
+		keys    []string
+		index   string
+		scanned int
+	}{
+		{
+			name:    "descending with limit",
+			q:       lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "acme").StrTagEq("status", "closed")).OrderBy("rank", lemon.DescOrder).Limit(2),
+			keys:    []string{"ticket:19", "ticket:11"},
+			index:   "tenant_status_rank",
+			scanned: 2,
+		},
+		{
+			name:    "equal values are ordered by the rest of sort keys",
+			q:       lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "globex")).OrderBy("rank", lemon.AscOrder).ThenBy("status", lemon.DescOrder).Limit(3),
+			keys:    []string{"ticket:2", "ticket:31", "ticket:4"},
+			index:   "tenant_rank",
+			scanned: 3,
+		},
+		{
+			name:    "other conditions are checked on walked entries",
+			q:       lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "acme").IntTagGt("rank", 10)).OrderBy("rank", lemon.AscOrder).Limit(2),
+			keys:    []string{"ticket:11", "ticket:13"},
+			index:   "tenant_rank",
+			scanned: 7,
+		},
+		{
+			name:    "entries without the sort tag come last in ascending order",
+			q:       lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "globex").StrTagEq("status", "open")).OrderBy("rank", lemon.AscOrder),
+			keys:    []string{"ticket:8", "ticket:16", "ticket:24", "ticket:30"},
+			index:   "tenant_status_rank",
+			scanned: 4,
+		},
+		{
+			name:    "entries without the sort tag come last in descending order",
+			q:       lemon.Q().HasAllTags(lemon.QT().StrTagEq("tenant", "globex").StrTagEq("status", "open")).OrderBy("rank", lemon.DescOrder),
+			keys:    []string{"ticket:24", "ticket:16", "ticket:8", "ticket:30"},
+			index:   "tenant_status_rank",
+			scanned: 4,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.Find(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+
+			e, err := db.Explain(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, lemon.CompositeIndexScan, e.Strategy)
+			assert.Equal(t, []string{tc.index}, e.Indexes)
+			assert.Equal(t, tc.scanned, e.ScannedRows)
+			assert.Equal(t, len(tc.keys), e.ActualRows)
+		})
+	}
+
+	t.Run("not used when a preceding tag has no equality", func(t *testing.T) {
+		q := lemon.Q().HasAllTags(lemon.QT().StrTagEq("status", "open")).OrderBy("rank", lemon.DescOrder).Limit(2)
+
+		e, err := db.Explain(q)
+		require.NoError(t, err)
+		assert.NotEqual(t, lemon.CompositeIndexScan, e.Strategy)
+		assert.Equal(t, 2, e.ActualRows)
+	})
+}
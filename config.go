@@ -11,6 +11,7 @@ const defaultAutoVacuumMinSize uint64 = 1000
 
 var defaultAutovacuumIntervals = 10 * time.Minute
 var defaultPersistenceIntervals = 1 * time.Second
+var defaultExpiredKeysReapIntervals = 1 * time.Second
 
 type Config struct {
 	PersistenceStrategy          PersistenceStrategy
@@ -24,6 +25,11 @@ type Config struct {
 	AutoVacuumIntervals          time.Duration
 	MaxCacheSize                 uint64
 	OnCacheEvict                 OnCacheEvict
+	BeforeCommit                 BeforeCommitHook
+	AfterCommit                  AfterCommitHook
+	ExpiredKeysReapIntervals     time.Duration
+	DisableExpiredKeysReaper     bool
+	Clock                        Clock
 }
 
 type EngineOptions interface {
@@ -63,6 +69,8 @@ func (cfg *Config) applyTo(inMemoryOnly bool, ee executionEngine) error {
 		cfg.AutoVacuumMinSize = defaultAutoVacuumMinSize
 	}
 
+	cfg.applyReaperDefaults()
+
 	ee.SetCfg(cfg)
 
 	return nil
@@ -94,8 +102,19 @@ func (cfg *Config) ensureInMemoryConfiguration(ee executionEngine) error {
 	cfg.PersistenceStrategy = InMemory
 	cfg.ValueLoadStrategy = EagerLoad
 	cfg.DisableAutoVacuum = true
+	cfg.applyReaperDefaults()
 
 	ee.SetCfg(cfg)
 
 	return nil
-}
\ No newline at end of file
+}
+func (cfg *Config) applyReaperDefaults() {
+	if cfg.DisableExpiredKeysReaper {
+		cfg.ExpiredKeysReapIntervals = 0
+		return
+	}
+
+	if cfg.ExpiredKeysReapIntervals == 0 {
+		cfg.ExpiredKeysReapIntervals = defaultExpiredKeysReapIntervals
+	}
+}
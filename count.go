@@ -0,0 +1,181 @@
+package lemon
+
+import (
+	"context"
+	"time"
+)
+
+// CountByQuery - counts entries matching query options from sizes of tag index containers
+// and walks over primary keys, without collecting, sorting or loading entries,
+// ok is false when the query has to be executed in order to be counted
+func (ee *defaultEngine) CountByQuery(q *QueryOptions) (count int, ok bool, err error) {
+	if ee.closed {
+		return 0, false, ErrDatabaseAlreadyClosed
+	}
+
+	if !q.countable() {
+		return 0, false, nil
+	}
+
+	now := ee.Now()
+
+	switch {
+	case q.tags != nil && !q.tags.empty():
+		if count, ok, err = ee.countTags(q, now); err != nil || !ok {
+			return 0, ok, err
+		}
+	case q.filtersKeys():
+		count = ee.countScanned(q, nil, now)
+	default:
+		count = ee.pks.Len() - ee.countExpired(q, now)
+	}
+
+	return limitCount(count, q.limit, q.offset), true, nil
+}
+
+// countTags - a single condition is counted straight from sizes of its containers,
+// otherwise either keys are walked checking tags or matched entries are counted,
+// whichever is cheaper the same way the planner chooses
+func (ee *defaultEngine) countTags(q *QueryOptions, now time.Time) (int, bool, error) {
+	if c := singleTagCondition(q.tags); c != nil && c.key.comp != in && !q.filtersKeys() {
+		count, err := ee.tags.estimateCondition(*c)
+		if err != nil {
+			return 0, false, err
+		}
+
+		return count - ee.countExpired(q, now), true, nil
+	}
+
+	m := newTagMatcher(ee.tags, ee.allEntries, ee.pks.Len())
+
+	tagRows, err := m.estimate(q.tags)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if q.filtersKeys() && ee.countKeys(q, tagRows) <= tagRows {
+		return ee.countScanned(q, q.tags, now), true, nil
+	}
+
+	// cursors are applied to sorted keys, so matched entries cannot be counted
+	if q.after != nil {
+		return 0, false, nil
+	}
+
+	matched, err := m.match(q.tags)
+	if err != nil {
+		return 0, false, err
+	}
+
+	count := 0
+	for _, ent := range matched {
+		if q.matchesKey(ent.key) && !ent.expired(now) {
+			count++
+		}
+	}
+
+	return count, true, nil
+}
+
+// countScanned - walks primary keys the same way key scans do checking tags if any
+func (ee *defaultEngine) countScanned(q *QueryOptions, tags *QueryTags, now time.Time) int {
+	count := 0
+
+	sc, _ := ee.ChooseBestScanner(q)
+	_ = sc(context.Background(), q, func(ent *entry) bool {
+		if !ent.expired(now) && (tags == nil || tags.matchEntry(ent)) {
+			count++
+		}
+
+		return true
+	})
+
+	return count
+}
+
+// countExpired - expired entries stay in indexes until they are reaped,
+// so the ones matching query options are subtracted from sizes of indexes
+func (ee *defaultEngine) countExpired(q *QueryOptions, now time.Time) int {
+	idx, ok := ee.tags.data[ExpiresAt]
+	if !ok {
+		return 0
+	}
+
+	count := 0
+	idx.btr.Ascend(nil, func(item interface{}) bool {
+		for _, ent := range item.(entryContainer).getEntries() {
+			// containers are ordered by expiration time
+			if !ent.expired(now) {
+				return false
+			}
+
+			if q.matchesKey(ent.key) && (q.tags == nil || q.tags.matchEntry(ent)) {
+				count++
+			}
+		}
+
+		return true
+	})
+
+	return count
+}
+
+// countable - documents are not needed to evaluate query options
+func (qo *QueryOptions) countable() bool {
+	return qo.byTagName == "" && qo.text == nil && len(qo.where) == 0
+}
+
+// filtersKeys - query options restrict primary keys
+func (qo *QueryOptions) filtersKeys() bool {
+	return qo.keyRange != nil ||
+		qo.prefix != "" ||
+		(len(qo.patterns) > 0 && !(len(qo.patterns) == 1 && qo.patterns[0] == "*")) ||
+		qo.keyRegex != nil ||
+		qo.after != nil
+}
+
+// singleTagCondition - the only condition of query tags made of AND groups, nil if there are more
+func singleTagCondition(qt *QueryTags) *tagCondition {
+	var found *tagCondition
+
+	var walk func(qt *QueryTags) bool
+	walk = func(qt *QueryTags) bool {
+		if qt.op != andOp {
+			return false
+		}
+
+		for i := range qt.conditions {
+			if found != nil {
+				return false
+			}
+
+			found = &qt.conditions[i]
+		}
+
+		for _, g := range qt.groups {
+			if !walk(g) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if !walk(qt) {
+		return nil
+	}
+
+	return found
+}
+
+func limitCount(count, limit, offset int) int {
+	if count -= offset; count < 0 {
+		return 0
+	}
+
+	if limit > 0 && count > limit {
+		return limit
+	}
+
+	return count
+}
@@ -0,0 +1,78 @@
+package lemon_test
+
+import (
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDB_CountByQueryFromIndexes(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)}
+
+	db, closer, err := lemon.Open(lemon.InMemory, &lemon.Config{
+		Clock:                    clock,
+		DisableExpiredKeysReaper: true,
+	})
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	colors := []string{"red", "green", "blue"}
+	for i := 1; i <= 60; i++ {
+		meta := []lemon.MetaApplier{lemon.WithTags().Str("color", colors[i%3]).Int("size", i%10)}
+		if i%7 == 0 {
+			meta = append(meta, lemon.WithTTL(time.Minute))
+		}
+
+		require.NoError(t, db.Insert(fmt.Sprintf("item:%d", i), lemon.M{"n": i}, meta...))
+	}
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, db.Insert(fmt.Sprintf("other:%d", i), lemon.M{"n": i}, lemon.WithTags().Str("color", "red")))
+	}
+
+	// expired documents stay in indexes until they are reaped
+	clock.advance(2 * time.Minute)
+
+	tt := []struct {
+		name  string
+		q     *lemon.QueryOptions
+		count int
+	}{
+		{name: "everything", q: lemon.Q(), count: 57},
+		{name: "prefix", q: lemon.Q().Prefix("other"), count: 5},
+		{name: "key range", q: lemon.Q().KeyRange("item:10", "item:19"), count: 9},
+		{name: "pattern", q: lemon.Q().Match("item:1*"), count: 10},
+		{name: "single tag", q: lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "red")), count: 23},
+		{name: "tag range", q: lemon.Q().HasAllTags(lemon.QT().IntTagGte("size", 8)), count: 10},
+		{name: "tag presence", q: lemon.Q().HasAllTags(lemon.QT().HasTag(lemon.ExpiresAt)), count: 0},
+		{name: "tag in", q: lemon.Q().HasAllTags(lemon.QT().StrTagIn("color", "red", "red")), count: 23},
+		{name: "tags and keys", q: lemon.Q().Match("item:*").HasAllTags(lemon.QT().StrTagEq("color", "red")), count: 18},
+		{name: "narrow key range and tags", q: lemon.Q().KeyRange("item:1", "item:3").HasAllTags(lemon.QT().StrTagEq("color", "red")), count: 1},
+		{name: "several tags", q: lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "green").IntTagLt("size", 5)), count: 10},
+		{name: "any tags", q: lemon.Q().HasAnyTags(lemon.QT().StrTagEq("color", "green").IntTagEq("size", 0)), count: 21},
+		{name: "negation", q: lemon.Q().HasAllTags(lemon.Not(lemon.QT().StrTagEq("color", "red"))), count: 34},
+		{name: "limit and offset", q: lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "red")).Offset(20).Limit(5), count: 3},
+		{name: "where", q: lemon.Q().Prefix("item").Where("n", lemon.Gt, 50), count: 9},
+		{name: "unknown tag", q: lemon.Q().HasAllTags(lemon.QT().StrTagEq("shape", "round")), count: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			count, err := db.CountByQuery(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.count, count)
+
+			docs, err := db.Find(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, len(docs), count)
+		})
+	}
+}
@@ -22,6 +22,10 @@ type Document struct {
 	userTags M
 	metaTags M
 	value    []byte
+	// projected - values of selected paths and tags, nil unless query options select them
+	projected M
+	// populated - referenced documents loaded by query options Populate
+	populated map[string]*Document
 }
 
 func newDocumentFromEntry(ent *entry) *Document {
@@ -39,6 +43,18 @@ func newDocumentFromEntry(ent *entry) *Document {
 	return d
 }
 
+// newMetaDocumentFromEntry - document with key and tags only, the value is left empty
+func newMetaDocumentFromEntry(ent *entry) *Document {
+	userTags, metaTags := createMapFromTags(ent.tags)
+
+	return &Document{
+		key:      ent.key.String(),
+		userTags: userTags,
+		value:    []byte{},
+		metaTags: metaTags,
+	}
+}
+
 func (d *Document) Key() string {
 	return d.key
 }
@@ -61,6 +77,17 @@ func (d *Document) UpdatedAt() time.Time {
 	return time.UnixMilli(int64(ct))
 }
 
+// ExpiresAt - expiration time of the document,
+// zero time is returned if the document does not expire
+func (d *Document) ExpiresAt() time.Time {
+	ea := d.metaTags.Int(ExpiresAt)
+	if ea == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(int64(ea))
+}
+
 func (d *Document) IsJSON() bool {
 	return d.metaTags.String(ContentType) == string(JSON)
 }
@@ -116,6 +143,36 @@ func (d *Document) Tags() M {
 	return d.userTags
 }
 
+// Projected - values of paths and tags selected by query options keyed by paths and tag names,
+// e.g. `d.Projected().String("address.city")`, paths and tags a document does not have are left out,
+// nil is returned when nothing was selected
+func (d *Document) Projected() M {
+	return d.projected
+}
+
+// Ref - key of the document referenced under the given name, empty when there is no such reference
+func (d *Document) Ref(name string) string {
+	return d.metaTags.String(RefTag(name))
+}
+
+// Refs - keys of all referenced documents by reference names
+func (d *Document) Refs() map[string]string {
+	refs := make(map[string]string)
+	for name := range d.metaTags {
+		if strings.HasPrefix(name, refTagPrefix) {
+			refs[strings.TrimPrefix(name, refTagPrefix)] = d.metaTags.String(name)
+		}
+	}
+
+	return refs
+}
+
+// Populated - referenced document loaded by query options Populate,
+// nil when it was not populated or does not exist
+func (d *Document) Populated(name string) *Document {
+	return d.populated[name]
+}
+
 func (d *Document) M() (M, error) {
 	var m M
 	if err := d.JSON().Unmarshal(&m); err != nil {
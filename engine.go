@@ -44,36 +44,67 @@ type executionEngine interface {
 	FlushAll(ff func(ent *entry)) error
 	Vacuum(ctx context.Context) error
 	UpsertTag(name string, v interface{}, ent *entry) error
-	FilterEntriesByTags(q *QueryOptions) (*filterEntriesSink, error)
-	ChooseBestScanner(q *QueryOptions) (scanner, error)
+	Plan(q *QueryOptions, estimate bool) (*queryPlan, error)
 	RemoveEntryUnderLock(ent *entry)
 	SetCfg(cfg *Config)
+	Cfg() *Config
 	LoadEntryValue(ent *entry) error
+	ReadEntryValue(ent *entry) ([]byte, error)
+	Now() time.Time
+	BulkLoad(ctx context.Context, it BulkIterator, opts *BulkOptions) (BulkStats, error)
+	CreateIndex(name string, path JSONPath, ft FieldIndexType) error
+	DropIndex(name string) error
+	DefineIndex(fi *fieldIndex) error
+	UndefineIndex(name string) error
+	IndexFields(ent *entry) error
+	CreateTextIndex(name string, opts *TextIndexOptions) error
+	DefineTextIndex(ti *textIndex) error
+	CreateCompositeIndex(name string, tagNames ...string) error
+	DefineCompositeIndex(ci *compositeIndex) error
+	CreateUniqueTag(name, pattern string) error
+	DefineUniqueTag(ut *uniqueTag) error
+	CheckUnique(key PK, tags tags) error
+	CountByQuery(q *QueryOptions) (int, bool, error)
+	FindByUniqueTag(name string, value interface{}) (*entry, error)
+	RefTagNames() ([]string, error)
+	TagEdge(name string, order Order, now time.Time) (float64, bool, error)
+	TagValues(name string, accept func(ent *entry) bool) ([]TagValue, error)
 }
 
 type defaultEngine struct {
 	sync.RWMutex
 
-	lg            glog.Logger
-	dbFile        string
-	cfg           *Config
-	persistence   *persistence
-	pks           *btree.BTree
-	tags          *tagIndex
+	lg           glog.Logger
+	dbFile       string
+	cfg          *Config
+	persistence  *persistence
+	pks          *btree.BTree
+	tags         *tagIndex
+	fieldIndexes map[string]*fieldIndex
+	textIndexes  map[string]*textIndex
+	// composite indexes by name
+	compositeIndexes map[string]*compositeIndex
+	// unique tags by tag name
+	uniqueTags    map[string]*uniqueTag
 	stopCh        chan struct{}
 	runningVacuum bool
+	replaying     bool
 	totalDeletes  uint64
 	closed        bool
 }
 
 func newDefaultEngine(dbFile string, lg glog.Logger, cfg *Config) (*defaultEngine, error) {
 	e := &defaultEngine{
-		dbFile: dbFile,
-		pks:    btree.NewNonConcurrent(byPrimaryKeys),
-		tags:   newTagIndex(),
-		stopCh: make(chan struct{}, 1),
-		cfg:    cfg,
-		lg:     lg,
+		dbFile:           dbFile,
+		pks:              btree.NewNonConcurrent(byPrimaryKeys),
+		tags:             newTagIndex(),
+		fieldIndexes:     make(map[string]*fieldIndex),
+		textIndexes:      make(map[string]*textIndex),
+		stopCh:           make(chan struct{}, 1),
+		compositeIndexes: make(map[string]*compositeIndex),
+		uniqueTags:       make(map[string]*uniqueTag),
+		cfg:              cfg,
+		lg:               lg,
 	}
 
 	return e, nil
@@ -83,6 +114,19 @@ func (ee *defaultEngine) SetCfg(cfg *Config) {
 	ee.cfg = cfg
 }
 
+func (ee *defaultEngine) Cfg() *Config {
+	return ee.cfg
+}
+
+// Now - current time according to configured clock
+func (ee *defaultEngine) Now() time.Time {
+	if ee.cfg != nil && ee.cfg.Clock != nil {
+		return ee.cfg.Clock.Now()
+	}
+
+	return time.Now()
+}
+
 func (ee *defaultEngine) asyncFlush(d time.Duration) {
 	t := time.NewTicker(d)
 
@@ -138,6 +182,10 @@ func (ee *defaultEngine) runVacuumUnderLock(ctx context.Context) error {
 	rs := ee.persistence.newSerializer()
 	rs.reset()
 
+	if err := ee.serializeIndexDefinitions(rs); err != nil {
+		return errors.Wrap(err, "could not finish vacuum")
+	}
+
 	var pErr error
 	ee.pks.Ascend(nil, func(i interface{}) bool {
 		if err := ctx.Err(); err != nil {
@@ -233,12 +281,21 @@ func (ee *defaultEngine) init() error {
 
 		ee.persistence = p
 
+		ee.replaying = true
 		if err := ee.persistence.load(func(d deserializable) error {
 			return d.deserialize(ee)
 		}); err != nil {
 			return err
 		}
 
+		ee.replaying = false
+		if err := ee.rebuildTextIndexes(); err != nil {
+			return err
+		}
+
+		ee.rebuildCompositeIndexes()
+		ee.rebuildUniqueTags()
+
 		if ee.cfg.PersistenceStrategy == Async {
 			go ee.asyncFlush(ee.cfg.AsyncPersistenceIntervals)
 		}
@@ -250,6 +307,10 @@ func (ee *defaultEngine) init() error {
 		ee.cfg.ValueLoadStrategy = EagerLoad
 	}
 
+	if ee.cfg.ExpiredKeysReapIntervals > 0 {
+		go ee.scheduleReaper(ee.cfg.ExpiredKeysReapIntervals)
+	}
+
 	return nil
 }
 
@@ -288,12 +349,30 @@ func (ee *defaultEngine) LoadEntryValue(ent *entry) error {
 	return nil
 }
 
+// ReadEntryValue - value of the entry, read from cache or disk when the entry does not hold it,
+// the entry itself is left untouched, so it can be called under a read lock
+func (ee *defaultEngine) ReadEntryValue(ent *entry) ([]byte, error) {
+	if ee.closed {
+		return nil, ErrDatabaseAlreadyClosed
+	}
+
+	if ent.value != nil || ent.pos.offset == 0 ||
+		ee.cfg.PersistenceStrategy == InMemory || ee.cfg.ValueLoadStrategy == EagerLoad {
+		return ent.value, nil
+	}
+
+	return ee.persistence.readValue(ent)
+}
+
 func (ee *defaultEngine) RemoveEntryUnderLock(ent *entry) {
 	if ee.closed {
 		return
 	}
 
 	ee.tags.removeEntry(ent)
+	ee.unindexText(ent)
+	ee.unindexComposite(ent)
+	ee.unindexUnique(ent)
 	ee.pks.Delete(ent)
 
 	if ee.dbFile != InMemory {
@@ -314,7 +393,13 @@ func (ee *defaultEngine) AddTag(name string, value interface{}, ent *entry) erro
 		return ErrDatabaseAlreadyClosed
 	}
 
-	return ee.tags.add(name, value, ent)
+	if err := ee.tags.add(name, value, ent); err != nil {
+		return err
+	}
+
+	ee.indexComposite(ent)
+	ee.indexUnique(ent)
+	return nil
 }
 
 func (ee *defaultEngine) Insert(ent *entry) error {
@@ -333,7 +418,9 @@ func (ee *defaultEngine) Insert(ent *entry) error {
 		}
 	}
 
-	return nil
+	ee.indexComposite(ent)
+	ee.indexUnique(ent)
+	return ee.indexText(ent)
 }
 
 func (ee *defaultEngine) Exists(key string) bool {
@@ -417,6 +504,10 @@ func (ee *defaultEngine) Remove(key PK) error {
 	}
 
 	ee.totalDeletes++
+	ee.tags.removeEntry(ent.(*entry))
+	ee.unindexText(ent.(*entry))
+	ee.unindexComposite(ent.(*entry))
+	ee.unindexUnique(ent.(*entry))
 	ee.pks.Delete(&entry{key: key})
 
 	return nil
@@ -436,8 +527,9 @@ func (ee *defaultEngine) clearEntityTags(ent *entry) {
 	ee.tags.removeEntry(ent)
 }
 
+// Count - number of keys, expired keys that are not reaped yet are left out
 func (ee *defaultEngine) Count() int {
-	return ee.pks.Len()
+	return ee.pks.Len() - ee.countExpired(Q(), ee.Now())
 }
 
 func (ee *defaultEngine) scanBetweenDescend(
@@ -449,7 +541,7 @@ func (ee *defaultEngine) scanBetweenDescend(
 	descendRange(
 		ee.pks,
 		&entry{key: newPK(q.keyRange.From)},
-		&entry{key: newPK(q.keyRange.To)},
+		&entry{key: newPK(q.descendFrom(q.keyRange.To))},
 		filteringBTreeIterator(ctx, ee.lg, q, ir),
 	)
 
@@ -463,7 +555,7 @@ func (ee *defaultEngine) scanBetweenAscend(
 ) (err error) {
 	ascendRange(
 		ee.pks,
-		&entry{key: newPK(q.keyRange.From)},
+		&entry{key: newPK(q.ascendFrom(q.keyRange.From))},
 		&entry{key: newPK(q.keyRange.To)},
 		filteringBTreeIterator(ctx, ee.lg, q, ir),
 	)
@@ -476,7 +568,7 @@ func (ee *defaultEngine) scanPrefixAscend(
 	q *QueryOptions,
 	ir entryIterator,
 ) (err error) {
-	ee.pks.Ascend(&entry{key: newPK(q.prefix)}, filteringBTreeIterator(ctx, ee.lg, q, ir))
+	ee.pks.Ascend(&entry{key: newPK(q.ascendFrom(q.prefix))}, filteringBTreeIterator(ctx, ee.lg, q, ir))
 
 	return
 }
@@ -486,6 +578,17 @@ func (ee *defaultEngine) scanPrefixDescend(
 	q *QueryOptions,
 	ir entryIterator,
 ) (err error) {
+	if from := q.descendFrom(""); from != "" {
+		descendRange(
+			ee.pks,
+			&entry{key: newPK(q.prefix)},
+			&entry{key: newPK(from)},
+			filteringBTreeIterator(ctx, ee.lg, q, ir),
+		)
+
+		return
+	}
+
 	descendGreaterThan(ee.pks, &entry{key: newPK(q.prefix)}, filteringBTreeIterator(ctx, ee.lg, q, ir))
 	return
 }
@@ -495,7 +598,7 @@ func (ee *defaultEngine) scanAscend(
 	q *QueryOptions,
 	ir entryIterator,
 ) (err error) {
-	ee.pks.Ascend(nil, filteringBTreeIterator(ctx, ee.lg, q, ir))
+	ee.pks.Ascend(scanPivot(q.ascendFrom("")), filteringBTreeIterator(ctx, ee.lg, q, ir))
 	return
 }
 
@@ -504,10 +607,19 @@ func (ee *defaultEngine) scanDescend(
 	q *QueryOptions,
 	ir entryIterator,
 ) (err error) {
-	ee.pks.Descend(nil, filteringBTreeIterator(ctx, ee.lg, q, ir))
+	ee.pks.Descend(scanPivot(q.descendFrom("")), filteringBTreeIterator(ctx, ee.lg, q, ir))
 	return
 }
 
+// scanPivot - pivot to start scanning from, nil to scan from the very edge
+func scanPivot(from string) interface{} {
+	if from == "" {
+		return nil
+	}
+
+	return &entry{key: newPK(from)}
+}
+
 func (ee *defaultEngine) ChooseBestScanner(q *QueryOptions) (scanner, error) {
 	if q.keyRange != nil {
 		if q.order == AscOrder {
@@ -532,139 +644,15 @@ func (ee *defaultEngine) ChooseBestScanner(q *QueryOptions) (scanner, error) {
 	}
 }
 
-// FilterEntriesByTags - uses secondary indexes (tags) to filter entries
-// and puts them to sink, which it creates to store all the matched entries
-func (ee *defaultEngine) FilterEntriesByTags(q *QueryOptions) (*filterEntriesSink, error) {
-	if ee.closed {
-		return nil, ErrDatabaseAlreadyClosed
-	}
-
-	if q == nil || (q.allTags == nil && q.byTagName == "") {
-		return nil, nil
-	}
-
-	fes := newFilteredEntriesSink(q.patterns)
-
-	// one tag name scan
-	if q.byTagName != "" {
-		idx, ok := ee.tags.data[q.byTagName]
-		if !ok {
-			return nil, errors.Wrapf(ErrTagKeyNotFound, "%s", q.byTagName)
-		}
-
-		switch q.order {
-		case DescOrder:
-			idx.btr.Descend(nil, func(item interface{}) bool {
-				ents := item.(entryContainer).getEntries()
-				fes.addMap(ents)
-				return true
-			})
-		default:
-			idx.btr.Ascend(nil, func(item interface{}) bool {
-				ents := item.(entryContainer).getEntries()
-				fes.addMap(ents)
-				return true
-			})
-		}
-
-		return fes, nil
-	}
-
-	errCh := make(chan error, 4)
-	var wg sync.WaitGroup
-
-	if len(q.allTags.booleans) > 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			for tk, v := range q.allTags.booleans {
-				if ee.tags.data[tk.name] == nil {
-					continue
-				}
-
-				btf, err := createBoolTagFilter(ee.tags, tk, v)
-				if err != nil {
-					errCh <- err
-					return
-				}
-
-				ee.tags.filterEntities(btf, fes)
-			}
-		}()
-	}
-
-	if len(q.allTags.strings) > 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			for tk, v := range q.allTags.strings {
-				if ee.tags.data[tk.name] == nil {
-					continue
-				}
-
-				stf, err := createStringTagFilter(ee.tags, tk, v)
-				if err != nil {
-					errCh <- err
-					return
-				}
-
-				ee.tags.filterEntities(stf, fes)
-			}
-		}()
-	}
-
-	if len(q.allTags.integers) > 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			for tk, v := range q.allTags.integers {
-				if ee.tags.data[tk.name] == nil {
-					continue
-				}
-
-				itf, err := createIntegerTagFilter(ee.tags, tk, v)
-				if err != nil {
-					errCh <- err
-					return
-				}
-
-				ee.tags.filterEntities(itf, fes)
-			}
-		}()
-	}
-
-	if len(q.allTags.floats) > 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			for tk, v := range q.allTags.floats {
-				if ee.tags.data[tk.name] == nil {
-					continue
-				}
-
-				ftf, err := createFloatTagFilter(ee.tags, tk, v)
-				if err != nil {
-					errCh <- err
-					return
-				}
-
-				ee.tags.filterEntities(ftf, fes)
-			}
-		}()
-	}
-
-	wg.Wait()
+func (ee *defaultEngine) allEntries() entrySet {
+	result := make(entrySet, ee.pks.Len())
+	ee.pks.Ascend(nil, func(item interface{}) bool {
+		ent := item.(*entry)
+		result[ent.key.String()] = ent
+		return true
+	})
 
-	select {
-	case err := <-errCh:
-		return nil, err
-	default:
-		return fes, nil
-	}
+	return result
 }
 
 // UpsertTag - updates or inserts a new tag, adding it to the entity
@@ -681,9 +669,9 @@ func (ee *defaultEngine) UpsertTag(name string, v interface{}, ent *entry) error
 
 	// if tag name exists in entity, remove it from secondary index
 	// and remove it from entry itself
-	_, ok := ent.tags[name]
+	existing, ok := ent.tags[name]
 	if ok {
-		if err := ee.tags.mustRemoveEntryByNameAndValue(name, v, ent); err != nil {
+		if err := ee.tags.mustRemoveEntryByNameAndValue(name, existing.data, ent); err != nil {
 			return err
 		}
 
@@ -710,7 +698,13 @@ func (ee *defaultEngine) UpsertTag(name string, v interface{}, ent *entry) error
 	ent.tags[name] = newTag
 
 	// add to secondary index
-	return ee.tags.add(name, v, ent)
+	if err := ee.tags.add(name, v, ent); err != nil {
+		return err
+	}
+
+	ee.indexComposite(ent)
+	ee.indexUnique(ent)
+	return nil
 }
 
 // RemoveTag - removes a tag from entity and secondary index
@@ -724,6 +718,8 @@ func (ee *defaultEngine) RemoveTag(name string, ent *entry) error {
 	}
 
 	ent.tags.removeByName(name)
+	ee.indexComposite(ent)
+	ee.indexUnique(ent)
 	return nil
 }
 
@@ -745,8 +741,12 @@ func (ee *defaultEngine) Put(ent *entry, replace bool) error {
 		}
 
 		if existingEnt.tags != nil {
-			ee.clearEntityTags(ent)
+			ee.clearEntityTags(existingEnt)
 		}
+
+		ee.unindexText(existingEnt)
+		ee.unindexComposite(existingEnt)
+		ee.unindexUnique(existingEnt)
 	}
 
 	if ent.tags != nil {
@@ -755,7 +755,9 @@ func (ee *defaultEngine) Put(ent *entry, replace bool) error {
 		}
 	}
 
-	return nil
+	ee.indexComposite(ent)
+	ee.indexUnique(ent)
+	return ee.indexText(ent)
 }
 
 func (ee *defaultEngine) FlushAll(ff func(ent *entry)) error {
@@ -771,6 +773,17 @@ func (ee *defaultEngine) FlushAll(ff func(ent *entry)) error {
 
 	ee.pks = btree.NewNonConcurrent(byPrimaryKeys)
 	ee.tags = newTagIndex()
+	for _, ti := range ee.textIndexes {
+		ti.reset()
+	}
+
+	for _, ci := range ee.compositeIndexes {
+		ci.reset()
+	}
+
+	for _, ut := range ee.uniqueTags {
+		ut.reset()
+	}
 
 	if ee.cfg.ValueLoadStrategy == BufferedLoad {
 		ee.persistence.flushBuffer()
@@ -810,6 +823,8 @@ func filteringBTreeIterator(
 	q *QueryOptions,
 	ir entryIterator,
 ) func(item interface{}) bool {
+	first, _, literal, bounded := q.patternBounds()
+
 	return func(item interface{}) bool {
 		if ctx.Err() != nil {
 			return false
@@ -820,7 +835,22 @@ func filteringBTreeIterator(
 
 		}
 
-		if !ent.key.Match(q.patterns) {
+		// keys starting with literal segments of the pattern are next to each other,
+		// so the scan stops as soon as it leaves them behind
+		if bounded && !ent.key.hasSegments(literal) {
+			if q.order == DescOrder {
+				return !ent.key.Less(first)
+			}
+
+			return !first.Less(ent.key)
+		}
+
+		if !q.matchesPatterns(ent.key) {
+			return true
+		}
+
+		// scan is resumed from the cursor which itself was already returned
+		if q.after != nil && ent.key.Equal(q.after) {
 			return true
 		}
 
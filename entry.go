@@ -1,7 +1,6 @@
 package lemon
 
 import (
-	"github.com/jinzhu/copier"
 	"github.com/pkg/errors"
 )
 
@@ -23,12 +22,13 @@ type entry struct {
 }
 
 func (ent *entry) clone() *entry {
-	var cpEnt entry
-	if err := copier.Copy(&cpEnt, ent); err != nil {
-		panic("could not copy entry + " + err.Error())
+	return &entry{
+		key:       ent.key,
+		pos:       ent.pos,
+		value:     ent.value,
+		tags:      ent.tags.clone(),
+		committed: ent.committed,
 	}
-
-	return &cpEnt
 }
 
 func (ent *entry) deserialize(e executionEngine) error {
@@ -0,0 +1,26 @@
+package lemon
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEntry_clone(t *testing.T) {
+	ent := newEntryWithPosition("user:1", []byte("foo"), position{offset: 10, size: 3})
+	ent.tags = newTags()
+	require.NoError(t, ent.tags.set("active", true))
+	ent.committed = true
+
+	cp := ent.clone()
+	assert.Equal(t, "user:1", cp.key.String())
+	assert.Equal(t, position{offset: 10, size: 3}, cp.pos)
+	assert.Equal(t, []byte("foo"), cp.value)
+	assert.True(t, cp.committed)
+	require.Contains(t, cp.tags, "active")
+	assert.Equal(t, true, cp.tags["active"].data)
+
+	// tags of the copy can be replaced without affecting the original
+	require.NoError(t, cp.tags.set("active", false))
+	assert.Equal(t, true, ent.tags["active"].data)
+}
@@ -0,0 +1,115 @@
+package lemon_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDB_Explain(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		role := "user"
+		if i%20 == 1 {
+			role = "admin"
+		}
+
+		require.NoError(t, db.Insert(fmt.Sprintf("user:%03d", i), lemon.M{"id": i}, lemon.WithTags().
+			Str("role", role).
+			Bool("active", i%10 != 0).
+			Int("age", 20+i%50),
+		))
+	}
+
+	t.Run("full scan", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q())
+		require.NoError(t, err)
+		assert.Equal(t, &lemon.Explanation{
+			Strategy:      lemon.FullScan,
+			Indexes:       []string{},
+			EstimatedRows: 100,
+			ScannedRows:   100,
+			ActualRows:    100,
+		}, e)
+	})
+
+	t.Run("most selective index is intersected first", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().HasAllTags(lemon.QT().BoolTagEq("active", true).StrTagEq("role", "admin")))
+		require.NoError(t, err)
+		assert.Equal(t, lemon.TagIndexScan, e.Strategy)
+		assert.Equal(t, []string{"role", "active"}, e.Indexes)
+		assert.Equal(t, 5, e.EstimatedRows)
+		assert.Equal(t, 5, e.ActualRows)
+	})
+
+	t.Run("nothing is left to intersect with", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().HasAllTags(lemon.QT().BoolTagEq("active", true).StrTagEq("role", "guest")))
+		require.NoError(t, err)
+		assert.Equal(t, lemon.TagIndexScan, e.Strategy)
+		assert.Equal(t, []string{"role"}, e.Indexes)
+		assert.Equal(t, 0, e.EstimatedRows)
+		assert.Equal(t, 0, e.ActualRows)
+	})
+
+	t.Run("narrow key range is scanned instead of tag indexes", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().
+			KeyRange("user:010", "user:012").
+			HasAllTags(lemon.QT().BoolTagEq("active", true)))
+		require.NoError(t, err)
+		assert.Equal(t, lemon.KeyRangeScan, e.Strategy)
+		assert.Len(t, e.Indexes, 0)
+		assert.Equal(t, 3, e.EstimatedRows)
+		assert.Equal(t, 3, e.ScannedRows)
+		assert.Equal(t, 2, e.ActualRows)
+	})
+
+	t.Run("wide key range is narrowed down by tag indexes", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().
+			KeyRange("user:000", "user:090").
+			HasAllTags(lemon.QT().StrTagEq("role", "admin")))
+		require.NoError(t, err)
+		assert.Equal(t, lemon.TagIndexScan, e.Strategy)
+		assert.Equal(t, []string{"role"}, e.Indexes)
+		assert.Equal(t, 5, e.EstimatedRows)
+		assert.Equal(t, 5, e.ActualRows)
+	})
+
+	t.Run("tags matching most documents are checked while scanning", func(t *testing.T) {
+		qo := lemon.Q().HasAllTags(lemon.Not(lemon.QT().StrTagEq("role", "admin")))
+		e, err := db.Explain(qo)
+		require.NoError(t, err)
+		assert.Equal(t, lemon.FullScan, e.Strategy)
+		assert.Equal(t, 100, e.ScannedRows)
+		assert.Equal(t, 95, e.ActualRows)
+
+		docs, err := db.Find(qo)
+		require.NoError(t, err)
+		assert.Len(t, docs, 95)
+	})
+
+	t.Run("tag name scan", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().ByTagName("age").Limit(10))
+		require.NoError(t, err)
+		assert.Equal(t, lemon.TagNameScan, e.Strategy)
+		assert.Equal(t, []string{"age"}, e.Indexes)
+		assert.Equal(t, 100, e.EstimatedRows)
+		assert.Equal(t, 10, e.ActualRows)
+	})
+
+	t.Run("invalid tag type", func(t *testing.T) {
+		_, err := db.Explain(lemon.Q().HasAllTags(lemon.QT().StrTagEq("age", "old")))
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrInvalidTagType))
+	})
+}
@@ -0,0 +1,143 @@
+package lemon
+
+import (
+	"sort"
+)
+
+// TagValue - a distinct value of a tag and the number of documents that have it
+type TagValue struct {
+	Value interface{}
+	Count int
+}
+
+// filtersOnlyKeys - query options restrict nothing but primary keys
+func (qo *QueryOptions) filtersOnlyKeys() bool {
+	return (qo.tags == nil || qo.tags.empty()) &&
+		qo.byTagName == "" &&
+		qo.text == nil &&
+		len(qo.where) == 0 &&
+		qo.limit == 0 &&
+		qo.offset == 0 &&
+		qo.after == nil
+}
+
+// TagValues - distinct values of a tag in index order with counts of documents,
+// query options can restrict documents by key prefix, range or pattern,
+// any other options make values to be counted from matched documents the same way as Facets does
+func (x *Tx) TagValues(name string, qo *QueryOptions) ([]TagValue, error) {
+	if qo == nil {
+		qo = Q()
+	}
+
+	if err := qo.Validate(); err != nil {
+		return nil, err
+	}
+
+	if !qo.filtersOnlyKeys() {
+		facets, err := x.Facets(qo, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return facets[name], nil
+	}
+
+	now := x.ee.Now()
+
+	return x.ee.TagValues(name, func(ent *entry) bool {
+		return !ent.expired(now) && qo.matchesKey(ent.key)
+	})
+}
+
+// Facets - distinct values of every given tag among documents matched by query options
+// with counts of documents, values are ordered the same way as in tag indexes
+func (x *Tx) Facets(qo *QueryOptions, tagNames ...string) (map[string][]TagValue, error) {
+	counts := make(map[string]map[interface{}]int, len(tagNames))
+	for _, name := range tagNames {
+		counts[name] = make(map[interface{}]int)
+	}
+
+	ir := func(ent *entry) bool {
+		for name, values := range counts {
+			if t, ok := ent.tags[name]; ok {
+				values[t.data]++
+			}
+		}
+
+		return true
+	}
+
+	if err := x.applyScanner(x.ctx, qo, ir); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]TagValue, len(counts))
+	for name, values := range counts {
+		tvs := make([]TagValue, 0, len(values))
+		for v, count := range values {
+			tvs = append(tvs, TagValue{Value: v, Count: count})
+		}
+
+		sort.Slice(tvs, func(i, j int) bool {
+			return lessTagValues(tvs[i].Value, tvs[j].Value)
+		})
+
+		result[name] = tvs
+	}
+
+	return result, nil
+}
+
+// TagValues - walks the index of a tag in order and counts accepted entries of every value,
+// values without accepted entries are skipped
+func (ee *defaultEngine) TagValues(name string, accept func(ent *entry) bool) ([]TagValue, error) {
+	if ee.closed {
+		return nil, ErrDatabaseAlreadyClosed
+	}
+
+	result := make([]TagValue, 0)
+
+	idx, ok := ee.tags.data[name]
+	if !ok {
+		return result, nil
+	}
+
+	idx.btr.Ascend(nil, func(item interface{}) bool {
+		container := item.(entryContainer)
+
+		count := 0
+		for _, ent := range container.getEntries() {
+			if accept(ent) {
+				count++
+			}
+		}
+
+		if count > 0 {
+			result = append(result, TagValue{Value: container.getValue(), Count: count})
+		}
+
+		return true
+	})
+
+	return result, nil
+}
+
+// lessTagValues - orders values of the same tag the way tag indexes do
+func lessTagValues(a, b interface{}) bool {
+	switch typedA := a.(type) {
+	case int:
+		typedB, ok := b.(int)
+		return ok && typedA < typedB
+	case float64:
+		typedB, ok := b.(float64)
+		return ok && typedA < typedB
+	case string:
+		typedB, ok := b.(string)
+		return ok && typedA < typedB
+	case bool:
+		typedB, ok := b.(bool)
+		return ok && !typedA && typedB
+	}
+
+	return false
+}
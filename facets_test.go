@@ -0,0 +1,103 @@
+package lemon_test
+
+import (
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDB_TagValuesAndFacets(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	products := []struct {
+		key   string
+		color string
+		size  int
+		sale  bool
+	}{
+		{key: "product:shoes:1", color: "red", size: 42, sale: true},
+		{key: "product:shoes:2", color: "black", size: 42, sale: false},
+		{key: "product:shoes:3", color: "red", size: 44, sale: false},
+		{key: "product:shirts:4", color: "white", size: 2, sale: true},
+		{key: "product:shirts:5", color: "red", size: 3, sale: true},
+		{key: "product:shirts:6", color: "black", size: 3, sale: false},
+	}
+
+	for _, p := range products {
+		require.NoError(t, db.Insert(p.key, lemon.M{"color": p.color}, lemon.WithTags().
+			Str("color", p.color).
+			Int("size", p.size).
+			Bool("sale", p.sale),
+		))
+	}
+
+	t.Run("distinct values of a tag", func(t *testing.T) {
+		values, err := db.TagValues("color")
+		require.NoError(t, err)
+		assert.Equal(t, []lemon.TagValue{
+			{Value: "black", Count: 2},
+			{Value: "red", Count: 3},
+			{Value: "white", Count: 1},
+		}, values)
+
+		values, err = db.TagValues("size")
+		require.NoError(t, err)
+		assert.Equal(t, []lemon.TagValue{
+			{Value: 2, Count: 1},
+			{Value: 3, Count: 2},
+			{Value: 42, Count: 2},
+			{Value: 44, Count: 1},
+		}, values)
+	})
+
+	t.Run("distinct values restricted by keys", func(t *testing.T) {
+		values, err := db.TagValues("color", lemon.Q().Match("product:shirts:*"))
+		require.NoError(t, err)
+		assert.Equal(t, []lemon.TagValue{
+			{Value: "black", Count: 1},
+			{Value: "red", Count: 1},
+			{Value: "white", Count: 1},
+		}, values)
+
+		values, err = db.TagValues("size", lemon.Q().KeyRange("product:shoes:2", "product:shoes:3"))
+		require.NoError(t, err)
+		assert.Equal(t, []lemon.TagValue{{Value: 42, Count: 1}, {Value: 44, Count: 1}}, values)
+	})
+
+	t.Run("distinct values restricted by tags", func(t *testing.T) {
+		values, err := db.TagValues("sale", lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "red")))
+		require.NoError(t, err)
+		assert.Equal(t, []lemon.TagValue{{Value: false, Count: 1}, {Value: true, Count: 2}}, values)
+	})
+
+	t.Run("unknown tag has no values", func(t *testing.T) {
+		values, err := db.TagValues("brand")
+		require.NoError(t, err)
+		assert.Len(t, values, 0)
+	})
+
+	t.Run("facets", func(t *testing.T) {
+		facets, err := db.Facets(lemon.Q().HasAllTags(lemon.QT().BoolTagEq("sale", true)), "color", "size", "brand")
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string][]lemon.TagValue{
+			"color": {{Value: "red", Count: 2}, {Value: "white", Count: 1}},
+			"size":  {{Value: 2, Count: 1}, {Value: 3, Count: 1}, {Value: 42, Count: 1}},
+			"brand": {},
+		}, facets)
+	})
+
+	t.Run("facets of documents matched by prefix", func(t *testing.T) {
+		facets, err := db.Facets(lemon.Q().Match("product:shoes:*"), "sale")
+		require.NoError(t, err)
+		assert.Equal(t, []lemon.TagValue{{Value: false, Count: 2}, {Value: true, Count: 1}}, facets["sale"])
+	})
+}
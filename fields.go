@@ -0,0 +1,383 @@
+package lemon
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"math"
+	"sort"
+)
+
+var ErrIndexAlreadyExists = errors.New("index already exists")
+var ErrIndexNotFound = errors.New("index not found")
+
+// JSONPath - path to a field inside JSON documents, has the same syntax as JSONValue getters
+type JSONPath string
+
+// FieldIndexType - type of values extracted from JSON documents into a field index
+type FieldIndexType uint8
+
+const (
+	IntIndex FieldIndexType = iota + 1
+	FloatIndex
+	StrIndex
+	BoolIndex
+)
+
+func (t FieldIndexType) String() string {
+	switch t {
+	case IntIndex:
+		return "int"
+	case FloatIndex:
+		return "float"
+	case StrIndex:
+		return "str"
+	case BoolIndex:
+		return "bool"
+	}
+
+	return "unknown"
+}
+
+func parseFieldIndexType(s string) (FieldIndexType, error) {
+	for _, t := range []FieldIndexType{IntIndex, FloatIndex, StrIndex, BoolIndex} {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+
+	return 0, errors.Wrapf(ErrInvalidIndexType, "%s", s)
+}
+
+// fieldIndex - definition of an index maintained from a field of JSON documents,
+// extracted values are stored as regular tags under the index name
+type fieldIndex struct {
+	name string
+	path JSONPath
+	ft   FieldIndexType
+}
+
+// extract - value of the field converted to the index type,
+// false is returned when the field is missing or has a different type
+func (fi *fieldIndex) extract(v []byte) (interface{}, bool) {
+	res := gjson.GetBytes(v, string(fi.path))
+	if !res.Exists() {
+		return nil, false
+	}
+
+	switch fi.ft {
+	case IntIndex:
+		if res.Type != gjson.Number || res.Num != math.Trunc(res.Num) {
+			return nil, false
+		}
+
+		return int(res.Num), true
+	case FloatIndex:
+		if res.Type != gjson.Number {
+			return nil, false
+		}
+
+		return res.Num, true
+	case StrIndex:
+		if res.Type != gjson.String {
+			return nil, false
+		}
+
+		return res.Str, true
+	case BoolIndex:
+		if res.Type != gjson.True && res.Type != gjson.False {
+			return nil, false
+		}
+
+		return res.Bool(), true
+	}
+
+	return nil, false
+}
+
+func (fi *fieldIndex) serialize(rs *respSerializer) error {
+	return rs.serializeIndexCommand(fi)
+}
+
+func (fi *fieldIndex) deserialize(e executionEngine) error {
+	return e.DefineIndex(fi)
+}
+
+type dropIndexCmd struct {
+	name string
+}
+
+func (cmd *dropIndexCmd) serialize(rs *respSerializer) error {
+	return rs.serializeDropIndexCommand(cmd)
+}
+
+func (cmd *dropIndexCmd) deserialize(e executionEngine) error {
+	return e.UndefineIndex(cmd.name)
+}
+
+// CreateIndex - defines an index on a field of JSON documents and backfills it from existing documents,
+// from now on the field is extracted on every insert and replace, the definition is persisted
+// so the index is maintained after the database is reopened
+func (ee *defaultEngine) CreateIndex(name string, path JSONPath, ft FieldIndexType) error {
+	ee.Lock()
+	defer ee.Unlock()
+
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if name == "" || path == "" {
+		return errors.Wrap(ErrInvalidIndexType, "index name and path cannot be empty")
+	}
+
+	if _, err := parseFieldIndexType(ft.String()); err != nil {
+		return err
+	}
+
+	if _, ok := ee.fieldIndexes[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "%s", name)
+	}
+
+	if _, ok := ee.textIndexes[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "%s", name)
+	}
+
+	if _, ok := ee.compositeIndexes[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "%s", name)
+	}
+
+	if _, ok := ee.tags.data[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "tag %s is already in use", name)
+	}
+
+	fi := &fieldIndex{name: name, path: path, ft: ft}
+	commands := []serializable{fi}
+
+	var backfilled []*entry
+	var values []interface{}
+	var loadErr error
+
+	ee.pks.Ascend(nil, func(item interface{}) bool {
+		ent := item.(*entry)
+		if !isJSONEntry(ent) {
+			return true
+		}
+
+		v, ok, err := ee.extractField(fi, ent)
+		if err != nil {
+			loadErr = err
+			return false
+		}
+
+		if ok {
+			tgs := newTags()
+			if err := tgs.set(name, v); err != nil {
+				loadErr = err
+				return false
+			}
+
+			commands = append(commands, &tagCmd{key: ent.key, tags: tgs})
+			backfilled = append(backfilled, ent)
+			values = append(values, v)
+		}
+
+		return true
+	})
+
+	if loadErr != nil {
+		return errors.Wrapf(loadErr, "could not backfill index %s", name)
+	}
+
+	if err := ee.Persist(commands); err != nil {
+		return err
+	}
+
+	ee.fieldIndexes[name] = fi
+
+	for i, ent := range backfilled {
+		if err := ee.UpsertTag(name, values[i], ent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DropIndex - removes a field index definition along with values extracted into it,
+// a text or a composite index
+func (ee *defaultEngine) DropIndex(name string) error {
+	ee.Lock()
+	defer ee.Unlock()
+
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if !ee.indexExists(name) {
+		return errors.Wrapf(ErrIndexNotFound, "%s", name)
+	}
+
+	if err := ee.Persist([]serializable{&dropIndexCmd{name: name}}); err != nil {
+		return err
+	}
+
+	return ee.UndefineIndex(name)
+}
+
+// DefineIndex - registers a field index without backfilling it,
+// values of already existing documents are restored from the log
+func (ee *defaultEngine) DefineIndex(fi *fieldIndex) error {
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	ee.fieldIndexes[fi.name] = fi
+	return nil
+}
+
+// UndefineIndex - forgets a field index and removes its values from entries,
+// text and composite indexes are just forgotten
+func (ee *defaultEngine) UndefineIndex(name string) error {
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if _, ok := ee.textIndexes[name]; ok {
+		delete(ee.textIndexes, name)
+		return nil
+	}
+
+	if _, ok := ee.compositeIndexes[name]; ok {
+		delete(ee.compositeIndexes, name)
+		return nil
+	}
+
+	delete(ee.fieldIndexes, name)
+
+	idx, ok := ee.tags.data[name]
+	if !ok {
+		return nil
+	}
+
+	idx.btr.Ascend(nil, func(item interface{}) bool {
+		for _, ent := range item.(entryContainer).getEntries() {
+			ent.tags.removeByName(name)
+		}
+
+		return true
+	})
+
+	delete(ee.tags.data, name)
+	ee.rebuildCompositeIndexesOf(name)
+
+	return nil
+}
+
+// IndexFields - extracts fields of a JSON document into tags
+// of the field indexes, must be called before the entry is put into the database
+func (ee *defaultEngine) IndexFields(ent *entry) error {
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if len(ee.fieldIndexes) == 0 {
+		return nil
+	}
+
+	if ent.tags == nil {
+		ent.tags = newTags()
+	}
+
+	jsonEntry := isJSONEntry(ent)
+
+	for name, fi := range ee.fieldIndexes {
+		ent.tags.removeByName(name)
+
+		if !jsonEntry {
+			continue
+		}
+
+		v, ok, err := ee.extractField(fi, ent)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			if err := ent.tags.set(name, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (ee *defaultEngine) extractField(fi *fieldIndex, ent *entry) (interface{}, bool, error) {
+	if ent.value != nil {
+		v, ok := fi.extract(ent.value)
+		return v, ok, nil
+	}
+
+	if err := ee.LoadEntryValue(ent); err != nil {
+		return nil, false, err
+	}
+
+	v, ok := fi.extract(ent.value)
+
+	// values of lazily loaded entries should not stay in memory
+	if ee.cfg.ValueLoadStrategy != EagerLoad {
+		ent.value = nil
+	}
+
+	return v, ok, nil
+}
+
+// serializeIndexDefinitions - field, text and composite index definitions and unique tags must precede
+// documents in the log, so that they are defined when the log is replayed
+func (ee *defaultEngine) serializeIndexDefinitions(rs *respSerializer) error {
+	definitions := make(map[string]serializable, len(ee.fieldIndexes)+len(ee.textIndexes)+len(ee.compositeIndexes))
+	names := make([]string, 0, len(definitions))
+
+	for name, fi := range ee.fieldIndexes {
+		definitions[name] = fi
+		names = append(names, name)
+	}
+
+	for name, ti := range ee.textIndexes {
+		definitions[name] = ti
+		names = append(names, name)
+	}
+
+	for name, ci := range ee.compositeIndexes {
+		definitions[name] = ci
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := definitions[name].serialize(rs); err != nil {
+			return err
+		}
+	}
+
+	// unique tags are named after tags, so they may share names with indexes
+	names = names[:0]
+	for name := range ee.uniqueTags {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := ee.uniqueTags[name].serialize(rs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isJSONEntry(ent *entry) bool {
+	ct, ok := ent.tags[ContentType]
+	return ok && ct.data == string(JSON)
+}
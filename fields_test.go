@@ -0,0 +1,167 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDB_CreateIndex(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("user:1", lemon.M{"user": lemon.M{"age": 30, "city": "Budapest"}}))
+	require.NoError(t, db.Insert("user:2", lemon.M{"user": lemon.M{"age": 41, "city": "Vienna"}}))
+	require.NoError(t, db.Insert("user:3", lemon.M{"user": lemon.M{"age": "unknown"}}))
+	require.NoError(t, db.Insert("user:4", "not a JSON document"))
+
+	require.NoError(t, db.CreateIndex("age", lemon.JSONPath("user.age"), lemon.IntIndex))
+	require.NoError(t, db.CreateIndex("city", lemon.JSONPath("user.city"), lemon.StrIndex))
+
+	findKeys := func(qt *lemon.QueryTags) []string {
+		docs, err := db.Find(lemon.Q().HasAllTags(qt))
+		require.NoError(t, err)
+		return keysOf(docs)
+	}
+
+	t.Run("existing documents are backfilled", func(t *testing.T) {
+		assert.Equal(t, []string{"user:1", "user:2"}, findKeys(lemon.QT().IntTagGte("age", 30)))
+		assert.Equal(t, []string{"user:2"}, findKeys(lemon.QT().StrTagEq("city", "Vienna")))
+
+		doc, err := db.Get("user:1")
+		require.NoError(t, err)
+		assert.Equal(t, 30, doc.Tags()["age"])
+	})
+
+	t.Run("inserted documents are indexed", func(t *testing.T) {
+		require.NoError(t, db.Insert("user:5", lemon.M{"user": lemon.M{"age": 19, "city": "Vienna"}}))
+		assert.Equal(t, []string{"user:5"}, findKeys(lemon.QT().IntTagLt("age", 30)))
+	})
+
+	t.Run("replaced documents are reindexed", func(t *testing.T) {
+		require.NoError(t, db.InsertOrReplace("user:5", lemon.M{"user": lemon.M{"age": 55}}))
+		assert.Equal(t, []string{"user:5"}, findKeys(lemon.QT().IntTagGt("age", 50)))
+		assert.Equal(t, []string{"user:2"}, findKeys(lemon.QT().StrTagEq("city", "Vienna")))
+	})
+
+	t.Run("patched documents are reindexed", func(t *testing.T) {
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.SetPath("user:3", "user.age", 25)
+		}))
+
+		assert.Equal(t, []string{"user:3"}, findKeys(lemon.QT().IntTagEq("age", 25)))
+	})
+
+	t.Run("rolled back changes do not reach the index", func(t *testing.T) {
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.InsertOrReplace("user:1", lemon.M{"user": lemon.M{"age": 99}}); err != nil {
+				return err
+			}
+
+			return errors.New("abort")
+		})
+
+		require.Error(t, err)
+		assert.Equal(t, []string{}, findKeys(lemon.QT().IntTagEq("age", 99)))
+		assert.Equal(t, []string{"user:1"}, findKeys(lemon.QT().IntTagEq("age", 30)))
+	})
+
+	t.Run("index name must be unique", func(t *testing.T) {
+		err := db.CreateIndex("age", lemon.JSONPath("age"), lemon.IntIndex)
+		assert.True(t, errors.Is(err, lemon.ErrIndexAlreadyExists))
+
+		require.NoError(t, db.Insert("tagged:1", lemon.M{}, lemon.WithTags().Bool("vip", true)))
+		err = db.CreateIndex("vip", lemon.JSONPath("vip"), lemon.BoolIndex)
+		assert.True(t, errors.Is(err, lemon.ErrIndexAlreadyExists))
+	})
+
+	t.Run("drop index", func(t *testing.T) {
+		require.NoError(t, db.DropIndex("city"))
+
+		_, err := db.Find(lemon.Q().HasAllTags(lemon.QT().StrTagEq("city", "Budapest")))
+		require.NoError(t, err)
+
+		doc, err := db.Get("user:1")
+		require.NoError(t, err)
+		assert.Equal(t, lemon.M{"age": 30}, doc.Tags())
+
+		require.NoError(t, db.Insert("user:6", lemon.M{"user": lemon.M{"age": 20, "city": "Budapest"}}))
+		doc, err = db.Get("user:6")
+		require.NoError(t, err)
+		assert.Equal(t, lemon.M{"age": 20}, doc.Tags())
+
+		assert.True(t, errors.Is(db.DropIndex("city"), lemon.ErrIndexNotFound))
+	})
+}
+
+func TestDB_CreateIndex_Persistence(t *testing.T) {
+	for _, vls := range []lemon.ValueLoadStrategy{lemon.EagerLoad, lemon.LazyLoad} {
+		t.Run(string(vls), func(t *testing.T) {
+			fixture := fmt.Sprintf("./__fixtures__/fields_%s_db1.ldb", vls)
+			_ = os.Remove(fixture)
+
+			defer func() {
+				if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+					t.Errorf("ERROR: %v", err)
+				}
+			}()
+
+			open := func(disableVacuum bool) (*lemon.DB, lemon.Closer) {
+				db, closer, err := lemon.Open(fixture, &lemon.Config{
+					DisableAutoVacuum:   disableVacuum,
+					PersistenceStrategy: lemon.Sync,
+					ValueLoadStrategy:   vls,
+				})
+
+				require.NoError(t, err)
+				return db, closer
+			}
+
+			db, closer := open(true)
+			for i := 1; i <= 10; i++ {
+				require.NoError(t, db.Insert(fmt.Sprintf("product:%d", i), lemon.M{"price": float64(i) + 0.5}))
+			}
+
+			require.NoError(t, db.CreateIndex("price", lemon.JSONPath("price"), lemon.FloatIndex))
+			require.NoError(t, db.Insert("product:11", lemon.M{"price": 11.5}))
+			require.NoError(t, closer())
+
+			// definitions and values are restored from the log
+			db, closer = open(false)
+			docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().FloatTagGt("price", 8)))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"product:8", "product:9", "product:10", "product:11"}, keysOf(docs))
+
+			require.NoError(t, db.Insert("product:12", lemon.M{"price": 0.1}))
+			require.NoError(t, closer())
+
+			// and survive the log being compacted by vacuum on close
+			db, closer = open(true)
+			defer func() {
+				require.NoError(t, closer())
+			}()
+
+			docs, err = db.Find(lemon.Q().HasAllTags(lemon.QT().FloatTagLt("price", 2)))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"product:1", "product:12"}, keysOf(docs))
+
+			require.NoError(t, db.DropIndex("price"))
+			require.NoError(t, db.InsertOrReplace("product:12", lemon.M{"price": 0.2}))
+
+			doc, err := db.Get("product:12")
+			require.NoError(t, err)
+			assert.Equal(t, lemon.M{}, doc.Tags())
+		})
+	}
+}
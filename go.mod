@@ -5,12 +5,12 @@ go 1.17
 require (
 	github.com/cespare/xxhash/v2 v2.1.2
 	github.com/denismitr/glog v0.2.0
-	github.com/jinzhu/copier v0.3.2
 	github.com/pbnjay/memory v0.0.0-20210728143218-7b4eea64cf58
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.3.0
 	github.com/tidwall/btree v0.6.0
 	github.com/tidwall/gjson v1.8.0
+	github.com/tidwall/sjson v1.1.7
 )
 
 require (
@@ -0,0 +1,90 @@
+package lemon
+
+// BeforeCommitHook is called with a still open write transaction right before
+// its commands are persisted, returning an error aborts the commit and rolls back the transaction
+type BeforeCommitHook func(tx *Tx) error
+
+// AfterCommitHook is called with all the keys changed by a write transaction
+// once the transaction was successfully committed and persisted
+type AfterCommitHook func(changes []Change)
+
+// Change describes a key that was inserted, updated, tagged, untagged or removed by a transaction
+// OldTags are nil when the key was created by the transaction and NewTags are nil
+// when the key was removed by the transaction
+type Change struct {
+	Key     string
+	OldTags M
+	NewTags M
+}
+
+// IsInsert - key did not exist before the transaction
+func (c Change) IsInsert() bool {
+	return c.OldTags == nil
+}
+
+// IsRemove - key does not exist after the transaction
+func (c Change) IsRemove() bool {
+	return c.NewTags == nil
+}
+
+type changeTracker struct {
+	keys    []string
+	oldTags map[string]M
+}
+
+// OnCommit registers a callback that will be called once the transaction
+// is committed and all the changes are persisted, after the database lock is released
+func (x *Tx) OnCommit(fn func()) {
+	x.onCommit = append(x.onCommit, fn)
+}
+
+// OnRollback registers a callback that will be called once the transaction
+// is rolled back, after the database lock is released
+func (x *Tx) OnRollback(fn func()) {
+	x.onRollback = append(x.onRollback, fn)
+}
+
+// Changes - returns keys changed by the transaction so far with their
+// tags before the transaction and current tags
+func (x *Tx) Changes() []Change {
+	if x.ee == nil || x.changes == nil {
+		return nil
+	}
+
+	result := make([]Change, 0, len(x.changes.keys))
+	for _, k := range x.changes.keys {
+		c := Change{Key: k, OldTags: x.changes.oldTags[k]}
+
+		if ent, err := x.ee.FindByKey(k); err == nil {
+			c.NewTags, _ = createMapFromTags(ent.tags)
+		}
+
+		// key was created and removed within the same transaction
+		if c.OldTags == nil && c.NewTags == nil {
+			continue
+		}
+
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// touch - remembers the state of the key tags before it is first changed
+// by the transaction, existing is nil if the key is being created
+func (x *Tx) touch(key string, existing *entry) {
+	if x.changes == nil {
+		x.changes = &changeTracker{oldTags: make(map[string]M)}
+	}
+
+	if _, ok := x.changes.oldTags[key]; ok {
+		return
+	}
+
+	x.changes.keys = append(x.changes.keys, key)
+	if existing == nil {
+		x.changes.oldTags[key] = nil
+	} else {
+		x.changes.oldTags[key], _ = createMapFromTags(existing.tags)
+	}
+}
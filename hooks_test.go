@@ -0,0 +1,175 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTx_OnCommitAndOnRollback(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	t.Run("on commit callbacks are called after commit", func(t *testing.T) {
+		var committed, rolledBack int
+
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			tx.OnCommit(func() {
+				committed++
+				// lock must already be released
+				assert.True(t, db.Has("user:1"))
+			})
+
+			tx.OnRollback(func() { rolledBack++ })
+
+			if err := tx.Insert("user:1", lemon.M{"foo": "bar"}); err != nil {
+				return err
+			}
+
+			assert.Equal(t, 0, committed)
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, committed)
+		assert.Equal(t, 0, rolledBack)
+	})
+
+	t.Run("on rollback callbacks are called after rollback", func(t *testing.T) {
+		var committed, rolledBack int
+
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			tx.OnCommit(func() { committed++ })
+			tx.OnRollback(func() {
+				rolledBack++
+				assert.False(t, db.Has("user:2"))
+			})
+
+			if err := tx.Insert("user:2", lemon.M{"foo": "bar"}); err != nil {
+				return err
+			}
+
+			return errors.New("should roll back")
+		})
+
+		require.Error(t, err)
+		assert.Equal(t, 0, committed)
+		assert.Equal(t, 1, rolledBack)
+	})
+}
+
+func TestDB_CommitHooks(t *testing.T) {
+	var changes []lemon.Change
+	var rejectCommit bool
+
+	db, closer, err := lemon.Open(lemon.InMemory, &lemon.Config{
+		BeforeCommit: func(tx *lemon.Tx) error {
+			if rejectCommit {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+		AfterCommit: func(c []lemon.Change) {
+			changes = c
+		},
+	})
+
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+		if err := tx.Insert("product:1", lemon.M{"foo": 1}, lemon.WithTags().Str("city", "Budapest")); err != nil {
+			return err
+		}
+
+		if err := tx.Insert("product:2", lemon.M{"foo": 2}); err != nil {
+			return err
+		}
+
+		return tx.Insert("product:3", lemon.M{"foo": 3}, lemon.WithTags().Int("price", 100))
+	}))
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, "product:1", changes[0].Key)
+	assert.True(t, changes[0].IsInsert())
+	assert.Nil(t, changes[0].OldTags)
+	assert.Equal(t, lemon.M{"city": "Budapest"}, changes[0].NewTags)
+
+	t.Run("after commit receives old and new tags", func(t *testing.T) {
+		changes = nil
+
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.Tag("product:1", lemon.M{"city": "Vienna"}); err != nil {
+				return err
+			}
+
+			if err := tx.InsertOrReplace("product:2", lemon.M{"foo": 22}, lemon.M{"active": true}); err != nil {
+				return err
+			}
+
+			return tx.Remove("product:3")
+		}))
+
+		require.Len(t, changes, 3)
+		assert.Equal(t, lemon.Change{
+			Key:     "product:1",
+			OldTags: lemon.M{"city": "Budapest"},
+			NewTags: lemon.M{"city": "Vienna"},
+		}, changes[0])
+
+		assert.Equal(t, lemon.Change{
+			Key:     "product:2",
+			OldTags: lemon.M{},
+			NewTags: lemon.M{"active": true},
+		}, changes[1])
+
+		assert.Equal(t, "product:3", changes[2].Key)
+		assert.True(t, changes[2].IsRemove())
+		assert.Equal(t, lemon.M{"price": 100}, changes[2].OldTags)
+	})
+
+	t.Run("key created and removed in one tx is not reported", func(t *testing.T) {
+		changes = nil
+
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.Insert("product:4", lemon.M{"foo": 4}); err != nil {
+				return err
+			}
+
+			return tx.Remove("product:4")
+		}))
+
+		assert.Nil(t, changes)
+	})
+
+	t.Run("before commit error rolls back the transaction", func(t *testing.T) {
+		changes = nil
+		rejectCommit = true
+		defer func() { rejectCommit = false }()
+
+		var rolledBack bool
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			tx.OnRollback(func() { rolledBack = true })
+			return tx.Insert("product:5", lemon.M{"foo": 5})
+		})
+
+		require.Error(t, err)
+		assert.True(t, rolledBack)
+		assert.Nil(t, changes)
+		assert.False(t, db.Has("product:5"))
+	})
+}
@@ -0,0 +1,251 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTx_Incr(t *testing.T) {
+	suite.Run(t, &incrTestSuite{})
+}
+
+type incrTestSuite struct {
+	suite.Suite
+	fixture string
+}
+
+func (its *incrTestSuite) SetupTest() {
+	its.fixture = "./__fixtures__/incr_db1.ldb"
+	_ = os.Remove(its.fixture)
+}
+
+func (its *incrTestSuite) TearDownTest() {
+	if err := os.Remove(its.fixture); err != nil && !os.IsNotExist(err) {
+		its.Require().NoError(err)
+	}
+}
+
+func (its *incrTestSuite) open(vls lemon.ValueLoadStrategy) (*lemon.DB, lemon.Closer) {
+	db, closer, err := lemon.Open(its.fixture, &lemon.Config{
+		DisableAutoVacuum:   true,
+		PersistenceStrategy: lemon.Sync,
+		ValueLoadStrategy:   vls,
+	})
+
+	its.Require().NoError(err)
+
+	return db, closer
+}
+
+func (its *incrTestSuite) TestIncrCreatesAndIncrementsIntegerDocument() {
+	for _, vls := range []lemon.ValueLoadStrategy{lemon.EagerLoad, lemon.LazyLoad} {
+		db, closer := its.open(vls)
+
+		v, err := db.IncrBy("views:1", 5)
+		its.Require().NoError(err)
+		its.Assert().Equal(5, v)
+
+		its.Require().NoError(db.Update(context.Background(), func(tx *lemon.Tx) error {
+			for i := 0; i < 10; i++ {
+				if _, err := tx.Incr("views:1", 1); err != nil {
+					return err
+				}
+			}
+
+			v, err := tx.Incr("views:2", -3)
+			its.Require().NoError(err)
+			its.Assert().Equal(-3, v)
+
+			return nil
+		}))
+
+		doc, err := db.Get("views:1")
+		its.Require().NoError(err)
+		its.Assert().True(doc.IsInteger())
+		its.Assert().Equal(15, doc.IntegerValue())
+
+		its.Require().NoError(closer())
+
+		db, closer = its.open(vls)
+
+		doc, err = db.Get("views:1")
+		its.Require().NoError(err)
+		its.Assert().Equal(15, doc.IntegerValue())
+
+		doc, err = db.Get("views:2")
+		its.Require().NoError(err)
+		its.Assert().Equal(-3, doc.IntegerValue())
+
+		v, err = db.IncrBy("views:1", 100)
+		its.Require().NoError(err)
+		its.Assert().Equal(115, v)
+
+		its.Require().NoError(closer())
+		its.Require().NoError(os.Remove(its.fixture))
+	}
+}
+
+func (its *incrTestSuite) TestIncrIsWrittenAsCompactCommand() {
+	db, closer := its.open(lemon.EagerLoad)
+
+	its.Require().NoError(db.Insert("counter:1", 0, lemon.WithTags().Str("kind", "views")))
+
+	for i := 0; i < 3; i++ {
+		_, err := db.IncrBy("counter:1", 2)
+		its.Require().NoError(err)
+	}
+
+	its.Require().NoError(closer())
+
+	contents := string(loadFixtureContents(its.T(), its.fixture))
+	its.Assert().Equal(1, strings.Count(contents, "+set"))
+	its.Assert().Equal(3, strings.Count(contents, "+incr"))
+	its.Assert().Equal(1, strings.Count(contents, "kind"))
+
+	db, closer = its.open(lemon.EagerLoad)
+	defer func() {
+		its.Require().NoError(closer())
+	}()
+
+	doc, err := db.Get("counter:1")
+	its.Require().NoError(err)
+	its.Assert().Equal(6, doc.IntegerValue())
+	its.Assert().Equal(lemon.M{"kind": "views"}, doc.Tags())
+}
+
+func (its *incrTestSuite) TestIncrRejectsNonIntegerDocuments() {
+	db, closer := its.open(lemon.EagerLoad)
+	defer func() {
+		its.Require().NoError(closer())
+	}()
+
+	its.Require().NoError(db.Insert("user:1", lemon.M{"foo": "bar"}))
+
+	_, err := db.IncrBy("user:1", 1)
+	its.Require().Error(err)
+	its.Assert().True(errors.Is(err, lemon.ErrInvalidContentType))
+}
+
+func (its *incrTestSuite) TestIncrRollback() {
+	db, closer := its.open(lemon.EagerLoad)
+	defer func() {
+		its.Require().NoError(closer())
+	}()
+
+	its.Require().NoError(db.Insert("counter:1", 10))
+
+	err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+		if _, err := tx.Incr("counter:1", 5); err != nil {
+			return err
+		}
+
+		if _, err := tx.Incr("counter:2", 5); err != nil {
+			return err
+		}
+
+		return errors.New("should roll back")
+	})
+
+	its.Require().Error(err)
+
+	doc, err := db.Get("counter:1")
+	its.Require().NoError(err)
+	its.Assert().Equal(10, doc.IntegerValue())
+	its.Assert().False(db.Has("counter:2"))
+}
+
+func TestTx_IncrTag(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("post:1", lemon.M{"title": "foo"}, lemon.WithTags().Int("views", 10).Float("score", 1.5)))
+	require.NoError(t, db.Insert("post:2", lemon.M{"title": "bar"}, lemon.WithTags().Int("views", 10)))
+
+	t.Run("int and float tags are incremented and indexed", func(t *testing.T) {
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.IncrTag("post:1", "views", 5); err != nil {
+				return err
+			}
+
+			if err := tx.IncrTag("post:1", "score", 0.25); err != nil {
+				return err
+			}
+
+			return tx.IncrTag("post:2", "likes", 1)
+		}))
+
+		doc, err := db.Get("post:1")
+		require.NoError(t, err)
+		assert.Equal(t, lemon.M{"views": 15, "score": 1.75}, doc.Tags())
+
+		docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagEq("views", 15)))
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "post:1", docs[0].Key())
+
+		docs, err = db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagEq("views", 10)))
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "post:2", docs[0].Key())
+
+		doc, err = db.Get("post:2")
+		require.NoError(t, err)
+		assert.Equal(t, lemon.M{"views": 10, "likes": 1}, doc.Tags())
+	})
+
+	t.Run("float delta cannot be added to int tag", func(t *testing.T) {
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.IncrTag("post:1", "views", 0.5)
+		})
+
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrInvalidTagType))
+	})
+
+	t.Run("rollback restores previous tag value", func(t *testing.T) {
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.IncrTag("post:2", "views", 90); err != nil {
+				return err
+			}
+
+			return errors.New("should roll back")
+		})
+
+		require.Error(t, err)
+
+		doc, err := db.Get("post:2")
+		require.NoError(t, err)
+		assert.Equal(t, 10, doc.Tags().Int("views"))
+
+		docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagEq("views", 10)))
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "post:2", docs[0].Key())
+	})
+	t.Run("transaction lifetime", func(t *testing.T) {
+		var closed *lemon.Tx
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			closed = tx
+			return nil
+		}))
+
+		_, err := closed.Incr("counter:1", 1)
+		assert.True(t, errors.Is(err, lemon.ErrTxAlreadyClosed))
+
+		err = closed.IncrTag("post:1", "views", 1)
+		assert.True(t, errors.Is(err, lemon.ErrTxAlreadyClosed))
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/tidwall/btree"
+	"sort"
+	"strings"
 )
 
 var ErrInvalidIndexType = errors.New("invalid index type")
@@ -21,6 +23,8 @@ const (
 type index struct {
 	dt  indexType
 	btr *btree.BTree
+	// number of entries having the tag
+	size int
 }
 
 type tagIndex struct {
@@ -71,6 +75,8 @@ func (ti *tagIndex) remove(name string, dt indexType, ent *entry, lookup interfa
 	}
 
 	entryCollection.remove(ent.key.String())
+	idx.size--
+
 	if len(entryCollection.getEntries()) == 0 {
 		idx.btr.Delete(item)
 	}
@@ -190,10 +196,15 @@ func (ti *tagIndex) add(name string, value interface{}, ent *entry) error {
 			panic("invalid type casting") // fixme
 		}
 
+		if !c.hasEntry(ent.key.String()) {
+			idx.size++
+		}
+
 		c.setEntry(ent)
 	} else {
 		tag.setEntry(ent)
 		idx.btr.Set(tag)
+		idx.size++
 	}
 
 	return nil
@@ -201,131 +212,265 @@ func (ti *tagIndex) add(name string, value interface{}, ent *entry) error {
 
 type tagFilter struct {
 	key tagKey
-	m   matcher
 	idx *index
+	// pivot container for single value comparisons and lower bound of between
 	tag interface{}
+	// upper bound of between
+	upper interface{}
+	// pivot containers for in
+	tags []interface{}
+	// string prefix
+	prefix string
+	// expected type of the tag
+	dt indexType
 }
 
-func createFloatTagFilter(ti *tagIndex, key tagKey, v float64) (*tagFilter, error) {
-	idx := ti.data[key.name]
-	if idx == nil {
-		return nil, errors.Wrapf(ErrTagNameNotFound, "tag name %s", key.name)
+func newEntryContainer(value interface{}) (entryContainer, indexType, error) {
+	switch typedValue := value.(type) {
+	case float64:
+		return newFloatTag(typedValue), floatDataType, nil
+	case int:
+		return newIntTag(typedValue), intDataType, nil
+	case string:
+		return newStrTag(typedValue), strDataType, nil
+	case bool:
+		return newBoolTag(typedValue), boolDataType, nil
+	default:
+		return nil, nilDataType, errors.Wrapf(ErrInvalidTagType, "%T", value)
 	}
+}
 
-	if idx.dt != floatDataType {
-		return nil, errors.Wrapf(ErrInvalidTagType, "tag with name %s is not of type float", key.name)
+func createTagFilter(ti *tagIndex, c tagCondition) (*tagFilter, error) {
+	idx := ti.data[c.key.name]
+	if idx == nil {
+		return nil, errors.Wrapf(ErrTagNameNotFound, "tag name %s", c.key.name)
 	}
 
-	f := tagFilter{}
-	f.idx = idx
-	f.key = key
-	f.tag = newFloatTag(v)
-	f.m = key.getFloatMatcher(v)
+	c = c.coerce(idx.dt)
+	f := &tagFilter{key: c.key, idx: idx}
 
-	return &f, nil
-}
+	pivot := func(v interface{}) (interface{}, error) {
+		container, dt, err := newEntryContainer(v)
+		if err != nil {
+			return nil, err
+		}
 
-func createBoolTagFilter(ti *tagIndex, key tagKey, v bool) (*tagFilter, error) {
-	idx := ti.data[key.name]
-	if idx == nil {
-		return nil, errors.Wrapf(ErrTagNameNotFound, "tag name %s", key.name)
+		if dt != idx.dt {
+			return nil, errors.Wrapf(ErrInvalidTagType, "tag with name %s is not of type %T", c.key.name, v)
+		}
+
+		return container, nil
 	}
 
-	if idx.dt != boolDataType {
-		return nil, errors.Wrapf(ErrInvalidTagType, "tag with name %s is not of type boolean", key.name)
+	var err error
+
+	switch c.key.comp {
+	case in:
+		for _, v := range c.values {
+			p, pErr := pivot(v)
+			if pErr != nil {
+				return nil, pErr
+			}
+
+			f.tags = append(f.tags, p)
+		}
+	case between:
+		if f.tag, err = pivot(c.value); err != nil {
+			return nil, err
+		}
+
+		if f.upper, err = pivot(c.upper); err != nil {
+			return nil, err
+		}
+	case prefix:
+		if f.tag, err = pivot(c.value); err != nil {
+			return nil, err
+		}
+
+		f.prefix = c.value.(string)
+	case exists:
+	case ofType:
+		tt, _ := c.value.(TagType)
+		dt, ok := tt.indexType()
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidTagType, "tag type %v", c.value)
+		}
+
+		f.dt = dt
+	default:
+		if f.tag, err = pivot(c.value); err != nil {
+			return nil, err
+		}
 	}
 
-	f := tagFilter{}
-	f.idx = idx
-	f.key = key
-	f.tag = newBoolTag(v)
-	f.m = key.getBoolMatcher(v)
+	return f, nil
+}
 
-	return &f, nil
+// filterEntities - walks bounded ranges of tag index
+// and passes entries of all matched containers to add
+func (ti *tagIndex) filterEntities(tf *tagFilter, add func(ent *entry)) {
+	ti.filterContainers(tf, func(found entryContainer) {
+		for _, ent := range found.getEntries() {
+			add(ent)
+		}
+	})
 }
 
-func createIntegerTagFilter(ti *tagIndex, key tagKey, v int) (*tagFilter, error) {
-	idx := ti.data[key.name]
-	if idx == nil {
-		return nil, errors.Wrapf(ErrTagNameNotFound, "tag name %s", key.name)
-	}
+// filterContainers - walks bounded ranges of tag index
+// and passes every matched container to addAll
+func (ti *tagIndex) filterContainers(tf *tagFilter, addAll func(found entryContainer)) {
+	less := tf.idx.btr.Less
 
-	if idx.dt != intDataType {
-		return nil, errors.Wrapf(ErrInvalidTagType, "tag with name %s is not of type integer", key.name)
-	}
+	switch tf.key.comp {
+	case equal:
+		if found := tf.idx.btr.Get(tf.tag); found != nil {
+			addAll(found.(entryContainer))
+		}
+	case in:
+		for _, t := range tf.tags {
+			if found := tf.idx.btr.Get(t); found != nil {
+				addAll(found.(entryContainer))
+			}
+		}
+	case greaterThanOrEqual:
+		tf.idx.btr.Ascend(tf.tag, func(item interface{}) bool {
+			addAll(item.(entryContainer))
+			return true
+		})
+	case greaterThan:
+		tf.idx.btr.Ascend(tf.tag, func(item interface{}) bool {
+			if less(tf.tag, item) {
+				addAll(item.(entryContainer))
+			}
+			return true
+		})
+	case lessThanOrEqual:
+		tf.idx.btr.Descend(tf.tag, func(item interface{}) bool {
+			addAll(item.(entryContainer))
+			return true
+		})
+	case lessThan:
+		tf.idx.btr.Descend(tf.tag, func(item interface{}) bool {
+			if less(item, tf.tag) {
+				addAll(item.(entryContainer))
+			}
+			return true
+		})
+	case between:
+		tf.idx.btr.Ascend(tf.tag, func(item interface{}) bool {
+			if less(tf.upper, item) {
+				return false
+			}
+
+			addAll(item.(entryContainer))
+			return true
+		})
+	case prefix:
+		tf.idx.btr.Ascend(tf.tag, func(item interface{}) bool {
+			if !strings.HasPrefix(item.(*strTag).value, tf.prefix) {
+				return false
+			}
 
-	f := tagFilter{}
-	f.idx = idx
-	f.key = key
-	f.tag = newIntTag(v)
-	f.m = key.getIntMatcher(v)
+			addAll(item.(entryContainer))
+			return true
+		})
+	case exists, ofType:
+		if tf.key.comp == ofType && tf.dt != tf.idx.dt {
+			return
+		}
 
-	return &f, nil
+		tf.idx.btr.Ascend(nil, func(item interface{}) bool {
+			addAll(item.(entryContainer))
+			return true
+		})
+	}
 }
 
-func createStringTagFilter(ti *tagIndex, key tagKey, v string) (*tagFilter, error) {
-	idx := ti.data[key.name]
-	if idx == nil {
-		return nil, errors.Wrapf(ErrTagNameNotFound, "tag name %s", key.name)
+type entrySet map[string]*entry
+
+func (es entrySet) intersect(other entrySet) entrySet {
+	small, big := es, other
+	if len(big) < len(small) {
+		small, big = big, small
 	}
 
-	if idx.dt != strDataType {
-		return nil, errors.Wrapf(ErrInvalidTagType, "tag with name %s is not of type string", key.name)
+	result := make(entrySet, len(small))
+	for k, ent := range small {
+		if _, ok := big[k]; ok {
+			result[k] = ent
+		}
 	}
 
-	f := tagFilter{}
-	f.idx = idx
-	f.key = key
-	f.tag = newStrTag(v)
-	f.m = key.getStringMatcher(v)
+	return result
+}
 
-	return &f, nil
+func (es entrySet) union(other entrySet) {
+	for k, ent := range other {
+		es[k] = ent
+	}
 }
 
-func (ti *tagIndex) filterEntities(tf *tagFilter, fes *filterEntriesSink) {
-	scanIter := func(found interface{}) bool {
-		if found == nil {
-			return true
+func (es entrySet) difference(other entrySet) entrySet {
+	result := make(entrySet, len(es))
+	for k, ent := range es {
+		if _, ok := other[k]; !ok {
+			result[k] = ent
 		}
+	}
 
-		tag, ok := found.(entryContainer)
-		if !ok {
-			panic("how can intIndex item not be of type *intTag?")
-		}
+	return result
+}
 
-		if tag.getEntries() == nil {
-			return true
-		}
+// matchCondition - finds entries matching a single tag condition,
+// a tag name that does not exist matches no entries
+func (ti *tagIndex) matchCondition(c tagCondition) (entrySet, error) {
+	result := make(entrySet)
+	if ti.data[c.key.name] == nil {
+		return result, nil
+	}
 
-		for _, ent := range tag.getEntries() {
-			if tf.m(ent) {
-				fes.add(ent)
-			}
-		}
+	tf, err := createTagFilter(ti, c)
+	if err != nil {
+		return nil, err
+	}
 
-		return true
+	ti.filterEntities(tf, func(ent *entry) {
+		result[ent.key.String()] = ent
+	})
+
+	return result, nil
+}
+
+// estimateCondition - counts entries matching a single tag condition
+// from sizes of index containers without collecting the entries
+func (ti *tagIndex) estimateCondition(c tagCondition) (int, error) {
+	if ti.data[c.key.name] == nil {
+		return 0, nil
 	}
 
-	switch tf.key.comp {
-	case equal:
-		found := tf.idx.btr.Get(tf.tag)
-		if found == nil {
-			return
-		}
+	tf, err := createTagFilter(ti, c)
+	if err != nil {
+		return 0, err
+	}
 
-		tag, ok := found.(entryContainer)
-		if !ok {
-			panic("not an entity container") // fixme
+	// presence of a tag is counted by its index
+	switch c.key.comp {
+	case exists:
+		return tf.idx.size, nil
+	case ofType:
+		if tf.dt != tf.idx.dt {
+			return 0, nil
 		}
 
-		for _, ent := range tag.getEntries() {
-			fes.add(ent)
-		}
-	case greaterThan:
-		tf.idx.btr.Ascend(tf.tag, scanIter)
-	case lessThan:
-		tf.idx.btr.Descend(tf.tag, scanIter)
+		return tf.idx.size, nil
 	}
+
+	count := 0
+	ti.filterContainers(tf, func(found entryContainer) {
+		count += len(found.getEntries())
+	})
+
+	return count, nil
 }
 
 func lt(tr *btree.BTree, a, b interface{}) bool { return tr.Less(a, b) }
@@ -391,3 +536,108 @@ func byBooleans(a, b interface{}) bool {
 
 	return false
 }
+
+// tagIndexBuilder - collects tags of bulk loaded entries
+// and builds secondary indexes bottom-up from sorted containers
+type tagIndexBuilder struct {
+	dts        map[string]indexType
+	containers map[string]map[interface{}]entryContainer
+}
+
+func newTagIndexBuilder() *tagIndexBuilder {
+	return &tagIndexBuilder{
+		dts:        make(map[string]indexType),
+		containers: make(map[string]map[interface{}]entryContainer),
+	}
+}
+
+func (b *tagIndexBuilder) add(ent *entry) error {
+	for name, t := range ent.tags {
+		if dt, ok := b.dts[name]; ok && dt != t.dt {
+			return errors.Wrapf(ErrInvalidIndexType, "tag %s", name)
+		}
+
+		b.dts[name] = t.dt
+
+		values := b.containers[name]
+		if values == nil {
+			values = make(map[interface{}]entryContainer)
+			b.containers[name] = values
+		}
+
+		c, ok := values[t.data]
+		if !ok {
+			var err error
+			if c, _, err = newEntryContainer(t.data); err != nil {
+				return err
+			}
+
+			values[t.data] = c
+		}
+
+		c.setEntry(ent)
+	}
+
+	return nil
+}
+
+func (b *tagIndexBuilder) remove(ent *entry) {
+	for name, t := range ent.tags {
+		values := b.containers[name]
+		if values == nil {
+			continue
+		}
+
+		c, ok := values[t.data]
+		if !ok {
+			continue
+		}
+
+		c.remove(ent.key.String())
+		if len(c.getEntries()) == 0 {
+			delete(values, t.data)
+		}
+	}
+}
+
+// build - replaces indexes of tag index with the ones collected by the builder
+func (b *tagIndexBuilder) build(ti *tagIndex) {
+	for name, values := range b.containers {
+		if len(values) == 0 {
+			continue
+		}
+
+		less := lessByIndexType(b.dts[name])
+		items := make([]interface{}, 0, len(values))
+		for _, c := range values {
+			items = append(items, c)
+		}
+
+		sort.Slice(items, func(i, j int) bool {
+			return less(items[i], items[j])
+		})
+
+		idx := &index{dt: b.dts[name], btr: btree.NewNonConcurrent(less)}
+		for _, item := range items {
+			idx.btr.Load(item)
+			idx.size += len(item.(entryContainer).getEntries())
+		}
+
+		ti.data[name] = idx
+	}
+}
+
+func lessByIndexType(dt indexType) func(a, b interface{}) bool {
+	switch dt {
+	case floatDataType:
+		return byFloats
+	case intDataType:
+		return byIntegers
+	case strDataType:
+		return byStrings
+	case boolDataType:
+		return byBooleans
+	default:
+		panic(fmt.Sprintf("invalid index type %d", dt))
+	}
+}
@@ -0,0 +1,231 @@
+package lemon
+
+import (
+	"context"
+)
+
+// Iterator - pulls documents matched by query options one by one,
+// values are loaded only when a document is requested, so that LazyLoad and BufferedLoad
+// databases never hold all the values at once. In a read only transaction the query plan
+// is driven step by step, each Next resumes matching right where the previous one stopped;
+// in a writable transaction keys are matched when the iterator is created, since the transaction
+// can modify indexes while the iterator is in use.
+// An iterator is valid only within the transaction it was created in.
+type Iterator struct {
+	x      *Tx
+	ctx    context.Context
+	qo     *QueryOptions
+	ents   []*entry
+	next   int
+	cur    *entry
+	doc    *Document
+	err    error
+	closed bool
+
+	// scanner of a read only transaction hands entries over one at a time
+	stream  chan *entry
+	pull    chan struct{}
+	done    chan struct{}
+	scanErr error
+	stopped bool
+}
+
+// Iterate - creates an iterator over documents matched by query options,
+// errors of the query are reported by Err of the iterator
+func (x *Tx) Iterate(qo *QueryOptions) *Iterator {
+	it := &Iterator{x: x, ctx: x.ctx, qo: qo}
+	if it.ctx == nil {
+		it.ctx = context.Background()
+	}
+
+	if x.ee == nil {
+		it.err = ErrTxAlreadyClosed
+		return it
+	}
+
+	if x.readOnly {
+		it.scan()
+		x.iterators = append(x.iterators, it)
+		return it
+	}
+
+	if err := x.applyScanner(it.ctx, qo, func(ent *entry) bool {
+		it.ents = append(it.ents, ent)
+		return true
+	}); err != nil {
+		it.err = err
+	}
+
+	return it
+}
+
+// scan - runs the query plan in a goroutine that waits for a pull before matching
+// every next entry, so the plan never runs concurrently with the caller of Next
+func (it *Iterator) scan() {
+	it.stream = make(chan *entry)
+	it.pull = make(chan struct{})
+	it.done = make(chan struct{})
+
+	go func() {
+		defer close(it.stream)
+
+		select {
+		case <-it.pull:
+		case <-it.done:
+			return
+		}
+
+		it.scanErr = it.x.applyScanner(it.ctx, it.qo, func(ent *entry) bool {
+			select {
+			case it.stream <- ent:
+			case <-it.done:
+				return false
+			}
+
+			select {
+			case <-it.pull:
+				return true
+			case <-it.done:
+				return false
+			}
+		})
+	}()
+}
+
+// stop - stops the scanner and waits for it to return,
+// must be called before the transaction releases its lock
+func (it *Iterator) stop() {
+	if it.stream == nil || it.stopped {
+		return
+	}
+
+	it.stopped = true
+	close(it.done)
+	for range it.stream {
+	}
+}
+
+// pullNext - next entry matched by the scanner, false when the scanner is done
+func (it *Iterator) pullNext() (*entry, bool) {
+	if it.stopped {
+		return nil, false
+	}
+
+	var ent *entry
+	var ok bool
+	select {
+	case it.pull <- struct{}{}:
+		ent, ok = <-it.stream
+	case ent, ok = <-it.stream:
+	}
+
+	if !ok {
+		it.stopped = true
+		if it.scanErr != nil {
+			it.err = it.scanErr
+		}
+	}
+
+	return ent, ok
+}
+
+// Next - advances the iterator to the next document, returns false when there are no more documents,
+// the iterator is closed or an error happened, entries removed after the iterator was created are skipped
+func (it *Iterator) Next() bool {
+	it.cur, it.doc = nil, nil
+
+	if it.err != nil || it.closed {
+		return false
+	}
+
+	if it.x.ee == nil {
+		it.err = ErrTxAlreadyClosed
+		return false
+	}
+
+	for {
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+
+		var ent *entry
+		if it.stream != nil {
+			var ok bool
+			if ent, ok = it.pullNext(); !ok {
+				return false
+			}
+		} else {
+			if it.next >= len(it.ents) {
+				return false
+			}
+
+			ent = it.ents[it.next]
+			it.ents[it.next] = nil
+			it.next++
+		}
+
+		// the entry could have been removed or replaced by the transaction in the meantime
+		cur, err := it.x.find(ent.key.String())
+		if err != nil {
+			continue
+		}
+
+		it.cur = cur
+		return true
+	}
+}
+
+// Key - key of the current document, available without loading its value
+func (it *Iterator) Key() string {
+	if it.cur == nil {
+		return ""
+	}
+
+	return it.cur.key.String()
+}
+
+// Document - current document, its value is loaded on the first call unless query options ask for no values,
+// nil is returned when there is no current document or the value could not be loaded
+func (it *Iterator) Document() *Document {
+	if it.cur == nil || it.err != nil {
+		return nil
+	}
+
+	if it.doc != nil {
+		return it.doc
+	}
+
+	ent := it.cur
+	if it.qo == nil || !it.qo.withoutValues {
+		// lazily loaded values are read into a copy of the entry, so they do not stay in memory
+		withValue, err := it.x.withValue(ent)
+		if err != nil {
+			it.err = err
+			return nil
+		}
+
+		ent = withValue
+	}
+
+	it.doc = newDocumentFromQuery(it.qo, ent)
+	it.x.populate(it.qo, it.doc)
+
+	return it.doc
+}
+
+// Err - error that stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close - releases the iterator, Next returns false afterwards,
+// closing an iterator more than once is not an error
+func (it *Iterator) Close() error {
+	it.closed = true
+	it.stop()
+	it.ents = nil
+	it.cur, it.doc = nil, nil
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package lemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIterator_Streaming(t *testing.T) {
+	db, closer, err := Open(InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	for i := 1; i <= 100; i++ {
+		require.NoError(t, db.Insert(fmt.Sprintf("item:%03d", i), M{"id": i}))
+	}
+
+	stopped := func(it *Iterator) bool {
+		select {
+		case _, ok := <-it.stream:
+			return !ok
+		default:
+			return false
+		}
+	}
+
+	t.Run("read only transaction does not collect entries", func(t *testing.T) {
+		require.NoError(t, db.View(context.Background(), func(tx *Tx) error {
+			it := tx.Iterate(Q().Prefix("item"))
+			require.NotNil(t, it.stream)
+
+			for i := 1; i <= 3; i++ {
+				require.True(t, it.Next())
+				assert.Equal(t, fmt.Sprintf("item:%03d", i), it.Key())
+				assert.Empty(t, it.ents)
+			}
+
+			assert.False(t, stopped(it))
+			require.NoError(t, it.Close())
+			assert.True(t, stopped(it))
+			return nil
+		}))
+	})
+
+	t.Run("scanner stops when transaction ends", func(t *testing.T) {
+		var it *Iterator
+		require.NoError(t, db.View(context.Background(), func(tx *Tx) error {
+			it = tx.Iterate(Q().Prefix("item"))
+			require.True(t, it.Next())
+			return nil
+		}))
+
+		assert.True(t, stopped(it))
+		assert.False(t, it.Next())
+		assert.True(t, errors.Is(it.Err(), ErrTxAlreadyClosed))
+	})
+
+	t.Run("writable transaction matches keys eagerly", func(t *testing.T) {
+		require.NoError(t, db.Update(context.Background(), func(tx *Tx) error {
+			it := tx.Iterate(Q().Prefix("item"))
+			defer it.Close()
+
+			assert.Nil(t, it.stream)
+			assert.Len(t, it.ents, 100)
+			return nil
+		}))
+	})
+}
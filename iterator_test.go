@@ -0,0 +1,243 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestTx_Iterate(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, db.Insert(fmt.Sprintf("user:%d", i), lemon.M{"id": i}, lemon.WithTags().Bool("odd", i%2 == 1)))
+	}
+
+	require.NoError(t, db.Insert("account:1", lemon.M{"id": 1}))
+
+	t.Run("documents in query order", func(t *testing.T) {
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Prefix("user").KeyOrder(lemon.DescOrder).HasAllTags(lemon.QT().BoolTagEq("odd", true)))
+			defer it.Close()
+
+			var keys []string
+			for it.Next() {
+				d := it.Document()
+				require.NotNil(t, d)
+				assert.Equal(t, it.Key(), d.Key())
+				keys = append(keys, d.Key())
+			}
+
+			require.NoError(t, it.Err())
+			assert.Equal(t, []string{"user:5", "user:3", "user:1"}, keys)
+			return nil
+		}))
+	})
+
+	t.Run("merge join of two iterators", func(t *testing.T) {
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			odd := tx.Iterate(lemon.Q().HasAllTags(lemon.QT().BoolTagEq("odd", true)))
+			defer odd.Close()
+			small := tx.Iterate(lemon.Q().KeyRange("user:1", "user:3"))
+			defer small.Close()
+
+			var both []string
+			okOdd, okSmall := odd.Next(), small.Next()
+			for okOdd && okSmall {
+				switch {
+				case odd.Key() == small.Key():
+					both = append(both, odd.Key())
+					okOdd, okSmall = odd.Next(), small.Next()
+				case odd.Key() < small.Key():
+					okOdd = odd.Next()
+				default:
+					okSmall = small.Next()
+				}
+			}
+
+			require.NoError(t, odd.Err())
+			require.NoError(t, small.Err())
+			assert.Equal(t, []string{"user:1", "user:3"}, both)
+			return nil
+		}))
+	})
+
+	t.Run("entries removed in the meantime are skipped", func(t *testing.T) {
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Prefix("user"))
+			defer it.Close()
+
+			require.NoError(t, tx.Remove("user:2"))
+
+			var keys []string
+			for it.Next() {
+				keys = append(keys, it.Key())
+			}
+
+			require.NoError(t, it.Err())
+			assert.Equal(t, []string{"user:1", "user:3", "user:4", "user:5"}, keys)
+			return errors.New("rollback")
+		})
+
+		require.Error(t, err)
+
+		assert.True(t, db.Has("user:2"))
+	})
+
+	t.Run("closed iterator stops", func(t *testing.T) {
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Prefix("user"))
+			require.True(t, it.Next())
+			require.NoError(t, it.Close())
+			require.NoError(t, it.Close())
+
+			assert.False(t, it.Next())
+			assert.Nil(t, it.Document())
+			assert.NoError(t, it.Err())
+			return nil
+		}))
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		require.NoError(t, db.View(ctx, func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Prefix("user"))
+			defer it.Close()
+
+			require.True(t, it.Next())
+			cancel()
+
+			assert.False(t, it.Next())
+			assert.True(t, errors.Is(it.Err(), context.Canceled))
+			return nil
+		}))
+	})
+
+	t.Run("transaction lifetime", func(t *testing.T) {
+		var it *lemon.Iterator
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it = tx.Iterate(lemon.Q().Prefix("user"))
+			return nil
+		}))
+
+		assert.False(t, it.Next())
+		assert.True(t, errors.Is(it.Err(), lemon.ErrTxAlreadyClosed))
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Where("id", lemon.Gt, true))
+			defer it.Close()
+
+			assert.False(t, it.Next())
+			assert.True(t, errors.Is(it.Err(), lemon.ErrInvalidQueryOptions))
+			return nil
+		}))
+	})
+}
+
+func TestTx_Iterate_LazyLoad(t *testing.T) {
+	fixture := "./__fixtures__/iterate_lazy_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	open := func() (*lemon.DB, lemon.Closer) {
+		db, closer, err := lemon.Open(fixture, &lemon.Config{
+			DisableAutoVacuum:   true,
+			PersistenceStrategy: lemon.Sync,
+			ValueLoadStrategy:   lemon.LazyLoad,
+		})
+
+		require.NoError(t, err)
+		return db, closer
+	}
+
+	db, closer := open()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, db.Insert(fmt.Sprintf("product:%d", i), lemon.M{"id": i}))
+	}
+	require.NoError(t, closer())
+
+	db, closer = open()
+	defer func() {
+		require.NoError(t, closer())
+	}()
+
+	require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+		it := tx.Iterate(lemon.Q().Prefix("product"))
+		defer it.Close()
+
+		var ids []int
+		for it.Next() {
+			d := it.Document()
+			require.NotNil(t, d)
+			assert.True(t, d == it.Document())
+
+			id, err := d.JSON().Int("id")
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+
+		require.NoError(t, it.Err())
+		assert.Equal(t, []int{1, 2, 3}, ids)
+		return nil
+	}))
+
+	// read transactions run concurrently and share entries
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				assert.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+					it := tx.Iterate(lemon.Q().Prefix("product"))
+					defer it.Close()
+
+					for it.Next() {
+						assert.NotEmpty(t, it.Document().Value())
+					}
+
+					docs, err := tx.Find(lemon.Q().Prefix("product"))
+					if err != nil {
+						return err
+					}
+
+					for _, d := range docs {
+						assert.NotEmpty(t, d.Value())
+					}
+
+					d, err := tx.Get("product:2")
+					if err != nil {
+						return err
+					}
+
+					assert.NotEmpty(t, d.Value())
+					return it.Err()
+				}))
+			}
+		}()
+	}
+
+	wg.Wait()
+}
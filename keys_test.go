@@ -0,0 +1,98 @@
+package lemon_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDB_KeysAndMetaWithoutValues(t *testing.T) {
+	fixture := "./__fixtures__/keys_lazy_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	open := func() (*lemon.DB, lemon.Closer) {
+		db, closer, err := lemon.Open(fixture, &lemon.Config{
+			DisableAutoVacuum:   true,
+			PersistenceStrategy: lemon.Sync,
+			ValueLoadStrategy:   lemon.LazyLoad,
+		})
+
+		require.NoError(t, err)
+		return db, closer
+	}
+
+	db, closer := open()
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, db.Insert(
+			fmt.Sprintf("user:%d", i),
+			lemon.M{"name": fmt.Sprintf("user %d", i)},
+			lemon.WithTags().Int("age", 20+i).Bool("admin", i == 2),
+		))
+	}
+	require.NoError(t, db.Insert("product:1", lemon.M{"name": "coffee"}))
+	require.NoError(t, closer())
+
+	db, closer = open()
+	defer func() {
+		_ = closer()
+	}()
+
+	// values cannot be read anymore, so any attempt to load them would fail
+	require.NoError(t, os.Truncate(fixture, 0))
+
+	_, err := db.Get("user:1")
+	require.Error(t, err)
+
+	t.Run("keys", func(t *testing.T) {
+		keys, err := db.Keys(lemon.Q().Prefix("user").HasAllTags(lemon.QT().IntTagGt("age", 21)).KeyOrder(lemon.DescOrder))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:4", "user:3", "user:2"}, keys)
+
+		keys, err = db.Keys(nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"product:1", "user:1", "user:2", "user:3", "user:4"}, keys)
+	})
+
+	t.Run("scan meta", func(t *testing.T) {
+		tags := make(map[string]lemon.M)
+		require.NoError(t, db.ScanMeta(lemon.Q().Match("user:*").Limit(2), func(key string, m lemon.M) bool {
+			tags[key] = m
+			return true
+		}))
+
+		assert.Equal(t, map[string]lemon.M{
+			"user:1": {"age": 21, "admin": false},
+			"user:2": {"age": 22, "admin": true},
+		}, tags)
+	})
+
+	t.Run("find and iterate without values", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Prefix("user").HasAllTags(lemon.QT().BoolTagEq("admin", true)).WithoutValues())
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "user:2", docs[0].Key())
+		assert.Equal(t, lemon.M{"age": 22, "admin": true}, docs[0].Tags())
+		assert.Empty(t, docs[0].Value())
+
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Match("product:*").WithoutValues())
+			defer it.Close()
+
+			require.True(t, it.Next())
+			require.NotNil(t, it.Document())
+			assert.Equal(t, "product:1", it.Document().Key())
+			assert.False(t, it.Next())
+			return it.Err()
+		}))
+	})
+}
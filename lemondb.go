@@ -37,6 +37,7 @@ func Open(path string, engineOptions ...EngineOptions) (*DB, Closer, error) {
 		AutoVacuumMinSize:            defaultAutoVacuumMinSize,
 		AutoVacuumOnlyOnCloseOrFlush: true,
 		Log:                          false,
+		ExpiredKeysReapIntervals:     defaultExpiredKeysReapIntervals,
 	}
 
 	if path == InMemory {
@@ -194,6 +195,111 @@ func (db *DB) InsertOrReplace(key string, data interface{}, metaAppliers ...Meta
 	})
 }
 
+// IncrBy increments an integer document by delta in its own transaction
+// and returns the resulting value, the document is created if it does not exist
+func (db *DB) IncrBy(key string, delta int) (int, error) {
+	var result int
+	err := db.Update(context.Background(), func(tx *Tx) error {
+		v, err := tx.Incr(key, delta)
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+
+	return result, err
+}
+
+// BulkLoad streams documents from the iterator into the database, writing them in chunks,
+// it is much faster than inserting the same documents in a transaction,
+// but it is not atomic and commit hooks are not called
+func (db *DB) BulkLoad(ctx context.Context, it BulkIterator, opts ...*BulkOptions) (BulkStats, error) {
+	var bo *BulkOptions
+	if len(opts) > 0 {
+		bo = opts[len(opts)-1]
+	}
+
+	return db.e.BulkLoad(ctx, it, bo)
+}
+
+// CreateIndex creates an index with a given name on a field of JSON documents, e.g.
+// `db.CreateIndex("age", lemon.JSONPath("user.age"), lemon.IntIndex)`, existing documents are indexed
+// right away and new ones on every insert or replace, the index is queried like any other tag
+func (db *DB) CreateIndex(name string, path JSONPath, ft FieldIndexType) error {
+	return db.e.CreateIndex(name, path, ft)
+}
+
+// CreateTextIndex creates a full-text index over string fields of JSON documents or entire String
+// documents, it is searched with `lemon.Q().MatchText(name, "budapest cafe")`, see TextIndexOptions
+func (db *DB) CreateTextIndex(name string, opts *TextIndexOptions) error {
+	return db.e.CreateTextIndex(name, opts)
+}
+
+// CreateCompositeIndex creates an index ordered by values of several tags, e.g.
+// `db.CreateCompositeIndex("tenant_status_updated", "tenant", "status", lemon.UpdatedAt)`,
+// it is used by queries with equality conditions on leading tags and optionally a range on the next one
+func (db *DB) CreateCompositeIndex(name string, tagNames ...string) error {
+	return db.e.CreateCompositeIndex(name, tagNames...)
+}
+
+// CreateUniqueTag declares a tag unique across keys matching the pattern or across all keys
+// when the pattern is empty, e.g. `db.CreateUniqueTag("email", "user:*")`, from now on writes that
+// would repeat a value fail with ErrUniqueViolation
+func (db *DB) CreateUniqueTag(name, pattern string) error {
+	return db.e.CreateUniqueTag(name, pattern)
+}
+
+// GetByUniqueTag gets a document by the value of a unique tag
+func (db *DB) GetByUniqueTag(name string, value interface{}) (*Document, error) {
+	var doc *Document
+	err := db.View(context.Background(), func(tx *Tx) error {
+		d, err := tx.GetByUniqueTag(name, value)
+		if err != nil {
+			return err
+		}
+		doc = d
+		return nil
+	})
+
+	return doc, err
+}
+
+// CreateRef declares a string field of JSON documents a reference to another document, e.g.
+// `db.CreateRef("customer", lemon.JSONPath("customer_id"))`, so that it can be populated and looked up
+// the same way as references of WithRef, it is a field index named RefTag(name) and is dropped by DropIndex
+func (db *DB) CreateRef(name string, path JSONPath) error {
+	if name == "" {
+		return errors.Wrap(ErrInvalidRef, "reference name cannot be empty")
+	}
+
+	return db.e.CreateIndex(RefTag(name), path, StrIndex)
+}
+
+// ReferencedBy finds documents referencing the given key under any reference name,
+// references are looked up in tag indexes and the rest of query options apply as in Find, e.g.
+// `db.ReferencedBy("customer:1", lemon.Q().Match("order:*").OrderBy(lemon.UpdatedAt, lemon.DescOrder).Limit(10))`
+func (db *DB) ReferencedBy(key string, qo ...*QueryOptions) ([]*Document, error) {
+	var q *QueryOptions
+	if len(qo) > 0 {
+		q = qo[len(qo)-1]
+	}
+
+	var docs []*Document
+	err := db.View(context.Background(), func(tx *Tx) error {
+		var err error
+		docs, err = tx.ReferencedBy(key, q)
+		return err
+	})
+
+	return docs, err
+}
+
+// DropIndex removes an index created by CreateIndex, CreateTextIndex or CreateCompositeIndex
+func (db *DB) DropIndex(name string) error {
+	return db.e.DropIndex(name)
+}
+
 func (db *DB) View(ctx context.Context, cb UserCallback) error {
 	tx, err := db.Begin(ctx, true)
 	if err != nil {
@@ -273,6 +379,27 @@ func (db *DB) ScanContext(ctx context.Context, qo *QueryOptions, cb func(d *Docu
 	})
 }
 
+// Keys finds keys of documents matched by query options without loading their values
+func (db *DB) Keys(qo *QueryOptions) ([]string, error) {
+	var keys []string
+	if err := db.View(context.Background(), func(tx *Tx) error {
+		var err error
+		keys, err = tx.Keys(qo)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ScanMeta iterates keys and tags of documents matched by query options without loading their values
+func (db *DB) ScanMeta(qo *QueryOptions, cb func(key string, tags M) bool) error {
+	return db.View(context.Background(), func(tx *Tx) error {
+		return tx.ScanMeta(qo, cb)
+	})
+}
+
 func (db *DB) Find(qo *QueryOptions) ([]*Document, error) {
 	return db.FindContext(context.Background(), qo)
 }
@@ -289,3 +416,84 @@ func (db *DB) FindContext(ctx context.Context, qo *QueryOptions) ([]*Document, e
 
 	return docs, nil
 }
+
+// Aggregate calculates aggregates over documents matched by query options, see Tx.Aggregate
+func (db *DB) Aggregate(ctx context.Context, qo *QueryOptions, aggs ...*Aggregation) (*AggregateResult, error) {
+	var result *AggregateResult
+	if err := db.View(ctx, func(tx *Tx) error {
+		var err error
+		result, err = tx.Aggregate(qo, aggs...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TagValues returns distinct values of a tag in order with counts of documents,
+// optional query options can restrict documents by key prefix, range or pattern, see Tx.TagValues
+func (db *DB) TagValues(name string, qo ...*QueryOptions) ([]TagValue, error) {
+	var q *QueryOptions
+	if len(qo) > 0 {
+		q = qo[len(qo)-1]
+	}
+
+	var result []TagValue
+	if err := db.View(context.Background(), func(tx *Tx) error {
+		var err error
+		result, err = tx.TagValues(name, q)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Explain runs the query and reports the plan chosen for it,
+// the indexes it used and the estimated versus actual numbers of rows
+func (db *DB) Explain(qo *QueryOptions) (*Explanation, error) {
+	var result *Explanation
+	if err := db.View(context.Background(), func(tx *Tx) error {
+		var err error
+		result, err = tx.Explain(qo)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Facets returns distinct values of given tags with counts of documents matched by query options
+func (db *DB) Facets(qo *QueryOptions, tagNames ...string) (map[string][]TagValue, error) {
+	var result map[string][]TagValue
+	if err := db.View(context.Background(), func(tx *Tx) error {
+		var err error
+		result, err = tx.Facets(qo, tagNames...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (db *DB) FindPage(qo *QueryOptions) (*Page, error) {
+	return db.FindPageContext(context.Background(), qo)
+}
+
+// FindPageContext finds a page of documents, see Tx.FindPage
+func (db *DB) FindPageContext(ctx context.Context, qo *QueryOptions) (*Page, error) {
+	var page *Page
+	if err := db.View(ctx, func(tx *Tx) error {
+		var err error
+		page, err = tx.FindPage(qo)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/denismitr/lemon"
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"os"
 	"sync"
@@ -20,6 +22,41 @@ func TestTx_Untag(t *testing.T) {
 	suite.Run(t, &untagTestSuite{})
 }
 
+func TestDB_KeyPatterns(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	for _, key := range []string{
+		"account:1", "user:1", "user:12", "user:120", "user:2", "user:12:pets", "tenant:a:orders:1", "tenant:b:invoices:2", "zone:1",
+	} {
+		require.NoError(t, db.Insert(key, lemon.M{}))
+	}
+
+	find := func(qo *lemon.QueryOptions) []string {
+		docs, err := db.Find(qo)
+		require.NoError(t, err)
+		return keysOf(docs)
+	}
+
+	assert.Equal(t, []string{"user:12", "user:12:pets", "user:120"}, find(lemon.Q().Match("user:12*")))
+	assert.Equal(t, []string{"user:120", "user:12:pets", "user:12"}, find(lemon.Q().Match("user:12*").KeyOrder(lemon.DescOrder)))
+	assert.Equal(t, []string{"tenant:b:invoices:2"}, find(lemon.Q().Match("tenant:**:2")))
+	assert.Equal(t, []string{"user:1", "user:2", "user:12", "user:120"}, find(lemon.Q().MatchRegex(`^user:\d+$`)))
+	assert.Equal(t, []string{"user:12"}, find(lemon.Q().Match("user:*").MatchRegex(`:12`).Limit(1)))
+	assert.Equal(t, []string{"account:1"}, find(lemon.Q().Match("[a-c]*:*")))
+	assert.Equal(t, []string{"zone:1"}, find(lemon.Q().Match("zone").KeyOrder(lemon.DescOrder)))
+	assert.Equal(t, []string{"user:12", "user:12:pets"}, find(lemon.Q().Match("user:12").Prefix("user:1")))
+
+	_, err = db.Find(lemon.Q().MatchRegex("user:(("))
+	assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+}
+
 type untagTestSuite struct {
 	suite.Suite
 	fixture string
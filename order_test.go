@@ -0,0 +1,117 @@
+package lemon_test
+
+import (
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestQueryOptions_OrderBy(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("task:1", lemon.M{}, lemon.WithTags().Int("priority", 2).Str("team", "b")))
+	require.NoError(t, db.Insert("task:2", lemon.M{}, lemon.WithTags().Int("priority", 3).Str("team", "a")))
+	require.NoError(t, db.Insert("task:3", lemon.M{}, lemon.WithTags().Int("priority", 2).Str("team", "a")))
+	require.NoError(t, db.Insert("task:4", lemon.M{}, lemon.WithTags().Str("team", "a")))
+	require.NoError(t, db.Insert("task:5", lemon.M{}, lemon.WithTags().Int("priority", 3).Str("team", "b")))
+	require.NoError(t, db.Insert("task:6", lemon.M{}, lemon.WithTags().Int("priority", 1).Str("team", "a")))
+	require.NoError(t, db.Insert("task:7", lemon.M{}, lemon.WithTags().Int("priority", 2).Str("team", "a")))
+	require.NoError(t, db.Insert("note:1", lemon.M{}, lemon.WithTags().Int("priority", 3)))
+
+	tt := []struct {
+		name     string
+		q        *lemon.QueryOptions
+		keys     []string
+		strategy lemon.PlanStrategy
+	}{
+		{
+			name:     "several sort keys with mixed directions",
+			q:        lemon.Q().Match("task:*").OrderBy("priority", lemon.DescOrder).ThenBy("team", lemon.AscOrder).ThenByKey(lemon.DescOrder),
+			keys:     []string{"task:2", "task:5", "task:7", "task:3", "task:1", "task:6", "task:4"},
+			strategy: lemon.TagNameScan,
+		},
+		{
+			name:     "ties are ordered by keys",
+			q:        lemon.Q().Match("task:*").OrderBy("priority", lemon.DescOrder),
+			keys:     []string{"task:2", "task:5", "task:1", "task:3", "task:7", "task:6", "task:4"},
+			strategy: lemon.TagNameScan,
+		},
+		{
+			name:     "with a limit",
+			q:        lemon.Q().Match("task:*").OrderBy("priority", lemon.DescOrder).ThenBy("team", lemon.DescOrder).Limit(3),
+			keys:     []string{"task:5", "task:2", "task:1"},
+			strategy: lemon.TagNameScan,
+		},
+		{
+			name:     "with tags matching most of the documents",
+			q:        lemon.Q().OrderBy("priority", lemon.DescOrder).HasAllTags(lemon.QT().StrTagEq("team", "a")),
+			keys:     []string{"task:2", "task:3", "task:7", "task:6", "task:4"},
+			strategy: lemon.TagNameScan,
+		},
+		{
+			name:     "with selective tags",
+			q:        lemon.Q().OrderBy("priority", lemon.AscOrder).HasAllTags(lemon.QT().StrTagEq("team", "b")),
+			keys:     []string{"task:1", "task:5"},
+			strategy: lemon.TagIndexScan,
+		},
+		{
+			name:     "with a prefix",
+			q:        lemon.Q().Prefix("task").OrderBy("priority", lemon.AscOrder).ThenByKey(lemon.DescOrder),
+			keys:     []string{"task:6", "task:7", "task:3", "task:1", "task:5", "task:2", "task:4"},
+			strategy: lemon.PrefixScan,
+		},
+		{
+			name:     "by a tag nobody has",
+			q:        lemon.Q().Match("task:*").OrderBy("deadline", lemon.DescOrder).Limit(3),
+			keys:     []string{"task:1", "task:2", "task:3"},
+			strategy: lemon.FullScan,
+		},
+		{
+			name:     "by key only",
+			q:        lemon.Q().Match("task:*").ThenByKey(lemon.DescOrder).Limit(2),
+			keys:     []string{"task:7", "task:6"},
+			strategy: lemon.FullScan,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.Find(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+
+			e, err := db.Explain(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.strategy, e.Strategy)
+		})
+	}
+
+	t.Run("index walk stops at the limit", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().OrderBy("priority", lemon.AscOrder).Limit(1))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"priority"}, e.Indexes)
+		assert.Equal(t, 1, e.ActualRows)
+		assert.True(t, e.ScannedRows < 3)
+	})
+
+	t.Run("invalid combinations", func(t *testing.T) {
+		for _, q := range []*lemon.QueryOptions{
+			lemon.Q().OrderBy("priority", lemon.AscOrder).ByTagName("team"),
+			lemon.Q().OrderBy("priority", lemon.AscOrder).MatchText("notes", "text"),
+			lemon.Q().ThenByKey(lemon.AscOrder).ThenBy("priority", lemon.AscOrder),
+			lemon.Q().OrderBy("priority", "up"),
+		} {
+			_, err := db.Find(q)
+			assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+		}
+	})
+}
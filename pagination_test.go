@@ -0,0 +1,111 @@
+package lemon_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestQueryOptions_Pagination(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	for i := 1; i <= 25; i++ {
+		require.NoError(t, db.Insert(fmt.Sprintf("item:%d", i), lemon.M{"i": i}, lemon.WithTags().Bool("odd", i%2 == 1)))
+	}
+
+	require.NoError(t, db.Insert("other:1", lemon.M{"i": 0}))
+
+	t.Run("limit and offset", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Prefix("item").Limit(3).Offset(2))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"item:3", "item:4", "item:5"}, keysOf(docs))
+
+		docs, err = db.Find(lemon.Q().KeyOrder(lemon.DescOrder).Limit(2))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"other:1", "item:25"}, keysOf(docs))
+
+		docs, err = db.Find(lemon.Q().HasAllTags(lemon.QT().BoolTagEq("odd", false)).Limit(3).Offset(1))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"item:4", "item:6", "item:8"}, keysOf(docs))
+
+		count, err := db.CountByQuery(lemon.Q().KeyRange("item:1", "item:25").Offset(20))
+		require.NoError(t, err)
+		assert.Equal(t, 5, count)
+	})
+
+	pageThrough := func(t *testing.T, q func() *lemon.QueryOptions) ([]string, int) {
+		var keys []string
+		var pages int
+		cursor := ""
+
+		for {
+			page, err := db.FindPage(q().After(cursor))
+			require.NoError(t, err)
+			pages++
+			keys = append(keys, keysOf(page.Documents)...)
+
+			if page.Next == "" {
+				return keys, pages
+			}
+
+			cursor = page.Next
+		}
+	}
+
+	t.Run("cursor over all keys", func(t *testing.T) {
+		keys, pages := pageThrough(t, func() *lemon.QueryOptions {
+			return lemon.Q().Match("item:*").Limit(10)
+		})
+
+		assert.Equal(t, 3, pages)
+		require.Len(t, keys, 25)
+		assert.Equal(t, "item:1", keys[0])
+		assert.Equal(t, "item:25", keys[24])
+	})
+
+	t.Run("cursor in descending key range", func(t *testing.T) {
+		keys, pages := pageThrough(t, func() *lemon.QueryOptions {
+			return lemon.Q().KeyOrder(lemon.DescOrder).KeyRange("item:5", "item:14").Limit(4)
+		})
+
+		assert.Equal(t, 3, pages)
+		assert.Equal(t, []string{
+			"item:14", "item:13", "item:12", "item:11", "item:10",
+			"item:9", "item:8", "item:7", "item:6", "item:5",
+		}, keys)
+	})
+
+	t.Run("cursor over tag query", func(t *testing.T) {
+		keys, pages := pageThrough(t, func() *lemon.QueryOptions {
+			return lemon.Q().HasAllTags(lemon.QT().BoolTagEq("odd", true)).Limit(5)
+		})
+
+		assert.Equal(t, 3, pages)
+		require.Len(t, keys, 13)
+		assert.Equal(t, "item:1", keys[0])
+		assert.Equal(t, "item:25", keys[12])
+	})
+
+	t.Run("last page has no cursor", func(t *testing.T) {
+		page, err := db.FindPage(lemon.Q().Prefix("other").Limit(10))
+		require.NoError(t, err)
+		assert.Len(t, page.Documents, 1)
+		assert.Equal(t, "", page.Next)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := db.FindPage(lemon.Q().Limit(10).After("%%%"))
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/pkg/errors"
 	"io"
 	"strconv"
+	"strings"
 )
 
 type respParser struct {
@@ -75,6 +76,30 @@ func (p *respParser) parse(
 			if err := p.parseFlushAllCommand(cb); err != nil {
 				return p.totalSize, err
 			}
+		case incrCode:
+			if err := p.parseIncrCommand(r, cache, cb); err != nil {
+				return p.totalSize, err
+			}
+		case indexCode:
+			if err := p.parseIndexCommand(r, cb); err != nil {
+				return p.totalSize, err
+			}
+		case dropIndexCode:
+			if err := p.parseDropIndexCommand(r, cb); err != nil {
+				return p.totalSize, err
+			}
+		case textIndexCode:
+			if err := p.parseTextIndexCommand(r, segments, cb); err != nil {
+				return p.totalSize, err
+			}
+		case compositeIndexCode:
+			if err := p.parseCompositeIndexCommand(r, segments, cb); err != nil {
+				return p.totalSize, err
+			}
+		case uniqueTagCode:
+			if err := p.parseUniqueTagCommand(r, segments, cb); err != nil {
+				return p.totalSize, err
+			}
 		}
 
 		p.totalCommands++
@@ -182,6 +207,148 @@ func (p *respParser) parseSetCommand(
 	return cb(ent)
 }
 
+// parseIncrCommand - parses `incr` command from serialization protocol
+func (p *respParser) parseIncrCommand(
+	r *bufio.Reader,
+	cache cache,
+	cb func(d deserializable) error,
+) error {
+	key, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	value, blobOffset, err := p.resolveRespBlob(r)
+	if err != nil {
+		return err
+	}
+
+	pos := position{offset: uint64(blobOffset), size: uint64(len(value))}
+	ent := newEntryWithTags(string(key), pos, nil)
+
+	if p.vls == BufferedLoad {
+		cache.Add(pos.offset, value)
+	} else if p.vls == EagerLoad {
+		ent.value = value
+	}
+
+	return cb(&incrCmd{ent: ent})
+}
+
+// parseIndexCommand - parses field index definition from serialization protocol
+func (p *respParser) parseIndexCommand(r *bufio.Reader, cb func(d deserializable) error) error {
+	name, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	path, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	ft, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	fieldType, err := parseFieldIndexType(string(ft))
+	if err != nil {
+		return errors.Wrapf(ErrCommandInvalid, "line #%d - %s", p.currentLine, err.Error())
+	}
+
+	return cb(&fieldIndex{name: string(name), path: JSONPath(path), ft: fieldType})
+}
+
+// parseTextIndexCommand - parses text index definition from serialization protocol
+func (p *respParser) parseTextIndexCommand(r *bufio.Reader, segments int, cb func(d deserializable) error) error {
+	if segments < 4 {
+		return errors.Wrapf(ErrCommandInvalid, "line #%d - text index definition is incomplete", p.currentLine)
+	}
+
+	name, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	stemming, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	stopWords, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	opts := &TextIndexOptions{Stemming: string(stemming) == "true", StopWords: strings.Fields(string(stopWords))}
+	for i := 4; i < segments; i++ {
+		field, err := p.resolveRespKey(r)
+		if err != nil {
+			return err
+		}
+
+		opts.Fields = append(opts.Fields, JSONPath(field))
+	}
+
+	return cb(newTextIndex(string(name), opts))
+}
+
+// parseCompositeIndexCommand - parses composite index definition from serialization protocol
+func (p *respParser) parseCompositeIndexCommand(r *bufio.Reader, segments int, cb func(d deserializable) error) error {
+	if segments < 3 {
+		return errors.Wrapf(ErrCommandInvalid, "line #%d - composite index definition is incomplete", p.currentLine)
+	}
+
+	name, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	fields := make([]string, 0, segments-2)
+	for i := 2; i < segments; i++ {
+		field, err := p.resolveRespKey(r)
+		if err != nil {
+			return err
+		}
+
+		fields = append(fields, string(field))
+	}
+
+	return cb(newCompositeIndex(string(name), fields))
+}
+
+// parseUniqueTagCommand - parses unique tag definition with an optional key pattern
+func (p *respParser) parseUniqueTagCommand(r *bufio.Reader, segments int, cb func(d deserializable) error) error {
+	if segments != 2 && segments != 3 {
+		return errors.Wrapf(ErrCommandInvalid, "line #%d - unique tag definition is invalid", p.currentLine)
+	}
+
+	name, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	var pattern []byte
+	if segments == 3 {
+		if pattern, err = p.resolveRespKey(r); err != nil {
+			return err
+		}
+	}
+
+	return cb(newUniqueTag(string(name), string(pattern)))
+}
+
+// parseDropIndexCommand - parses removal of field index definition from serialization protocol
+func (p *respParser) parseDropIndexCommand(r *bufio.Reader, cb func(d deserializable) error) error {
+	name, err := p.resolveRespKey(r)
+	if err != nil {
+		return err
+	}
+
+	return cb(&dropIndexCmd{name: string(name)})
+}
+
 // parseDelCommand - parses delete entry command from serialization protocol
 func (p *respParser) parseDelCommand(
 	r *bufio.Reader,
@@ -427,6 +594,30 @@ func (p *respParser) resolveRespCommandCode(r *bufio.Reader) (commandCode, error
 		return untagCode, nil
 	}
 
+	if line[1] == 'i' && line[2] == 'n' && line[3] == 'c' && line[4] == 'r' {
+		return incrCode, nil
+	}
+
+	if line[1] == 'i' && line[2] == 'n' && line[3] == 'd' && line[4] == 'e' && line[5] == 'x' {
+		return indexCode, nil
+	}
+
+	if line[1] == 'd' && line[2] == 'r' && line[3] == 'o' && line[4] == 'p' {
+		return dropIndexCode, nil
+	}
+
+	if line[1] == 't' && line[2] == 'e' && line[3] == 'x' && line[4] == 't' {
+		return textIndexCode, nil
+	}
+
+	if line[1] == 'c' && line[2] == 'o' && line[3] == 'm' && line[4] == 'p' {
+		return compositeIndexCode, nil
+	}
+
+	if line[1] == 'u' && line[2] == 'n' && line[3] == 'i' && line[4] == 'q' {
+		return uniqueTagCode, nil
+	}
+
 	p.cursor -= len(line)
 
 	return invalidCode, errors.Wrapf(
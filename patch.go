@@ -0,0 +1,162 @@
+package lemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Patch applies a JSON merge patch (RFC 7396) to a JSON document,
+// patch can be raw JSON as string or []byte or anything that can be marshaled to JSON object
+func (x *Tx) Patch(key string, patch interface{}) error {
+	var raw []byte
+	switch typedPatch := patch.(type) {
+	case []byte:
+		raw = typedPatch
+	case string:
+		raw = []byte(typedPatch)
+	default:
+		b, err := json.Marshal(patch)
+		if err != nil {
+			return errors.Wrapf(err, "could not marshal patch %+v", patch)
+		}
+		raw = b
+	}
+
+	decodedPatch, err := decodeJSON(raw)
+	if err != nil {
+		return errors.Wrap(err, "patch is not a valid JSON")
+	}
+
+	return x.updateJSON(key, func(v []byte) ([]byte, error) {
+		target, err := decodeJSON(v)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(mergePatch(target, decodedPatch))
+	})
+}
+
+// SetPath sets a value of JSON document at a given path, the path
+// has the same syntax as in JSONValue getters, e.g. `address.city`
+func (x *Tx) SetPath(key, path string, value interface{}) error {
+	return x.updateJSON(key, func(v []byte) ([]byte, error) {
+		result, err := sjson.SetBytes(v, path, value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrJSONPathInvalid, "could not set path %s: %s", path, err.Error())
+		}
+
+		return result, nil
+	})
+}
+
+// DeletePath removes a value from JSON document at a given path,
+// nothing is changed if the path does not exist
+func (x *Tx) DeletePath(key, path string) error {
+	return x.updateJSON(key, func(v []byte) ([]byte, error) {
+		if !gjson.GetBytes(v, path).Exists() {
+			return nil, nil
+		}
+
+		result, err := sjson.DeleteBytes(v, path)
+		if err != nil {
+			return nil, errors.Wrapf(ErrJSONPathInvalid, "could not delete path %s: %s", path, err.Error())
+		}
+
+		return result, nil
+	})
+}
+
+// updateJSON - replaces value of an existing JSON document with the value returned by fn,
+// tags are preserved and `_ua` is updated for documents with timestamps,
+// when fn returns nil value document is left untouched
+func (x *Tx) updateJSON(key string, fn func(v []byte) ([]byte, error)) error {
+	if x.readOnly {
+		return ErrTxIsReadOnly
+	}
+
+	if x.ee == nil {
+		return ErrTxAlreadyClosed
+	}
+
+	existingEnt, err := x.find(key)
+	if err != nil {
+		return err
+	}
+
+	if ct, ok := existingEnt.tags[ContentType]; !ok || ct.data != string(JSON) {
+		return errors.Wrapf(ErrInvalidContentType, "key %s does not contain a JSON document", key)
+	}
+
+	if existingEnt.value == nil {
+		if err := x.ee.LoadEntryValue(existingEnt); err != nil {
+			return err
+		}
+	}
+
+	v, err := fn(existingEnt.value)
+	if err != nil {
+		return err
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	newEnt := newEntry(key, v)
+	newEnt.tags = existingEnt.tags.clone()
+	if _, ok := newEnt.tags[UpdatedAt]; ok {
+		newEnt.tags[UpdatedAt] = &tag{dt: intDataType, data: int(x.ee.Now().UnixMilli())}
+	}
+
+	if err := x.ee.IndexFields(newEnt); err != nil {
+		return err
+	}
+
+	if err := x.ee.CheckUnique(newEnt.key, newEnt.tags); err != nil {
+		return err
+	}
+
+	x.touch(key, existingEnt)
+
+	return x.replace(existingEnt, newEnt)
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	var result interface{}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&result); err != nil {
+		return nil, errors.Wrap(ErrJSONCouldNotBeUnmarshalled, err.Error())
+	}
+
+	return result, nil
+}
+
+// mergePatch - merges patch into target according to RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{}, len(patchObj))
+	}
+
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+
+	return targetObj
+}
@@ -0,0 +1,128 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTx_PartialJSONUpdates(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("config:1", lemon.M{
+		"name":    "main",
+		"version": 12345678901234,
+		"server": lemon.M{
+			"host": "localhost",
+			"port": 8080,
+		},
+		"features": []string{"a", "b"},
+	}, lemon.WithTimestamps(), lemon.WithTags().Str("env", "prod")))
+
+	before, err := db.Get("config:1")
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	t.Run("merge patch", func(t *testing.T) {
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.Patch("config:1", `{"server":{"port":9090,"host":null,"tls":true},"features":["c"]}`)
+		}))
+
+		doc, err := db.Get("config:1")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"name":"main",
+			"version":12345678901234,
+			"server":{"port":9090,"tls":true},
+			"features":["c"]
+		}`, doc.RawString())
+
+		assert.Equal(t, lemon.M{"env": "prod"}, doc.Tags())
+		assert.Equal(t, before.CreatedAt(), doc.CreatedAt())
+		assert.True(t, doc.UpdatedAt().After(before.UpdatedAt()))
+	})
+
+	t.Run("merge patch with lemon.M", func(t *testing.T) {
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.Patch("config:1", lemon.M{"name": "secondary", "version": nil})
+		}))
+
+		doc, err := db.Get("config:1")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name":"secondary","server":{"port":9090,"tls":true},"features":["c"]}`, doc.RawString())
+	})
+
+	t.Run("set and delete path", func(t *testing.T) {
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.SetPath("config:1", "server.host", "example.com"); err != nil {
+				return err
+			}
+
+			if err := tx.SetPath("config:1", "limits.rps", 100); err != nil {
+				return err
+			}
+
+			if err := tx.DeletePath("config:1", "server.tls"); err != nil {
+				return err
+			}
+
+			return tx.DeletePath("config:1", "does.not.exist")
+		}))
+
+		doc, err := db.Get("config:1")
+		require.NoError(t, err)
+		assert.Equal(t, "example.com", doc.JSON().StringOrDefault("server.host", ""))
+		assert.Equal(t, 100, doc.JSON().IntOrDefault("limits.rps", 0))
+		assert.Equal(t, 9090, doc.JSON().IntOrDefault("server.port", 0))
+		assert.False(t, doc.JSON().BoolOrDefault("server.tls", false))
+	})
+
+	t.Run("rollback restores the whole document", func(t *testing.T) {
+		before, err := db.Get("config:1")
+		require.NoError(t, err)
+
+		err = db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.SetPath("config:1", "name", "changed"); err != nil {
+				return err
+			}
+
+			return errors.New("should roll back")
+		})
+
+		require.Error(t, err)
+
+		doc, err := db.Get("config:1")
+		require.NoError(t, err)
+		assert.Equal(t, before.RawString(), doc.RawString())
+	})
+
+	t.Run("only json documents can be patched", func(t *testing.T) {
+		require.NoError(t, db.Insert("str:1", "foo"))
+
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.SetPath("str:1", "foo", "bar")
+		})
+
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrInvalidContentType))
+
+		err = db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.Patch("config:404", lemon.M{"foo": "bar"})
+		})
+
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrKeyDoesNotExist))
+	})
+}
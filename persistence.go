@@ -38,6 +38,12 @@ const (
 	tagCode
 	untagCode
 	flushAllCode
+	incrCode
+	indexCode
+	dropIndexCode
+	textIndexCode
+	compositeIndexCode
+	uniqueTagCode
 )
 
 const (
@@ -220,6 +226,15 @@ func (p *persistence) save(commands []serializable) error {
 			changes = append(changes, ent)
 		}
 
+		// incremented value replaces the previous one in place
+		// so the previous value is no longer needed in cache
+		if incr, ok := cmd.(*incrCmd); ok && p.vls != EagerLoad {
+			changes = append(changes, incr.ent)
+			if p.vls == BufferedLoad && incr.prev.offset > 0 {
+				deletes = append(deletes, &deleteCmd{key: incr.ent.key, pos: incr.prev})
+			}
+		}
+
 		// values are actually stored in cache only for BufferedLoad strategy
 		if del, ok := cmd.(*deleteCmd); ok && p.vls == BufferedLoad {
 			deletes = append(deletes, del)
@@ -368,32 +383,36 @@ func (p *persistence) cacheEntryValue(ent *entry) {
 }
 
 func (p *persistence) loadValueToEntry(ent *entry) error {
+	v, err := p.readValue(ent)
+	if err != nil {
+		return err
+	}
+
+	ent.value = v
+
+	return nil
+}
+
+// readValue - reads the value of the entry from cache or from disk without storing it in the entry,
+// so that concurrent read transactions do not write to shared entries
+func (p *persistence) readValue(ent *entry) ([]byte, error) {
 	if p.vls == EagerLoad {
-		return errors.Wrapf(ErrIllegalStorageCacheCall, "for key %s", ent.key.String())
+		return nil, errors.Wrapf(ErrIllegalStorageCacheCall, "for key %s", ent.key.String())
 	}
 
 	if p.vls == BufferedLoad {
 		if v, ok := p.cache.Get(ent.pos.offset); ok {
-			ent.value = v
-			return nil
+			return v, nil
 		}
 	}
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if _, err := p.f.Seek(int64(ent.pos.offset), 0); err != nil {
-		return errors.Wrapf(
-			ErrStorageFailed,
-			"could not seek to offset %d in file %s: %s",
-			ent.pos.offset, err, err.Error(),
-		)
-	}
-
-	r := bufio.NewReader(p.f)
+	// ReadAt leaves the file cursor at the end of the file, where the next write goes
 	blob := make([]byte, ent.pos.size)
-	if _, err := io.ReadFull(r, blob); err != nil {
-		return errors.Wrapf(
+	if _, err := p.f.ReadAt(blob, int64(ent.pos.offset)); err != nil {
+		return nil, errors.Wrapf(
 			ErrStorageFailed,
 			"could not read blob at offset %d in file %s: %s",
 			ent.pos.offset, err, err.Error(),
@@ -404,9 +423,7 @@ func (p *persistence) loadValueToEntry(ent *entry) error {
 		p.cache.Add(ent.pos.offset, blob)
 	}
 
-	ent.value = blob
-
-	return nil
+	return blob, nil
 }
 
 func (p *persistence) removeValueUnderLock(pos position) {
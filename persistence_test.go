@@ -204,3 +204,24 @@ func Test_parser(t *testing.T) {
 		assert.Nil(t, cmd4.tags)
 	})
 }
+
+func Test_respSerializerPositions(t *testing.T) {
+	rs := &respSerializer{}
+
+	first := newEntry("user:1", []byte(`{"name":"foo"}`))
+	first.tags = newTags()
+	require.NoError(t, first.tags.set("active", true))
+	second := newEntry("user:22", []byte("bar"))
+
+	require.NoError(t, rs.serializeSetCommand(first))
+	require.NoError(t, rs.serializeDelCommand(&deleteCmd{key: newPK("user:3")}))
+	require.NoError(t, rs.serializeTagCommand(&tagCmd{key: newPK("user:1"), tags: first.tags}))
+	require.NoError(t, rs.serializeUntagCommand(&untagCmd{key: newPK("user:1"), names: []string{"active"}}))
+	require.NoError(t, rs.serializeSetCommand(second))
+
+	// positions of values point into the written buffer
+	assert.Equal(t, rs.buf.Len(), rs.pos)
+	for _, ent := range []*entry{first, second} {
+		assert.Equal(t, ent.value, rs.buf.Bytes()[ent.pos.offset:ent.pos.offset+ent.pos.size])
+	}
+}
@@ -17,17 +17,172 @@ func newPK(k string) PK {
 	}
 }
 
+// Match - matches leading segments of the key against segments of a pattern,
+// a segment can be a glob with *, ? and character classes like [a-c] or [!0-9],
+// ** matches any number of segments including none
 func (pk *PK) Match(patterns []string) bool {
 	if len(patterns) == 0 || (len(patterns) == 1 && patterns[0] == "*") {
 		return true
 	}
 
-	for i := 0; i < len(patterns); i++ {
-		if i > len(pk.segments)-1 {
-			return patterns[i] == "*"
+	return matchSegments(patterns, pk.segments)
+}
+
+func matchSegments(patterns, segments []string) bool {
+	for i, p := range patterns {
+		if p == "**" {
+			for j := 0; j <= len(segments); j++ {
+				if matchSegments(patterns[i+1:], segments[j:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		// keys shorter than the pattern match only when the rest of it is wildcards
+		if i > len(segments)-1 {
+			for _, rest := range patterns[i:] {
+				if rest != "*" && rest != "**" {
+					return false
+				}
+			}
+
+			return true
+		}
+
+		if !matchGlob(p, segments[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchGlob - matches a single segment against a glob, * matches any sequence of characters,
+// ? a single character, [...] a character class and \ escapes a special character
+func matchGlob(pattern, s string) bool {
+	if !hasGlobChars(pattern) {
+		return pattern == s
+	}
+
+	p, str := []rune(pattern), []rune(s)
+	pi, si := 0, 0
+	starP, starS := -1, 0
+
+	for si < len(str) {
+		if pi < len(p) {
+			switch p[pi] {
+			case '*':
+				starP, starS = pi, si
+				pi++
+				continue
+			case '?':
+				pi++
+				si++
+				continue
+			case '[':
+				if matched, next, ok := matchClass(p, pi, str[si]); ok {
+					if matched {
+						pi, si = next, si+1
+						continue
+					}
+				} else if str[si] == '[' {
+					pi, si = pi+1, si+1
+					continue
+				}
+			case '\\':
+				if pi+1 < len(p) && p[pi+1] == str[si] {
+					pi, si = pi+2, si+1
+					continue
+				}
+			default:
+				if p[pi] == str[si] {
+					pi++
+					si++
+					continue
+				}
+			}
+		}
+
+		// backtrack to the last star and let it consume one more character
+		if starP < 0 {
+			return false
+		}
+
+		starS++
+		pi, si = starP+1, starS
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+
+	return pi == len(p)
+}
+
+// matchClass - matches a character against a class starting at p[start] == '[',
+// returns the position right after the class, ok is false for a class that is not closed
+func matchClass(p []rune, start int, c rune) (matched bool, next int, ok bool) {
+	i := start + 1
+	negated := i < len(p) && (p[i] == '!' || p[i] == '^')
+	if negated {
+		i++
+	}
+
+	first := true
+	for i < len(p) {
+		if p[i] == ']' && !first {
+			return matched != negated, i + 1, true
+		}
+
+		first = false
+		lo := p[i]
+		if lo == '\\' && i+1 < len(p) {
+			i++
+			lo = p[i]
+		}
+
+		hi := lo
+		if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+			hi = p[i+2]
+			i += 2
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
 		}
 
-		if patterns[i] != pk.segments[i] && patterns[i] != "*" {
+		i++
+	}
+
+	return false, 0, false
+}
+
+func hasGlobChars(s string) bool {
+	return strings.ContainsAny(s, "*?[\\")
+}
+
+// literalSegments - leading segments of a pattern without any wildcards,
+// all keys matching the pattern start with them
+func literalSegments(patterns []string) []string {
+	for i, p := range patterns {
+		if hasGlobChars(p) {
+			return patterns[:i]
+		}
+	}
+
+	return patterns
+}
+
+// hasSegments - key starts with the given segments
+func (pk *PK) hasSegments(segments []string) bool {
+	if len(segments) > len(pk.segments) {
+		return false
+	}
+
+	for i, s := range segments {
+		if pk.segments[i] != s {
 			return false
 		}
 	}
@@ -61,6 +61,54 @@ func TestPK_Match(t *testing.T) {
 	}
 }
 
+func TestPK_Match_Globs(t *testing.T) {
+	tt := []struct {
+		key     string
+		pattern string
+		exp     bool
+	}{
+		{"user:12", "user:12*", true},
+		{"user:123", "user:12*", true},
+		{"user:21", "user:12*", false},
+		{"order:7:items", "order:?:items", true},
+		{"order:77:items", "order:?:items", false},
+		{"bob:profile", "[a-c]*:profile", true},
+		{"dan:profile", "[a-c]*:profile", false},
+		{"dan:profile", "[!a-c]*:profile", true},
+		{"user:a*b", "user:a\\*b", true},
+		{"user:axb", "user:a\\*b", false},
+		{"tenant:1:invoice", "tenant:**:invoice", true},
+		{"tenant:1:2:3:invoice", "tenant:**:invoice", true},
+		{"tenant:invoice", "tenant:**:invoice", true},
+		{"tenant:1:2:receipt", "tenant:**:invoice", false},
+		{"user:1:pets", "user:*", true},
+		{"user", "user:*:**", true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.key+"_"+tc.pattern, func(t *testing.T) {
+			pk := newPK(tc.key)
+			assert.Equal(t, tc.exp, pk.Match(strings.Split(tc.pattern, ":")))
+		})
+	}
+}
+
+func TestQueryOptions_PatternBounds(t *testing.T) {
+	q := Q().Match("tenant:a:*:1*")
+	assert.Equal(t, "tenant:a", q.ascendFrom(""))
+	assert.Equal(t, "tenant:b", q.ascendFrom("tenant:b"))
+
+	last := newPK(q.descendFrom(""))
+	for _, key := range []string{"tenant:a", "tenant:a:orders:1", "tenant:a:zzz:999:1"} {
+		pk := newPK(key)
+		assert.True(t, pk.Less(last), key)
+	}
+	assert.True(t, last.Less(newPK("tenant:b")))
+
+	assert.Equal(t, "", Q().Match("*:a").ascendFrom(""))
+	assert.Equal(t, "", Q().Match("**:a").descendFrom(""))
+}
+
 func Test_KeyAscend(t *testing.T) {
 	t.Run("users", func(t *testing.T) {
 		idx := btree.New(byPrimaryKeys)
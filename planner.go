@@ -0,0 +1,654 @@
+package lemon
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// PlanStrategy - the way a query finds candidate documents
+type PlanStrategy string
+
+const (
+	FullScan      PlanStrategy = "full scan"
+	KeyRangeScan  PlanStrategy = "key range scan"
+	PrefixScan    PlanStrategy = "prefix scan"
+	TagIndexScan  PlanStrategy = "tag index"
+	TagNameScan   PlanStrategy = "tag name scan"
+	TextIndexScan PlanStrategy = "text index"
+
+	CompositeIndexScan PlanStrategy = "composite index"
+)
+
+// Explanation - the plan chosen for query options with estimated and actual numbers of rows
+type Explanation struct {
+	Strategy PlanStrategy
+	// Indexes - tag indexes looked up by the plan in the order they were evaluated
+	Indexes []string
+	// EstimatedRows - number of candidates the planner expected the strategy to produce
+	EstimatedRows int
+	// ScannedRows - number of candidates the strategy actually produced
+	ScannedRows int
+	// ActualRows - number of documents left after all the other filters
+	ActualRows int
+}
+
+type queryPlan struct {
+	strategy  PlanStrategy
+	indexes   []string
+	estimated int
+	scanned   int
+	// tags to be checked on every scanned entry, when keys are scanned instead of tag indexes
+	tags *QueryTags
+	sink *filterEntriesSink
+	scan scanner
+	// ordered - the scan produces entries in the order of sort keys of the query
+	ordered bool
+}
+
+// execute - passes candidates of the plan to the iterator, counting them
+func (p *queryPlan) execute(ctx context.Context, q *QueryOptions, it entryIterator) error {
+	if p.tags != nil {
+		matching := it
+		it = func(ent *entry) bool {
+			if !p.tags.matchEntry(ent) {
+				return true
+			}
+
+			return matching(ent)
+		}
+	}
+
+	candidate := it
+	it = func(ent *entry) bool {
+		p.scanned++
+		return candidate(ent)
+	}
+
+	if p.sink != nil {
+		p.sink.iterate(q, it)
+		return nil
+	}
+
+	// scanned entries are collected and sorted before any of them is passed on
+	if len(q.sortBy) > 0 && !p.ordered {
+		sink := newFilteredEntriesSink(q)
+		if err := p.scan(ctx, q, func(ent *entry) bool {
+			sink.add(ent)
+			return true
+		}); err != nil {
+			return err
+		}
+
+		sink.iterate(q, it)
+		return nil
+	}
+
+	return p.scan(ctx, q, it)
+}
+
+// Explain - runs the query and reports the plan chosen for it,
+// the indexes it used and estimated versus actual numbers of rows
+func (x *Tx) Explain(qo *QueryOptions) (*Explanation, error) {
+	actual := 0
+	p, err := x.executePlan(x.ctx, qo, func(*entry) bool {
+		actual++
+		return true
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]string, len(p.indexes))
+	copy(indexes, p.indexes)
+
+	return &Explanation{
+		Strategy:      p.strategy,
+		Indexes:       indexes,
+		EstimatedRows: p.estimated,
+		ScannedRows:   p.scanned,
+		ActualRows:    actual,
+	}, nil
+}
+
+// Plan - chooses the cheapest way to find entries matching query options,
+// tag conditions are estimated from cardinalities of tag indexes and compared to
+// the size of the key range, estimate makes plans without tags count their keys too
+func (ee *defaultEngine) Plan(q *QueryOptions, estimate bool) (*queryPlan, error) {
+	if ee.closed {
+		return nil, ErrDatabaseAlreadyClosed
+	}
+
+	if q.byTagName != "" {
+		return ee.planTagNameScan(q)
+	}
+
+	if q.text != nil {
+		return ee.planTextSearch(q)
+	}
+
+	if len(q.sortBy) > 0 {
+		if p, err := ee.planOrderedCompositeScan(q); err != nil || p != nil {
+			return p, err
+		}
+
+		if p, err := ee.planSortedTagScan(q); err != nil || p != nil {
+			return p, err
+		}
+	}
+
+	sc, err := ee.ChooseBestScanner(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryPlan{strategy: keyScanStrategy(q), scan: sc}
+
+	if q.tags == nil || q.tags.empty() {
+		if estimate {
+			p.estimated = ee.countKeys(q, -1)
+		}
+
+		return p, nil
+	}
+
+	m := newTagMatcher(ee.tags, ee.allEntries, ee.pks.Len())
+
+	tagRows, err := m.estimate(q.tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// a composite index matches several conditions at once
+	composite := ee.planCompositeScan(q, tagRows)
+	if composite != nil {
+		tagRows = composite.estimated
+	}
+
+	// checking tags of every scanned entry is cheaper than collecting and sorting
+	// entries from tag indexes when the key range is narrower than the tags
+	// or when the tags match most of the documents anyway
+	if p.strategy != FullScan {
+		if keyRows := ee.countKeys(q, tagRows); keyRows <= tagRows {
+			p.tags, p.estimated = q.tags, keyRows
+			return p, nil
+		}
+	} else if tagRows*2 > m.total {
+		p.tags, p.estimated = q.tags, m.total
+		return p, nil
+	}
+
+	if composite != nil {
+		return composite, nil
+	}
+
+	matched, err := m.match(q.tags)
+	if err != nil {
+		return nil, err
+	}
+
+	fes := newFilteredEntriesSink(q)
+	fes.addMap(matched)
+
+	return &queryPlan{strategy: TagIndexScan, indexes: m.used, estimated: tagRows, sink: fes}, nil
+}
+
+// planTagNameScan - collects entries having a tag in the order of its values
+func (ee *defaultEngine) planTagNameScan(q *QueryOptions) (*queryPlan, error) {
+	idx, ok := ee.tags.data[q.byTagName]
+	if !ok {
+		return nil, errors.Wrapf(ErrTagKeyNotFound, "%s", q.byTagName)
+	}
+
+	p := &queryPlan{strategy: TagNameScan, indexes: []string{q.byTagName}, sink: newFilteredEntriesSink(q)}
+
+	walk := idx.btr.Ascend
+	if q.order == DescOrder {
+		walk = idx.btr.Descend
+	}
+
+	walk(nil, func(item interface{}) bool {
+		ents := item.(entryContainer).getEntries()
+		p.estimated += len(ents)
+		p.sink.addMap(ents)
+		return true
+	})
+
+	return p, nil
+}
+
+// planSortedTagScan - walks the tag index of the first sort key in order of its values, so that
+// a limit stops the query early, unless a key range, a prefix or selective tags narrow candidates
+// down enough to collect and sort them instead
+func (ee *defaultEngine) planSortedTagScan(q *QueryOptions) (*queryPlan, error) {
+	name := q.sortBy[0].tag
+	idx, ok := ee.tags.data[name]
+	if name == "" || !ok || keyScanStrategy(q) != FullScan {
+		return nil, nil
+	}
+
+	total := ee.pks.Len()
+	p := &queryPlan{
+		strategy:  TagNameScan,
+		indexes:   []string{name},
+		estimated: total,
+		scan:      ee.sortedTagScan(idx, name),
+		ordered:   true,
+	}
+
+	if q.tags != nil && !q.tags.empty() {
+		m := newTagMatcher(ee.tags, ee.allEntries, total)
+		tagRows, err := m.estimate(q.tags)
+		if err != nil {
+			return nil, err
+		}
+
+		if tagRows*2 <= total {
+			return nil, nil
+		}
+
+		p.tags = q.tags
+	}
+
+	return p, nil
+}
+
+// sortedTagScan - entries sharing a value are sorted by the rest of sort keys,
+// entries without the tag come after all the values
+func (ee *defaultEngine) sortedTagScan(idx *index, name string) scanner {
+	return func(ctx context.Context, q *QueryOptions, it entryIterator) error {
+		rest := q.sortBy[1:]
+		stopped := false
+
+		emit := func(ents []*entry) bool {
+			sort.Slice(ents, func(i, j int) bool {
+				return lessBySortKeys(rest, ents[i], ents[j])
+			})
+
+			for _, ent := range ents {
+				if ctx.Err() != nil || !it(ent) {
+					stopped = true
+					return false
+				}
+			}
+
+			return true
+		}
+
+		walk := idx.btr.Ascend
+		if q.sortBy[0].order == DescOrder {
+			walk = idx.btr.Descend
+		}
+
+		walk(nil, func(item interface{}) bool {
+			found := item.(entryContainer).getEntries()
+			ents := make([]*entry, 0, len(found))
+			for _, ent := range found {
+				if q.matchesKey(ent.key) {
+					ents = append(ents, ent)
+				}
+			}
+
+			return emit(ents)
+		})
+
+		if stopped {
+			return nil
+		}
+
+		var missing []*entry
+		ee.pks.Ascend(nil, func(item interface{}) bool {
+			ent := item.(*entry)
+			if _, ok := ent.tags[name]; !ok && q.matchesKey(ent.key) {
+				missing = append(missing, ent)
+			}
+
+			return true
+		})
+
+		emit(missing)
+		return nil
+	}
+}
+
+func keyScanStrategy(q *QueryOptions) PlanStrategy {
+	if q.keyRange != nil {
+		return KeyRangeScan
+	}
+
+	if q.prefix != "" {
+		return PrefixScan
+	}
+
+	return FullScan
+}
+
+// countKeys - counts keys a scan of query options walks through,
+// counting stops as soon as bound is exceeded unless it is negative
+func (ee *defaultEngine) countKeys(q *QueryOptions, bound int) int {
+	count := 0
+	counter := func(item interface{}) bool {
+		count++
+		return bound < 0 || count <= bound
+	}
+
+	switch {
+	case q.keyRange != nil:
+		ascendRange(ee.pks, &entry{key: newPK(q.keyRange.From)}, &entry{key: newPK(q.keyRange.To)}, counter)
+	case q.prefix != "":
+		ee.pks.Ascend(&entry{key: newPK(q.prefix)}, counter)
+	default:
+		return ee.pks.Len()
+	}
+
+	return count
+}
+
+// tagMatcher - evaluates query tags with set operations over tag indexes,
+// operands of AND groups are intersected starting with the most selective one
+type tagMatcher struct {
+	ti        *tagIndex
+	all       func() entrySet
+	total     int
+	estimates map[interface{}]int
+	// tag indexes in the order they were looked up
+	used []string
+}
+
+func newTagMatcher(ti *tagIndex, all func() entrySet, total int) *tagMatcher {
+	return &tagMatcher{
+		ti:        ti,
+		all:       all,
+		total:     total,
+		estimates: make(map[interface{}]int),
+	}
+}
+
+// tagOperand - a condition or a nested group of a query tags group
+type tagOperand struct {
+	c    *tagCondition
+	g    *QueryTags
+	rows int
+}
+
+func (o tagOperand) negation() bool {
+	return o.g != nil && o.g.op == notOp
+}
+
+// operands - conditions and groups of query tags with their estimated rows, the cheapest first
+func (m *tagMatcher) operands(qt *QueryTags) ([]tagOperand, error) {
+	ops := make([]tagOperand, 0, len(qt.conditions)+len(qt.groups))
+
+	for i := range qt.conditions {
+		c := &qt.conditions[i]
+		rows, ok := m.estimates[c]
+		if !ok {
+			var err error
+			if rows, err = m.ti.estimateCondition(*c); err != nil {
+				return nil, err
+			}
+
+			m.estimates[c] = rows
+		}
+
+		ops = append(ops, tagOperand{c: c, rows: rows})
+	}
+
+	for _, g := range qt.groups {
+		// empty groups narrow down nothing in AND groups
+		if qt.op == andOp && g.op != notOp && g.empty() {
+			continue
+		}
+
+		rows, err := m.estimate(g)
+		if err != nil {
+			return nil, err
+		}
+
+		ops = append(ops, tagOperand{g: g, rows: rows})
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].rows < ops[j].rows
+	})
+
+	return ops, nil
+}
+
+// estimate - upper bound of entries matching query tags
+func (m *tagMatcher) estimate(qt *QueryTags) (int, error) {
+	if rows, ok := m.estimates[qt]; ok {
+		return rows, nil
+	}
+
+	ops, err := m.operands(qt)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int
+
+	switch qt.op {
+	case orOp:
+		for _, o := range ops {
+			rows += o.rows
+		}
+
+		if rows > m.total {
+			rows = m.total
+		}
+	case notOp:
+		matched, err := m.estimate(&QueryTags{op: andOp, conditions: qt.conditions, groups: qt.groups})
+		if err != nil {
+			return 0, err
+		}
+
+		rows = m.total - matched
+	default:
+		rows = m.total
+		for _, o := range ops {
+			if !o.negation() && o.rows < rows {
+				rows = o.rows
+			}
+		}
+	}
+
+	m.estimates[qt] = rows
+
+	return rows, nil
+}
+
+// match - finds entries matching query tags, all is used to resolve negations
+// that are not narrowed by other conditions
+func (m *tagMatcher) match(qt *QueryTags) (entrySet, error) {
+	if qt.op == notOp {
+		matched, err := m.match(&QueryTags{op: andOp, conditions: qt.conditions, groups: qt.groups})
+		if err != nil {
+			return nil, err
+		}
+
+		return m.all().difference(matched), nil
+	}
+
+	ops, err := m.operands(qt)
+	if err != nil {
+		return nil, err
+	}
+
+	if qt.op == orOp {
+		result := make(entrySet)
+		for _, o := range ops {
+			matched, err := m.matchOperand(o)
+			if err != nil {
+				return nil, err
+			}
+
+			result.union(matched)
+		}
+
+		return result, nil
+	}
+
+	var result entrySet
+	var negations []*QueryTags
+
+	for _, o := range ops {
+		// negations narrow down the result at the very end
+		if o.negation() {
+			negations = append(negations, o.g)
+			continue
+		}
+
+		// nothing is left to intersect with
+		if result != nil && len(result) == 0 {
+			return result, nil
+		}
+
+		matched, err := m.matchOperand(o)
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil {
+			result = matched
+		} else {
+			result = result.intersect(matched)
+		}
+	}
+
+	if result == nil {
+		result = m.all()
+	}
+
+	for _, n := range negations {
+		if len(result) == 0 {
+			break
+		}
+
+		matched, err := m.match(&QueryTags{op: andOp, conditions: n.conditions, groups: n.groups})
+		if err != nil {
+			return nil, err
+		}
+
+		result = result.difference(matched)
+	}
+
+	return result, nil
+}
+
+func (m *tagMatcher) matchOperand(o tagOperand) (entrySet, error) {
+	if o.g != nil {
+		return m.match(o.g)
+	}
+
+	m.use(o.c.key.name)
+
+	return m.ti.matchCondition(*o.c)
+}
+
+func (m *tagMatcher) use(name string) {
+	for _, used := range m.used {
+		if used == name {
+			return
+		}
+	}
+
+	m.used = append(m.used, name)
+}
+
+// matchEntry - evaluates query tags against tags of a single entry the same way tag indexes do
+func (qt *QueryTags) matchEntry(ent *entry) bool {
+	switch qt.op {
+	case orOp:
+		for _, c := range qt.conditions {
+			if c.matchesTag(ent.tags[c.key.name]) {
+				return true
+			}
+		}
+
+		for _, g := range qt.groups {
+			if g.matchEntry(ent) {
+				return true
+			}
+		}
+
+		return false
+	case notOp:
+		return !(&QueryTags{op: andOp, conditions: qt.conditions, groups: qt.groups}).matchEntry(ent)
+	}
+
+	for _, c := range qt.conditions {
+		if !c.matchesTag(ent.tags[c.key.name]) {
+			return false
+		}
+	}
+
+	for _, g := range qt.groups {
+		if !g.matchEntry(ent) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesTag - compares a tag with the condition using the ordering of its tag index,
+// values of other types never match
+func (c tagCondition) matchesTag(t *tag) bool {
+	if t == nil {
+		return false
+	}
+
+	value, _, err := newEntryContainer(t.data)
+	if err != nil {
+		return false
+	}
+
+	c = c.coerce(t.dt)
+
+	less := lessByIndexType(t.dt)
+	pivot := func(v interface{}) (entryContainer, bool) {
+		p, dt, err := newEntryContainer(v)
+		return p, err == nil && dt == t.dt
+	}
+
+	compare := func(v interface{}, matches func(p entryContainer) bool) bool {
+		p, ok := pivot(v)
+		return ok && matches(p)
+	}
+
+	switch c.key.comp {
+	case equal:
+		return compare(c.value, func(p entryContainer) bool { return !less(value, p) && !less(p, value) })
+	case greaterThan:
+		return compare(c.value, func(p entryContainer) bool { return less(p, value) })
+	case greaterThanOrEqual:
+		return compare(c.value, func(p entryContainer) bool { return !less(value, p) })
+	case lessThan:
+		return compare(c.value, func(p entryContainer) bool { return less(value, p) })
+	case lessThanOrEqual:
+		return compare(c.value, func(p entryContainer) bool { return !less(p, value) })
+	case between:
+		return compare(c.value, func(p entryContainer) bool { return !less(value, p) }) &&
+			compare(c.upper, func(p entryContainer) bool { return !less(p, value) })
+	case prefix:
+		s, isStr := t.data.(string)
+		p, ok := c.value.(string)
+		return isStr && ok && strings.HasPrefix(s, p)
+	case exists:
+		return true
+	case ofType:
+		tt, _ := c.value.(TagType)
+		dt, ok := tt.indexType()
+		return ok && dt == t.dt
+	case in:
+		for _, v := range c.values {
+			if compare(v, func(p entryContainer) bool { return !less(value, p) && !less(p, value) }) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
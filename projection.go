@@ -0,0 +1,109 @@
+package lemon
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"strings"
+)
+
+// Select - found JSON documents contain only the given paths, e.g. `Select("id", "name", "address.city")`,
+// values of the paths are also available through Document.Projected, other documents are returned without values
+func (qo *QueryOptions) Select(paths ...string) *QueryOptions {
+	qo.selectPaths = append(qo.selectPaths, paths...)
+	return qo
+}
+
+// SelectTags - values of the given tags, meta tags included, are added to Document.Projected
+// under their names, a selected path with the same name takes precedence
+func (qo *QueryOptions) SelectTags(names ...string) *QueryOptions {
+	qo.selectTags = append(qo.selectTags, names...)
+	return qo
+}
+
+func (qo *QueryOptions) projects() bool {
+	return len(qo.selectPaths) > 0 || len(qo.selectTags) > 0
+}
+
+func (qo *QueryOptions) validateProjection() error {
+	if len(qo.selectPaths) > 0 && qo.withoutValues {
+		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine select and without values options")
+	}
+
+	for _, path := range qo.selectPaths {
+		if strings.TrimSpace(path) == "" {
+			return errors.Wrap(ErrInvalidQueryOptions, "selected path cannot be empty")
+		}
+	}
+
+	for _, name := range qo.selectTags {
+		if name == "" {
+			return errors.Wrap(ErrInvalidQueryOptions, "selected tag name cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+// newDocumentFromQuery - document of query results, projected when query options select paths or tags,
+// selected paths are copied straight from the value of the entry instead of the whole value,
+// selected tags do not need the value, so they are projected for documents without values as well
+func newDocumentFromQuery(q *QueryOptions, ent *entry) *Document {
+	if q != nil && q.withoutValues && !q.projects() {
+		return newMetaDocumentFromEntry(ent)
+	}
+
+	if q == nil || !q.projects() {
+		return newDocumentFromEntry(ent)
+	}
+
+	var d *Document
+	if len(q.selectPaths) == 0 && !q.withoutValues {
+		d = newDocumentFromEntry(ent)
+	} else {
+		d = newMetaDocumentFromEntry(ent)
+	}
+
+	d.projected = make(M, len(q.selectPaths)+len(q.selectTags))
+
+	if len(q.selectPaths) > 0 && isJSONEntry(ent) {
+		value := []byte("{}")
+		for _, path := range q.selectPaths {
+			r := gjson.GetBytes(ent.value, path)
+			if !r.Exists() {
+				continue
+			}
+
+			projected, err := sjson.SetRawBytes(value, path, []byte(r.Raw))
+			if err != nil {
+				continue
+			}
+
+			value = projected
+			d.projected[path] = projectedValue(r)
+		}
+
+		d.value = value
+	}
+
+	for _, name := range q.selectTags {
+		if _, ok := d.projected[name]; ok {
+			continue
+		}
+
+		if t, ok := ent.tags[name]; ok {
+			d.projected[name] = t.data
+		}
+	}
+
+	return d
+}
+
+// projectedValue - integers are kept as int the same way int tags are, so that M getters work with them
+func projectedValue(r gjson.Result) interface{} {
+	if r.Type == gjson.Number && !strings.ContainsAny(r.Raw, ".eE") {
+		return int(r.Int())
+	}
+
+	return r.Value()
+}
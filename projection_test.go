@@ -0,0 +1,123 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestQueryOptions_Select(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("user:1", lemon.M{
+		"id":      1,
+		"name":    "Alice",
+		"bio":     "a very long biography",
+		"score":   4.5,
+		"address": lemon.M{"city": "Budapest", "street": "Andrassy ut"},
+		"roles":   []string{"admin"},
+	}, lemon.WithTags().Str("team", "core").Bool("active", true)))
+	require.NoError(t, db.Insert("user:2", lemon.M{"id": 2, "name": "Bob"}, lemon.WithTags().Str("team", "ops")))
+	require.NoError(t, db.Insert("user:3", "plain text"))
+
+	t.Run("selected paths only", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Match("user:*").Select("id", "name", "address.city", "roles", "score"))
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+
+		assert.JSONEq(t, `{"id":1,"name":"Alice","address":{"city":"Budapest"},"roles":["admin"],"score":4.5}`, docs[0].RawString())
+		assert.Equal(t, lemon.M{
+			"id":           1,
+			"name":         "Alice",
+			"address.city": "Budapest",
+			"roles":        []interface{}{"admin"},
+			"score":        4.5,
+		}, docs[0].Projected())
+		assert.Equal(t, "Budapest", docs[0].Projected().String("address.city"))
+		assert.Equal(t, lemon.M{"team": "core", "active": true}, docs[0].Tags())
+		assert.True(t, docs[0].IsJSON())
+
+		assert.JSONEq(t, `{"id":2,"name":"Bob"}`, docs[1].RawString())
+		assert.Equal(t, lemon.M{"id": 2, "name": "Bob"}, docs[1].Projected())
+
+		assert.Empty(t, docs[2].Value())
+		assert.Equal(t, lemon.M{}, docs[2].Projected())
+	})
+
+	t.Run("selected tags", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Match("user:*").Select("name").SelectTags("team", lemon.ContentType, "missing").Limit(2))
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+
+		assert.Equal(t, lemon.M{"name": "Alice", "team": "core", lemon.ContentType: "json"}, docs[0].Projected())
+		assert.Equal(t, lemon.M{"name": "Bob", "team": "ops", lemon.ContentType: "json"}, docs[1].Projected())
+	})
+
+	t.Run("tags without paths keep values", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Match("user:2").SelectTags("team"))
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+
+		assert.JSONEq(t, `{"id":2,"name":"Bob"}`, docs[0].RawString())
+		assert.Equal(t, lemon.M{"team": "ops"}, docs[0].Projected())
+	})
+
+	t.Run("tags without values", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Match("user:*").WithoutValues().SelectTags("team").Limit(2))
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+
+		assert.Empty(t, docs[0].Value())
+		assert.Equal(t, lemon.M{"team": "core"}, docs[0].Projected())
+		assert.Equal(t, lemon.M{"team": "ops"}, docs[1].Projected())
+
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Match("user:2").WithoutValues().SelectTags("team"))
+			defer it.Close()
+
+			require.True(t, it.Next())
+			assert.Empty(t, it.Document().Value())
+			assert.Equal(t, lemon.M{"team": "ops"}, it.Document().Projected())
+			return it.Err()
+		}))
+	})
+
+	t.Run("not projected", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Match("user:2"))
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Nil(t, docs[0].Projected())
+	})
+
+	t.Run("iterator", func(t *testing.T) {
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Match("user:*").Select("address.city").Limit(1))
+			defer it.Close()
+
+			require.True(t, it.Next())
+			assert.JSONEq(t, `{"address":{"city":"Budapest"}}`, it.Document().RawString())
+			return it.Err()
+		}))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, q := range []*lemon.QueryOptions{
+			lemon.Q().Select("name").WithoutValues(),
+			lemon.Q().Select(""),
+			lemon.Q().SelectTags(""),
+		} {
+			_, err := db.Find(q)
+			assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+		}
+	})
+}
@@ -1,11 +1,14 @@
 package lemon
 
 import (
+	"encoding/base64"
 	"github.com/pkg/errors"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 )
 
 var (
@@ -22,6 +25,13 @@ const (
 	equal comparator = iota
 	greaterThan
 	lessThan
+	greaterThanOrEqual
+	lessThanOrEqual
+	between
+	prefix
+	in
+	exists
+	ofType
 )
 
 type tagKey struct {
@@ -29,154 +39,262 @@ type tagKey struct {
 	comp comparator
 }
 
-type matcher func(ent *entry) bool
+type groupOp uint8
 
-func (tk *tagKey) getStringMatcher(v string) matcher {
-	return func(ent *entry) bool {
-		t, ok := ent.tags[tk.name]
-		if !ok {
-			return false
-		}
+const (
+	andOp groupOp = iota
+	orOp
+	notOp
+)
 
-		sv, ok := t.data.(string)
-		if !ok {
-			return false
-		}
+type tagCondition struct {
+	key   tagKey
+	value interface{}
+	// upper bound for between
+	upper interface{}
+	// values for in
+	values []interface{}
+	// values are literals of the query language, where int literals stand for floats as well
+	untyped bool
+}
+
+// coerce - int literals of the query language are compared with tags of a float index as floats
+func (c tagCondition) coerce(dt indexType) tagCondition {
+	if !c.untyped || dt != floatDataType {
+		return c
+	}
 
-		if tk.comp == equal {
-			return sv == v
-		} else if tk.comp == greaterThan {
-			return sv > v
-		} else if tk.comp == lessThan {
-			return sv < v
+	toFloat := func(v interface{}) interface{} {
+		if n, ok := v.(int); ok {
+			return float64(n)
 		}
 
-		return false
+		return v
 	}
-}
 
-func (tk *tagKey) getFloatMatcher(v float64) matcher {
-	return func(ent *entry) bool {
-		t, ok := ent.tags[tk.name]
-		if !ok {
-			return false
+	c.value, c.upper = toFloat(c.value), toFloat(c.upper)
+	if c.values != nil {
+		values := make([]interface{}, len(c.values))
+		for i, v := range c.values {
+			values[i] = toFloat(v)
 		}
 
-		sv, ok := t.data.(float64)
-		if !ok {
-			return false
-		}
+		c.values = values
+	}
 
-		if tk.comp == equal {
-			return sv == v
-		} else if tk.comp == greaterThan {
-			return sv > v
-		} else if tk.comp == lessThan {
-			return sv < v
-		}
+	return c
+}
 
-		return false
+// TagType - type of tag values, see TagOfType
+type TagType string
+
+const (
+	IntTagType   TagType = "int"
+	FloatTagType TagType = "float"
+	StrTagType   TagType = "str"
+	BoolTagType  TagType = "bool"
+)
+
+func (tt TagType) indexType() (indexType, bool) {
+	switch tt {
+	case IntTagType:
+		return intDataType, true
+	case FloatTagType:
+		return floatDataType, true
+	case StrTagType:
+		return strDataType, true
+	case BoolTagType:
+		return boolDataType, true
 	}
+
+	return nilDataType, false
 }
 
-func (tk *tagKey) getIntMatcher(v int) matcher {
-	return func(ent *entry) bool {
-		t, ok := ent.tags[tk.name]
-		if !ok {
-			return false
-		}
+// QueryTags - a group of tag conditions and nested groups,
+// created by QT() all of them must match, see also Or, And and Not
+type QueryTags struct {
+	op         groupOp
+	conditions []tagCondition
+	groups     []*QueryTags
+}
 
-		sv, ok := t.data.(int)
-		if !ok {
-			return false
-		}
+func QT() *QueryTags {
+	return &QueryTags{op: andOp}
+}
 
-		switch tk.comp {
-		case equal:
-			return sv == v
-		case greaterThan:
-			return sv > v
-		case lessThan:
-			return sv < v
-		}
+// And - matches documents matching all the given groups
+func And(qts ...*QueryTags) *QueryTags {
+	return &QueryTags{op: andOp, groups: qts}
+}
 
-		return false
-	}
+// Or - matches documents matching at least one of the given groups
+func Or(qts ...*QueryTags) *QueryTags {
+	return &QueryTags{op: orOp, groups: qts}
 }
 
-func (tk *tagKey) getBoolMatcher(v bool) matcher {
-	return func(ent *entry) bool {
-		t, ok := ent.tags[tk.name]
-		if !ok {
-			return false
-		}
+// Not - matches documents that do not match the given group
+func Not(qt *QueryTags) *QueryTags {
+	return &QueryTags{op: notOp, groups: []*QueryTags{qt}}
+}
+
+// Group - nests groups into query tags e.g. QT().BoolTagEq("active", true).Group(Or(...))
+func (qt *QueryTags) Group(qts ...*QueryTags) *QueryTags {
+	qt.groups = append(qt.groups, qts...)
+	return qt
+}
+
+func (qt *QueryTags) empty() bool {
+	if len(qt.conditions) > 0 {
+		return false
+	}
 
-		bv, ok := t.data.(bool)
-		if !ok {
+	for _, g := range qt.groups {
+		if !g.empty() {
 			return false
 		}
+	}
 
-		if tk.comp == equal {
-			return bv == v
-		} else if tk.comp == greaterThan {
-			return bv && !v
-		} else if tk.comp == lessThan {
-			return !bv && v
-		}
+	return true
+}
 
-		return false
-	}
+func (qt *QueryTags) add(name string, comp comparator, value interface{}) *QueryTags {
+	qt.conditions = append(qt.conditions, tagCondition{key: tagKey{name: name, comp: comp}, value: value})
+	return qt
 }
 
-type QueryTags struct {
-	booleans map[tagKey]bool
-	strings  map[tagKey]string
-	integers map[tagKey]int
-	floats   map[tagKey]float64
+func (qt *QueryTags) between(name string, from, to interface{}) *QueryTags {
+	qt.conditions = append(qt.conditions, tagCondition{
+		key:   tagKey{name: name, comp: between},
+		value: from,
+		upper: to,
+	})
+
+	return qt
 }
 
-func QT() *QueryTags {
-	return &QueryTags{
-		booleans: make(map[tagKey]bool),
-		strings:  make(map[tagKey]string),
-		integers: make(map[tagKey]int),
-		floats:   make(map[tagKey]float64),
-	}
+func (qt *QueryTags) in(name string, values []interface{}) *QueryTags {
+	qt.conditions = append(qt.conditions, tagCondition{key: tagKey{name: name, comp: in}, values: values})
+	return qt
 }
 
 func (qt *QueryTags) BoolTagEq(name string, value bool) *QueryTags {
-	qt.booleans[tagKey{name: name, comp: equal}] = value
-	return qt
+	return qt.add(name, equal, value)
+}
+
+func (qt *QueryTags) BoolTagIn(name string, values ...bool) *QueryTags {
+	vs := make([]interface{}, len(values))
+	for i := range values {
+		vs[i] = values[i]
+	}
+
+	return qt.in(name, vs)
 }
 
 func (qt *QueryTags) StrTagEq(name, value string) *QueryTags {
-	qt.strings[tagKey{name: name, comp: equal}] = value
-	return qt
+	return qt.add(name, equal, value)
+}
+
+func (qt *QueryTags) StrTagGt(name, value string) *QueryTags {
+	return qt.add(name, greaterThan, value)
+}
+
+func (qt *QueryTags) StrTagGte(name, value string) *QueryTags {
+	return qt.add(name, greaterThanOrEqual, value)
+}
+
+func (qt *QueryTags) StrTagLt(name, value string) *QueryTags {
+	return qt.add(name, lessThan, value)
+}
+
+func (qt *QueryTags) StrTagLte(name, value string) *QueryTags {
+	return qt.add(name, lessThanOrEqual, value)
+}
+
+// StrTagBetween - matches string tags from from to to inclusive
+func (qt *QueryTags) StrTagBetween(name, from, to string) *QueryTags {
+	return qt.between(name, from, to)
+}
+
+// StrTagPrefix - matches string tags starting with prefix
+func (qt *QueryTags) StrTagPrefix(name, p string) *QueryTags {
+	return qt.add(name, prefix, p)
+}
+
+func (qt *QueryTags) StrTagIn(name string, values ...string) *QueryTags {
+	vs := make([]interface{}, len(values))
+	for i := range values {
+		vs[i] = values[i]
+	}
+
+	return qt.in(name, vs)
 }
 
 func (qt *QueryTags) IntTagEq(name string, value int) *QueryTags {
-	qt.integers[tagKey{name: name, comp: equal}] = value
-	return qt
+	return qt.add(name, equal, value)
 }
 
 func (qt *QueryTags) IntTagGt(name string, value int) *QueryTags {
-	qt.integers[tagKey{name: name, comp: greaterThan}] = value
-	return qt
+	return qt.add(name, greaterThan, value)
+}
+
+func (qt *QueryTags) IntTagGte(name string, value int) *QueryTags {
+	return qt.add(name, greaterThanOrEqual, value)
 }
 
 func (qt *QueryTags) IntTagLt(name string, value int) *QueryTags {
-	qt.integers[tagKey{name: name, comp: lessThan}] = value
-	return qt
+	return qt.add(name, lessThan, value)
+}
+
+func (qt *QueryTags) IntTagLte(name string, value int) *QueryTags {
+	return qt.add(name, lessThanOrEqual, value)
+}
+
+// IntTagBetween - matches int tags from from to to inclusive
+func (qt *QueryTags) IntTagBetween(name string, from, to int) *QueryTags {
+	return qt.between(name, from, to)
+}
+
+func (qt *QueryTags) IntTagIn(name string, values ...int) *QueryTags {
+	vs := make([]interface{}, len(values))
+	for i := range values {
+		vs[i] = values[i]
+	}
+
+	return qt.in(name, vs)
 }
 
 func (qt *QueryTags) FloatTagEq(name string, value float64) *QueryTags {
-	qt.floats[tagKey{name: name, comp: equal}] = value
-	return qt
+	return qt.add(name, equal, value)
 }
 
 func (qt *QueryTags) FloatTagGt(name string, value float64) *QueryTags {
-	qt.floats[tagKey{name: name, comp: greaterThan}] = value
-	return qt
+	return qt.add(name, greaterThan, value)
+}
+
+func (qt *QueryTags) FloatTagGte(name string, value float64) *QueryTags {
+	return qt.add(name, greaterThanOrEqual, value)
+}
+
+func (qt *QueryTags) FloatTagLt(name string, value float64) *QueryTags {
+	return qt.add(name, lessThan, value)
+}
+
+func (qt *QueryTags) FloatTagLte(name string, value float64) *QueryTags {
+	return qt.add(name, lessThanOrEqual, value)
+}
+
+// FloatTagBetween - matches float tags from from to to inclusive
+func (qt *QueryTags) FloatTagBetween(name string, from, to float64) *QueryTags {
+	return qt.between(name, from, to)
+}
+
+func (qt *QueryTags) FloatTagIn(name string, values ...float64) *QueryTags {
+	vs := make([]interface{}, len(values))
+	for i := range values {
+		vs[i] = values[i]
+	}
+
+	return qt.in(name, vs)
 }
 
 func (qt *QueryTags) CreatedAfter(t time.Time) *QueryTags {
@@ -203,6 +321,22 @@ func (qt *QueryTags) ContentTypeIs(t ContentTypeIdentifier) *QueryTags {
 	return qt.StrTagEq(ContentType, string(t))
 }
 
+// HasTag - matches documents having a tag with the given name,
+// meta tags like ContentType or ExpiresAt included
+func (qt *QueryTags) HasTag(name string) *QueryTags {
+	return qt.add(name, exists, nil)
+}
+
+// MissingTag - matches documents without a tag with the given name
+func (qt *QueryTags) MissingTag(name string) *QueryTags {
+	return qt.Group(Not(QT().HasTag(name)))
+}
+
+// TagOfType - matches documents having a tag with the given name and of the given type
+func (qt *QueryTags) TagOfType(name string, tt TagType) *QueryTags {
+	return qt.add(name, ofType, tt)
+}
+
 type Order string
 
 const (
@@ -215,19 +349,82 @@ type QueryOptions struct {
 	keyRange  *KeyRange
 	prefix    string
 	patterns  []string
-	allTags   *QueryTags
+	keyRegex  *regexp.Regexp
+	regexErr  error
+	tags      *QueryTags
 	byTagName string
+	limit     int
+	offset    int
+	after     *PK
+	cursorErr error
+	where     []wherePredicate
+	text      *textQuery
+	sortBy    []sortKey
+
+	withoutValues bool
+	selectPaths   []string
+	selectTags    []string
+	populate      []string
+}
+
+// sortKey - a tag or the primary key, when the tag is empty, to order documents by
+type sortKey struct {
+	tag   string
+	order Order
+}
+
+// textQuery - words to search for in a text index
+type textQuery struct {
+	index string
+	query string
 }
 
 func (qo *QueryOptions) needSortingByKeys() bool {
-	return qo.byTagName == ""
+	return qo.byTagName == "" && qo.text == nil && len(qo.sortBy) == 0
+}
+
+// MatchText - documents containing any word of the text in the text index,
+// they are ordered by relevance (BM25) instead of keys
+func (qo *QueryOptions) MatchText(index, text string) *QueryOptions {
+	qo.text = &textQuery{index: index, query: text}
+	return qo
 }
 
+// Match - keys must match a pattern segment by segment, e.g. `user:12*`, `order:?:items`,
+// `[a-c]*:profile` or `tenant:**:invoice`, see PK.Match
 func (qo *QueryOptions) Match(patten string) *QueryOptions {
 	qo.patterns = strings.Split(patten, ":")
 	return qo
 }
 
+// MatchRegex - keys must match a regular expression, which is not anchored unless it says so
+func (qo *QueryOptions) MatchRegex(expr string) *QueryOptions {
+	qo.keyRegex, qo.regexErr = regexp.Compile(expr)
+	return qo
+}
+
+// matchesPatterns - key matches both the pattern and the regular expression
+func (qo *QueryOptions) matchesPatterns(key PK) bool {
+	if !key.Match(qo.patterns) {
+		return false
+	}
+
+	return qo.keyRegex == nil || qo.keyRegex.MatchString(key.String())
+}
+
+// patternBounds - the first key of the range of keys starting with literal segments of the pattern
+// and a pivot right after its last key, ok is false when the pattern starts with a wildcard
+func (qo *QueryOptions) patternBounds() (first, last PK, literal []string, ok bool) {
+	literal = literalSegments(qo.patterns)
+	if len(literal) == 0 {
+		return PK{}, PK{}, nil, false
+	}
+
+	prefix := strings.Join(literal, ":")
+
+	return newPK(prefix), newPK(prefix + ":" + string(unicode.MaxRune)), literal, true
+}
+
 func (qo *QueryOptions) KeyOrder(o Order) *QueryOptions {
 	qo.order = o
 	return qo
@@ -243,25 +440,214 @@ func (qo *QueryOptions) Prefix(p string) *QueryOptions {
 	return qo
 }
 
+// Limit - maximum number of documents to return
+func (qo *QueryOptions) Limit(n int) *QueryOptions {
+	qo.limit = n
+	return qo
+}
+
+// Offset - number of matching documents to skip
+func (qo *QueryOptions) Offset(n int) *QueryOptions {
+	qo.offset = n
+	return qo
+}
+
+// After - resumes iteration right after the last document of a page,
+// cursor is the one returned by FindPage
+func (qo *QueryOptions) After(cursor string) *QueryOptions {
+	if cursor == "" {
+		qo.after = nil
+		return qo
+	}
+
+	key, err := decodeCursor(cursor)
+	if err != nil {
+		qo.cursorErr = err
+		return qo
+	}
+
+	pk := newPK(key)
+	qo.after = &pk
+	return qo
+}
+
+// WithoutValues - documents are returned with keys and tags only and their values are never loaded,
+// values are still read when Where predicates need them
+func (qo *QueryOptions) WithoutValues() *QueryOptions {
+	qo.withoutValues = true
+	return qo
+}
+
+// ascendFrom - the key ascending scan should start from, taking cursor
+// and literal segments of the pattern into account
+func (qo *QueryOptions) ascendFrom(from string) string {
+	if qo.after != nil {
+		if fromPK := newPK(from); from == "" || fromPK.Less(*qo.after) {
+			from = qo.after.String()
+		}
+	}
+
+	if first, _, _, ok := qo.patternBounds(); ok {
+		if fromPK := newPK(from); from == "" || fromPK.Less(first) {
+			from = first.String()
+		}
+	}
+
+	return from
+}
+
+// descendFrom - the key descending scan should start from, taking cursor
+// and literal segments of the pattern into account
+func (qo *QueryOptions) descendFrom(from string) string {
+	if qo.after != nil {
+		if from == "" || qo.after.Less(newPK(from)) {
+			from = qo.after.String()
+		}
+	}
+
+	if _, last, _, ok := qo.patternBounds(); ok {
+		if from == "" || last.Less(newPK(from)) {
+			from = last.String()
+		}
+	}
+
+	return from
+}
+
 func (qo *QueryOptions) ByTagName(key string) *QueryOptions {
 	qo.byTagName = key
 	return qo
 }
 
+// OrderBy - orders documents by values of a tag, documents without the tag come last,
+// ties are broken by ThenBy and ThenByKey or by keys in ascending order
+func (qo *QueryOptions) OrderBy(name string, o Order) *QueryOptions {
+	qo.sortBy = []sortKey{{tag: name, order: o}}
+	return qo
+}
+
+// ThenBy - orders documents having equal values of previous sort keys by values of another tag
+func (qo *QueryOptions) ThenBy(name string, o Order) *QueryOptions {
+	qo.sortBy = append(qo.sortBy, sortKey{tag: name, order: o})
+	return qo
+}
+
+// ThenByKey - orders documents having equal values of previous sort keys by keys,
+// it must be the last sort key
+func (qo *QueryOptions) ThenByKey(o Order) *QueryOptions {
+	qo.sortBy = append(qo.sortBy, sortKey{order: o})
+	return qo
+}
+
+// HasAllTags - documents must match all the conditions of query tags
 func (qo *QueryOptions) HasAllTags(qt *QueryTags) *QueryOptions {
-	qo.allTags = qt
+	qo.addTags(qt)
+	return qo
+}
+
+// HasAnyTags - documents must match at least one of the conditions of query tags
+func (qo *QueryOptions) HasAnyTags(qt *QueryTags) *QueryOptions {
+	if qt.op == andOp {
+		qo.addTags(&QueryTags{op: orOp, conditions: qt.conditions, groups: qt.groups})
+	} else {
+		qo.addTags(Or(qt))
+	}
+
 	return qo
 }
 
+// addTags - several query tags are combined with AND
+func (qo *QueryOptions) addTags(qt *QueryTags) {
+	if qo.tags == nil {
+		qo.tags = QT()
+	}
+
+	qo.tags.groups = append(qo.tags.groups, qt)
+}
+
 func (qo *QueryOptions) Validate() error {
 	if qo.byTagName != "" && qo.keyRange != nil {
 		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine by tag name and primary key range options")
 	}
 
-	if qo.byTagName != "" && qo.allTags != nil {
+	if qo.byTagName != "" && qo.tags != nil {
 		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine by tag name and all tags options")
 	}
 
+	if qo.byTagName != "" && qo.after != nil {
+		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine by tag name and cursor options")
+	}
+
+	if qo.text != nil && qo.text.index == "" {
+		return errors.Wrap(ErrInvalidQueryOptions, "text index name cannot be empty")
+	}
+
+	if qo.text != nil && qo.byTagName != "" {
+		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine text match and by tag name options")
+	}
+
+	if qo.text != nil && qo.after != nil {
+		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine text match and cursor options")
+	}
+
+	if len(qo.sortBy) > 0 {
+		if err := qo.validateSortBy(); err != nil {
+			return err
+		}
+	}
+
+	if err := qo.validateProjection(); err != nil {
+		return err
+	}
+
+	if err := qo.validatePopulate(); err != nil {
+		return err
+	}
+
+	if qo.limit < 0 || qo.offset < 0 {
+		return errors.Wrap(ErrInvalidQueryOptions, "limit and offset cannot be negative")
+	}
+
+	if qo.regexErr != nil {
+		return errors.Wrap(ErrInvalidQueryOptions, qo.regexErr.Error())
+	}
+
+	if qo.cursorErr != nil {
+		return errors.Wrap(ErrInvalidQueryOptions, qo.cursorErr.Error())
+	}
+
+	for _, p := range qo.where {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (qo *QueryOptions) validateSortBy() error {
+	if qo.byTagName != "" {
+		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine order by and by tag name options")
+	}
+
+	if qo.text != nil {
+		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine text match and order by options")
+	}
+
+	if qo.after != nil {
+		return errors.Wrap(ErrInvalidQueryOptions, "cannot combine order by and cursor options")
+	}
+
+	for i, sk := range qo.sortBy {
+		if sk.order != AscOrder && sk.order != DescOrder {
+			return errors.Wrapf(ErrInvalidQueryOptions, "invalid sort order %s", sk.order)
+		}
+
+		if sk.tag == "" && i != len(qo.sortBy)-1 {
+			return errors.Wrap(ErrInvalidQueryOptions, "order by key must be the last sort key")
+		}
+	}
+
 	return nil
 }
 
@@ -269,18 +655,39 @@ func Q() *QueryOptions {
 	return &QueryOptions{order: AscOrder}
 }
 
+// matchesKey - key must match the patterns and be within the key range
+// and after the prefix the same way primary key scans do
+func (qo *QueryOptions) matchesKey(key PK) bool {
+	if !qo.matchesPatterns(key) {
+		return false
+	}
+
+	if qo.keyRange != nil {
+		to := newPK(qo.keyRange.To)
+		if key.Less(newPK(qo.keyRange.From)) || to.Less(key) {
+			return false
+		}
+	}
+
+	if qo.prefix != "" && key.Less(newPK(qo.prefix)) {
+		return false
+	}
+
+	return true
+}
+
 type filterEntriesSink struct {
 	sync.RWMutex
-	keys     []PK
-	patterns []string
-	entries  map[string]*entry
+	keys    []PK
+	qo      *QueryOptions
+	entries map[string]*entry
 }
 
-func newFilteredEntriesSink(patterns []string) *filterEntriesSink {
+func newFilteredEntriesSink(qo *QueryOptions) *filterEntriesSink {
 	return &filterEntriesSink{
-		patterns: patterns,
-		keys:     make([]PK, 0),
-		entries:  make(map[string]*entry),
+		qo:      qo,
+		keys:    make([]PK, 0),
+		entries: make(map[string]*entry),
 	}
 }
 
@@ -288,7 +695,11 @@ func (fe *filterEntriesSink) iterate(qo *QueryOptions, it entryIterator) {
 	fe.RLock()
 	defer fe.RUnlock()
 
-	if qo.needSortingByKeys() {
+	if len(qo.sortBy) > 0 {
+		sort.Slice(fe.keys, func(i, j int) bool {
+			return lessBySortKeys(qo.sortBy, fe.entries[fe.keys[i].String()], fe.entries[fe.keys[j].String()])
+		})
+	} else if qo.needSortingByKeys() {
 		if qo.order == AscOrder {
 			sort.Slice(fe.keys, func(i, j int) bool {
 				return fe.keys[i].Less(fe.keys[j])
@@ -300,20 +711,77 @@ func (fe *filterEntriesSink) iterate(qo *QueryOptions, it entryIterator) {
 		}
 	}
 
-	for i := range fe.keys {
+	// keys are sorted, so iteration can start right after the cursor
+	start := 0
+	if qo.after != nil && qo.needSortingByKeys() {
+		start = sort.Search(len(fe.keys), func(i int) bool {
+			if qo.order == AscOrder {
+				return qo.after.Less(fe.keys[i])
+			}
+
+			return fe.keys[i].Less(*qo.after)
+		})
+	}
+
+	for i := start; i < len(fe.keys); i++ {
 		if cont := it(fe.entries[fe.keys[i].String()]); !cont {
 			break
 		}
 	}
 }
 
+// lessBySortKeys - compares entries by values of sort keys, missing tags come last
+// and keys in ascending order break the remaining ties
+func lessBySortKeys(keys []sortKey, a, b *entry) bool {
+	for _, sk := range keys {
+		var c int
+		if sk.tag == "" {
+			c = comparePKs(a.key, b.key)
+		} else {
+			ta, okA := a.tags[sk.tag]
+			tb, okB := b.tags[sk.tag]
+			switch {
+			case !okA && !okB:
+				continue
+			case !okA:
+				return false
+			case !okB:
+				return true
+			}
+
+			c = compareTagValues(ta.data, tb.data)
+		}
+
+		if c != 0 {
+			if sk.order == DescOrder {
+				return c > 0
+			}
+
+			return c < 0
+		}
+	}
+
+	return a.key.Less(b.key)
+}
+
+func comparePKs(a, b PK) int {
+	switch {
+	case a.Less(b):
+		return -1
+	case b.Less(a):
+		return 1
+	}
+
+	return 0
+}
+
 func (fe *filterEntriesSink) add(entries ...*entry) {
 	fe.Lock()
 	defer fe.Unlock()
 
 	for _, ent := range entries {
-		if !ent.key.Match(fe.patterns) {
-			return
+		if !fe.qo.matchesKey(ent.key) {
+			continue
 		}
 
 		if fe.entries[ent.key.String()] == nil {
@@ -328,8 +796,8 @@ func (fe *filterEntriesSink) addMap(entries map[string]*entry) {
 	defer fe.Unlock()
 
 	for strKey, ent := range entries {
-		if !ent.key.Match(fe.patterns) {
-			return
+		if !fe.qo.matchesKey(ent.key) {
+			continue
 		}
 
 		if fe.entries[strKey] == nil {
@@ -344,3 +812,23 @@ func (fe *filterEntriesSink) empty() bool {
 	defer fe.RUnlock()
 	return len(fe.keys) == 0
 }
+
+// Page - a page of documents found by FindPage,
+// Next is a cursor for the following page, it is empty on the last page
+type Page struct {
+	Documents []*Document
+	Next      string
+}
+
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid cursor %s", cursor)
+	}
+
+	return string(b), nil
+}
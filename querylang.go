@@ -0,0 +1,874 @@
+package lemon
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrQuerySyntax = errors.New("query syntax error")
+
+// ParseQuery - parses a textual query into query options, e.g.
+// KEYS user:* WHERE tag.age > 30 AND tag.city = 'Budapest' ORDER BY KEY DESC LIMIT 20
+//
+// clauses, each one is optional and can be used once:
+//
+//	KEYS <pattern> | KEYS REGEX '<expr>' | KEYS PREFIX <prefix> | KEYS FROM <key> TO <key>
+//	SEARCH <text index> '<text>'
+//	WHERE <conditions on tag.<name> and doc.<JSON path>> combined with AND, OR, NOT and parentheses
+//	ORDER BY KEY [ASC|DESC] | ORDER BY tag.<name> [ASC|DESC], ... [, KEY [ASC|DESC]]
+//	LIMIT <n>, OFFSET <n>, AFTER '<cursor>'
+func ParseQuery(query string) (*QueryOptions, error) {
+	p := &queryParser{lx: &queryLexer{src: query}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	qo := Q()
+	seen := make(map[string]bool)
+
+	for p.tok.kind != tokEOF {
+		clause := strings.ToUpper(p.tok.text)
+		if p.tok.kind != tokWord || !isQueryClause(clause) {
+			return nil, p.unexpected("a clause like KEYS, WHERE, ORDER BY or LIMIT")
+		}
+
+		if seen[clause] {
+			return nil, p.errorf(p.tok.pos, "%s clause is used more than once", clause)
+		}
+
+		seen[clause] = true
+
+		var err error
+		switch clause {
+		case "KEYS":
+			err = p.parseKeys(qo)
+		case "SEARCH":
+			err = p.parseSearch(qo)
+		case "WHERE":
+			err = p.parseWhere(qo)
+		case "ORDER":
+			err = p.parseOrder(qo)
+		case "LIMIT":
+			err = p.parseNumber(qo.Limit)
+		case "OFFSET":
+			err = p.parseNumber(qo.Offset)
+		case "AFTER":
+			err = p.parseAfter(qo)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := qo.Validate(); err != nil {
+		return nil, err
+	}
+
+	return qo, nil
+}
+
+func isQueryClause(s string) bool {
+	switch s {
+	case "KEYS", "SEARCH", "WHERE", "ORDER", "LIMIT", "OFFSET", "AFTER":
+		return true
+	}
+
+	return false
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+
+	return "'" + t.text + "'"
+}
+
+type queryLexer struct {
+	src string
+	pos int
+}
+
+func (lx *queryLexer) skipSpaces() {
+	for lx.pos < len(lx.src) && unicode.IsSpace(rune(lx.src[lx.pos])) {
+		lx.pos++
+	}
+}
+
+// next - reads the next token of a query
+func (lx *queryLexer) next() (token, error) {
+	lx.skipSpaces()
+
+	start := lx.pos
+	if start >= len(lx.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := lx.src[start]
+	switch {
+	case c == '(':
+		lx.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case c == ')':
+		lx.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case c == ',':
+		lx.pos++
+		return token{kind: tokComma, text: ",", pos: start}, nil
+	case c == '\'' || c == '"':
+		return lx.quoted()
+	case c == '=' || c == '<' || c == '>' || c == '!':
+		for _, op := range []string{"!=", "<>", "<=", ">=", "=", "<", ">"} {
+			if strings.HasPrefix(lx.src[start:], op) {
+				lx.pos += len(op)
+				return token{kind: tokOp, text: op, pos: start}, nil
+			}
+		}
+	case isDigit(c) || ((c == '-' || c == '.') && start+1 < len(lx.src) && isDigit(lx.src[start+1])):
+		lx.pos++
+		for lx.pos < len(lx.src) && (isDigit(lx.src[lx.pos]) || strings.IndexByte(".eE", lx.src[lx.pos]) >= 0 ||
+			(strings.IndexByte("+-", lx.src[lx.pos]) >= 0 && strings.IndexByte("eE", lx.src[lx.pos-1]) >= 0)) {
+			lx.pos++
+		}
+
+		return token{kind: tokNumber, text: lx.src[start:lx.pos], pos: start}, nil
+	case isWordChar(c):
+		for lx.pos < len(lx.src) && isWordChar(lx.src[lx.pos]) {
+			lx.pos++
+		}
+
+		return token{kind: tokWord, text: lx.src[start:lx.pos], pos: start}, nil
+	}
+
+	return token{}, errors.Wrapf(ErrQuerySyntax, "at position %d: unexpected character %q", start, c)
+}
+
+// raw - reads a quoted string or everything up to the next space,
+// used for key patterns which may contain any characters
+func (lx *queryLexer) raw() (token, error) {
+	lx.skipSpaces()
+
+	start := lx.pos
+	if start >= len(lx.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	if c := lx.src[start]; c == '\'' || c == '"' {
+		return lx.quoted()
+	}
+
+	for lx.pos < len(lx.src) && !unicode.IsSpace(rune(lx.src[lx.pos])) {
+		lx.pos++
+	}
+
+	return token{kind: tokWord, text: lx.src[start:lx.pos], pos: start}, nil
+}
+
+// quoted - reads a string in single or double quotes, a backslash escapes a quote or another backslash
+// and is kept as is before any other character, so that regular expressions need no double escaping
+func (lx *queryLexer) quoted() (token, error) {
+	start := lx.pos
+	quote := lx.src[start]
+	lx.pos++
+
+	var sb strings.Builder
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\\' && lx.pos+1 < len(lx.src) && (lx.src[lx.pos+1] == quote || lx.src[lx.pos+1] == '\\'):
+			sb.WriteByte(lx.src[lx.pos+1])
+			lx.pos += 2
+		case c == quote:
+			lx.pos++
+			return token{kind: tokString, text: sb.String(), pos: start}, nil
+		default:
+			sb.WriteByte(c)
+			lx.pos++
+		}
+	}
+
+	return token{}, errors.Wrapf(ErrQuerySyntax, "at position %d: string is not closed", start)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '@' || c == '#' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c)
+}
+
+type queryParser struct {
+	lx  *queryLexer
+	tok token
+}
+
+func (p *queryParser) advance() error {
+	tok, err := p.lx.next()
+	if err != nil {
+		return err
+	}
+
+	p.tok = tok
+	return nil
+}
+
+// advanceRaw - like advance, but the token is read as a key pattern
+func (p *queryParser) advanceRaw() error {
+	tok, err := p.lx.raw()
+	if err != nil {
+		return err
+	}
+
+	p.tok = tok
+	return nil
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...interface{}) error {
+	return errors.Wrapf(ErrQuerySyntax, "at position %d: %s", pos, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) unexpected(expected string) error {
+	return p.errorf(p.tok.pos, "expected %s, got %s", expected, p.tok)
+}
+
+func (p *queryParser) isKeyword(kw string) bool {
+	return p.tok.kind == tokWord && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *queryParser) expectKeyword(kw string) error {
+	if !p.isKeyword(kw) {
+		return p.unexpected(kw)
+	}
+
+	return p.advance()
+}
+
+// text - a string or a word
+func (p *queryParser) text(what string) (string, error) {
+	if p.tok.kind != tokString && p.tok.kind != tokWord {
+		return "", p.unexpected(what)
+	}
+
+	s := p.tok.text
+	return s, p.advance()
+}
+
+// rawText - a key or a pattern, read as a raw token
+func (p *queryParser) rawText(what string) (string, error) {
+	if err := p.advanceRaw(); err != nil {
+		return "", err
+	}
+
+	if p.tok.kind == tokEOF {
+		return "", p.unexpected(what)
+	}
+
+	return p.tok.text, nil
+}
+
+func (p *queryParser) parseKeys(qo *QueryOptions) error {
+	pattern, err := p.rawText("a key pattern")
+	if err != nil {
+		return err
+	}
+
+	quoted := p.tok.kind == tokString
+
+	switch {
+	case !quoted && strings.EqualFold(pattern, "REGEX"):
+		expr, err := p.rawText("a regular expression")
+		if err != nil {
+			return err
+		}
+
+		qo.MatchRegex(expr)
+	case !quoted && strings.EqualFold(pattern, "PREFIX"):
+		prefix, err := p.rawText("a key prefix")
+		if err != nil {
+			return err
+		}
+
+		qo.Prefix(prefix)
+	case !quoted && strings.EqualFold(pattern, "FROM"):
+		from, err := p.rawText("a key")
+		if err != nil {
+			return err
+		}
+
+		if err := p.advanceRaw(); err != nil {
+			return err
+		}
+
+		if !p.isKeyword("TO") {
+			return p.unexpected("TO")
+		}
+
+		to, err := p.rawText("a key")
+		if err != nil {
+			return err
+		}
+
+		qo.KeyRange(from, to)
+	default:
+		qo.Match(pattern)
+	}
+
+	return p.advance()
+}
+
+func (p *queryParser) parseSearch(qo *QueryOptions) error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+
+	index, err := p.text("a text index name")
+	if err != nil {
+		return err
+	}
+
+	text, err := p.text("text to search for")
+	if err != nil {
+		return err
+	}
+
+	qo.MatchText(index, text)
+	return nil
+}
+
+// parseOrder - ORDER BY KEY alone orders by keys, otherwise sort keys are tags
+// optionally followed by KEY as the last one
+func (p *queryParser) parseOrder(qo *QueryOptions) error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+
+	if err := p.expectKeyword("BY"); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		if p.tok.kind != tokWord {
+			return p.unexpected("KEY or tag.<name>")
+		}
+
+		field := p.tok
+		if err := p.advance(); err != nil {
+			return err
+		}
+
+		order := AscOrder
+		switch {
+		case p.isKeyword("ASC"):
+			if err := p.advance(); err != nil {
+				return err
+			}
+		case p.isKeyword("DESC"):
+			order = DescOrder
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+
+		if strings.EqualFold(field.text, "KEY") {
+			if i == 0 {
+				qo.KeyOrder(order)
+			} else {
+				qo.ThenByKey(order)
+			}
+
+			if p.tok.kind == tokComma {
+				return p.errorf(p.tok.pos, "KEY must be the last sort key")
+			}
+
+			return nil
+		}
+
+		name, ok := trimFieldPrefix(field.text, "tag.")
+		if !ok {
+			return p.errorf(field.pos, "expected KEY or tag.<name>, got '%s'", field.text)
+		}
+
+		qo.ThenBy(name, order)
+
+		if p.tok.kind != tokComma {
+			return nil
+		}
+
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *queryParser) parseNumber(set func(n int) *QueryOptions) error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(p.tok.text)
+	if p.tok.kind != tokNumber || err != nil || n < 0 {
+		return p.unexpected("a non-negative integer")
+	}
+
+	set(n)
+	return p.advance()
+}
+
+func (p *queryParser) parseAfter(qo *QueryOptions) error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+
+	cursor, err := p.text("a cursor")
+	if err != nil {
+		return err
+	}
+
+	qo.After(cursor)
+	return nil
+}
+
+type queryNodeKind uint8
+
+const (
+	tagNode queryNodeKind = iota
+	docNode
+	andNode
+	orNode
+	notNode
+)
+
+// queryNode - parsed condition of WHERE clause
+type queryNode struct {
+	kind     queryNodeKind
+	pos      int
+	tag      tagCondition
+	doc      wherePredicate
+	children []*queryNode
+}
+
+func (p *queryParser) parseWhere(qo *QueryOptions) error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+
+	n, err := p.parseOr()
+	if err != nil {
+		return err
+	}
+
+	tags := QT()
+	for _, c := range flattenAnd(n) {
+		if c.kind == docNode {
+			qo.Where(c.doc.path, c.doc.op, c.doc.values...)
+			continue
+		}
+
+		if pos, ok := findDocNode(c); ok {
+			return p.errorf(pos, "conditions on documents can only be combined with AND outside of OR and NOT")
+		}
+
+		if c.kind == tagNode {
+			tags.conditions = append(tags.conditions, c.tag)
+		} else {
+			tags.groups = append(tags.groups, c.queryTags())
+		}
+	}
+
+	if !tags.empty() {
+		qo.HasAllTags(tags)
+	}
+
+	return nil
+}
+
+// flattenAnd - operands of nested AND nodes, e.g. of doc BETWEEN or parenthesized groups,
+// so that conditions on documents anywhere under AND are found
+func flattenAnd(n *queryNode) []*queryNode {
+	if n.kind != andNode {
+		return []*queryNode{n}
+	}
+
+	var result []*queryNode
+	for _, c := range n.children {
+		result = append(result, flattenAnd(c)...)
+	}
+
+	return result
+}
+
+func findDocNode(n *queryNode) (int, bool) {
+	if n.kind == docNode {
+		return n.pos, true
+	}
+
+	for _, c := range n.children {
+		if pos, ok := findDocNode(c); ok {
+			return pos, true
+		}
+	}
+
+	return 0, false
+}
+
+// queryTags - converts conditions on tags into query tags
+func (n *queryNode) queryTags() *QueryTags {
+	switch n.kind {
+	case notNode:
+		return Not(n.children[0].queryTags())
+	case andNode, orNode:
+		qt := &QueryTags{op: andOp}
+		if n.kind == orNode {
+			qt.op = orOp
+		}
+
+		for _, c := range n.children {
+			if c.kind == tagNode {
+				qt.conditions = append(qt.conditions, c.tag)
+			} else {
+				qt.groups = append(qt.groups, c.queryTags())
+			}
+		}
+
+		return qt
+	}
+
+	return &QueryTags{op: andOp, conditions: []tagCondition{n.tag}}
+}
+
+func (p *queryParser) parseOr() (*queryNode, error) {
+	return p.parseGroup(orNode, "OR", p.parseAnd)
+}
+
+func (p *queryParser) parseAnd() (*queryNode, error) {
+	return p.parseGroup(andNode, "AND", p.parseUnary)
+}
+
+func (p *queryParser) parseGroup(kind queryNodeKind, kw string, operand func() (*queryNode, error)) (*queryNode, error) {
+	pos := p.tok.pos
+
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isKeyword(kw) {
+		return first, nil
+	}
+
+	n := &queryNode{kind: kind, pos: pos, children: []*queryNode{first}}
+	for p.isKeyword(kw) {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+
+		n.children = append(n.children, next)
+	}
+
+	return n, nil
+}
+
+func (p *queryParser) parseUnary() (*queryNode, error) {
+	pos := p.tok.pos
+
+	if p.isKeyword("NOT") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &queryNode{kind: notNode, pos: pos, children: []*queryNode{n}}, nil
+	}
+
+	if p.tok.kind == tokLParen {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.tok.kind != tokRParen {
+			return nil, p.unexpected("')'")
+		}
+
+		return n, p.advance()
+	}
+
+	return p.parseCondition()
+}
+
+func (p *queryParser) parseCondition() (*queryNode, error) {
+	field := p.tok
+	if field.kind != tokWord {
+		return nil, p.unexpected("tag.<name> or doc.<path>")
+	}
+
+	tagName, isTag := trimFieldPrefix(field.text, "tag.")
+	path, isDoc := trimFieldPrefix(field.text, "doc.")
+	if !isTag && !isDoc {
+		return nil, p.errorf(field.pos, "expected tag.<name> or doc.<path>, got '%s'", field.text)
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if isDoc {
+		return p.parseDocCondition(field.pos, path)
+	}
+
+	return p.parseTagCondition(field.pos, tagName)
+}
+
+func (p *queryParser) parseTagCondition(pos int, name string) (*queryNode, error) {
+	cond := func(comp comparator, value interface{}) *queryNode {
+		return &queryNode{kind: tagNode, pos: pos, tag: tagCondition{key: tagKey{name: name, comp: comp}, value: value, untyped: true}}
+	}
+
+	op := p.tok
+	switch {
+	case op.kind == tokOp:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.text {
+		case "=":
+			return cond(equal, v), nil
+		case "!=", "<>":
+			return &queryNode{kind: notNode, pos: pos, children: []*queryNode{cond(equal, v)}}, nil
+		case ">":
+			return cond(greaterThan, v), nil
+		case ">=":
+			return cond(greaterThanOrEqual, v), nil
+		case "<":
+			return cond(lessThan, v), nil
+		default:
+			return cond(lessThanOrEqual, v), nil
+		}
+	case p.isKeyword("IN"):
+		values, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+
+		n := cond(in, nil)
+		n.tag.values = values
+		return n, nil
+	case p.isKeyword("BETWEEN"):
+		from, to, err := p.parseBetween()
+		if err != nil {
+			return nil, err
+		}
+
+		n := cond(between, from)
+		n.tag.upper = to
+		return n, nil
+	case p.isKeyword("PREFIX"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		if p.tok.kind != tokString {
+			return nil, p.unexpected("a string")
+		}
+
+		value := p.tok.text
+		return cond(prefix, value), p.advance()
+	case p.isKeyword("EXISTS"):
+		return cond(exists, nil), p.advance()
+	case p.isKeyword("MISSING"):
+		return &queryNode{kind: notNode, pos: pos, children: []*queryNode{cond(exists, nil)}}, p.advance()
+	}
+
+	return nil, p.unexpected("an operator, IN, BETWEEN, PREFIX, EXISTS or MISSING")
+}
+
+func (p *queryParser) parseDocCondition(pos int, path string) (*queryNode, error) {
+	pred := func(op Operator, values ...interface{}) *queryNode {
+		return &queryNode{kind: docNode, pos: pos, doc: wherePredicate{path: path, op: op, values: values}}
+	}
+
+	op := p.tok
+	switch {
+	case op.kind == tokOp:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		operators := map[string]Operator{"=": Eq, "!=": Ne, "<>": Ne, ">": Gt, ">=": Gte, "<": Lt, "<=": Lte}
+		return pred(operators[op.text], v), nil
+	case p.isKeyword("IN"):
+		values, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+
+		return pred(In, values...), nil
+	case p.isKeyword("CONTAINS"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		return pred(Contains, v), nil
+	case p.isKeyword("EXISTS"):
+		return pred(Exists), p.advance()
+	case p.isKeyword("BETWEEN"):
+		from, to, err := p.parseBetween()
+		if err != nil {
+			return nil, err
+		}
+
+		return &queryNode{kind: andNode, pos: pos, children: []*queryNode{pred(Gte, from), pred(Lte, to)}}, nil
+	}
+
+	return nil, p.unexpected("an operator, IN, BETWEEN, CONTAINS or EXISTS")
+}
+
+// parseBetween - bounds of BETWEEN <from> AND <to>
+func (p *queryParser) parseBetween() (interface{}, interface{}, error) {
+	if err := p.advance(); err != nil {
+		return nil, nil, err
+	}
+
+	from, err := p.parseValue()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := p.expectKeyword("AND"); err != nil {
+		return nil, nil, err
+	}
+
+	to, err := p.parseValue()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return from, to, nil
+}
+
+// parseValueList - values of IN (<value>, ...)
+func (p *queryParser) parseValueList() ([]interface{}, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokLParen {
+		return nil, p.unexpected("'('")
+	}
+
+	var values []interface{}
+	for {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+
+		if p.tok.kind == tokRParen {
+			return values, p.advance()
+		}
+
+		if p.tok.kind != tokComma {
+			return nil, p.unexpected("',' or ')'")
+		}
+	}
+}
+
+// parseValue - a string, a number or a boolean, numbers with a fraction or an exponent are floats
+func (p *queryParser) parseValue() (interface{}, error) {
+	tok := p.tok
+
+	switch {
+	case tok.kind == tokString:
+		return tok.text, p.advance()
+	case tok.kind == tokNumber:
+		if !strings.ContainsAny(tok.text, ".eE") {
+			if n, err := strconv.Atoi(tok.text); err == nil {
+				return n, p.advance()
+			}
+		}
+
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "invalid number %s", tok.text)
+		}
+
+		return f, p.advance()
+	case p.isKeyword("true"):
+		return true, p.advance()
+	case p.isKeyword("false"):
+		return false, p.advance()
+	}
+
+	return nil, p.unexpected("a string, a number, true or false")
+}
+
+func trimFieldPrefix(s, prefix string) (string, bool) {
+	if len(s) <= len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return s[len(prefix):], true
+}
@@ -0,0 +1,203 @@
+package lemon_test
+
+import (
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	users := []struct {
+		key    string
+		age    int
+		city   string
+		score  float64
+		active bool
+		data   lemon.M
+	}{
+		{key: "user:1", age: 25, city: "Budapest", score: 4.5, active: true, data: lemon.M{"name": "Alice", "roles": []string{"admin"}}},
+		{key: "user:2", age: 34, city: "Budapest", score: 3.2, data: lemon.M{"name": "Bob", "roles": []string{"dev"}}},
+		{key: "user:3", age: 41, city: "Vienna", score: 4.9, active: true, data: lemon.M{"name": "Carol"}},
+		{key: "user:4", age: 52, city: "Budapest", score: 2.1, active: true, data: lemon.M{"name": "Dave", "roles": []string{"dev", "admin"}}},
+		{key: "user:12", age: 30, city: "Prague", score: 3.9, data: lemon.M{"name": "Eve's"}},
+	}
+
+	for _, u := range users {
+		require.NoError(t, db.Insert(u.key, u.data, lemon.WithTags().
+			Int("age", u.age).
+			Str("city", u.city).
+			Float("score", u.score).
+			Bool("active", u.active),
+		))
+	}
+
+	require.NoError(t, db.Insert("account:1", lemon.M{"name": "Acme"}, lemon.WithTags().Int("age", 99)))
+
+	tt := []struct {
+		name  string
+		query string
+		keys  []string
+	}{
+		{
+			name:  "tags with order and limit",
+			query: "KEYS user:* WHERE tag.age > 30 AND tag.city = 'Budapest' ORDER BY KEY DESC LIMIT 20",
+			keys:  []string{"user:4", "user:2"},
+		},
+		{
+			name:  "keywords are case insensitive",
+			query: "keys user:* where tag.age >= 34 and tag.city = 'Budapest' order by key asc",
+			keys:  []string{"user:2", "user:4"},
+		},
+		{
+			name:  "or and parentheses",
+			query: "WHERE (tag.city = 'Vienna' OR tag.city = 'Prague') AND tag.active = false",
+			keys:  []string{"user:12"},
+		},
+		{
+			name:  "and binds tighter than or",
+			query: "WHERE tag.city = 'Vienna' OR tag.city = 'Budapest' AND tag.age < 30",
+			keys:  []string{"user:1", "user:3"},
+		},
+		{
+			name:  "not and not equal",
+			query: "KEYS user:* WHERE NOT tag.city = 'Budapest' AND tag.age != 30",
+			keys:  []string{"user:3"},
+		},
+		{
+			name:  "in between and prefix",
+			query: "WHERE tag.age IN (25, 41, 52) AND tag.score BETWEEN 2.0 AND 4.6 AND tag.city PREFIX 'Bud'",
+			keys:  []string{"user:1", "user:4"},
+		},
+		{
+			name:  "int literals on float tags",
+			query: "WHERE tag.score > 4 OR tag.score BETWEEN 2 AND 3",
+			keys:  []string{"user:1", "user:3", "user:4"},
+		},
+		{
+			name:  "int literals in list and negation on float tags",
+			query: "KEYS user:* WHERE NOT tag.score IN (3, 4) AND tag.score <= 4",
+			keys:  []string{"user:2", "user:4", "user:12"},
+		},
+		{
+			name:  "document conditions",
+			query: `KEYS PREFIX user WHERE doc.roles CONTAINS "admin" AND doc.name <> 'Alice'`,
+			keys:  []string{"user:4"},
+		},
+		{
+			name:  "document conditions with tags",
+			query: "WHERE doc.roles EXISTS AND tag.age BETWEEN 30 AND 40 AND doc.name IN ('Bob', 'Carol')",
+			keys:  []string{"user:2"},
+		},
+		{
+			name:  "document between with tags",
+			query: "WHERE tag.city = 'Budapest' AND doc.name BETWEEN 'B' AND 'D'",
+			keys:  []string{"user:2"},
+		},
+		{
+			name:  "parenthesized document conditions with tags",
+			query: "WHERE (doc.name <> 'Alice' AND doc.roles CONTAINS 'admin') AND tag.city = 'Budapest'",
+			keys:  []string{"user:4"},
+		},
+		{
+			name:  "tag presence",
+			query: "WHERE tag.age EXISTS AND tag.city MISSING",
+			keys:  []string{"account:1"},
+		},
+		{
+			name:  "escaped quote",
+			query: `WHERE doc.name = 'Eve\'s'`,
+			keys:  []string{"user:12"},
+		},
+		{
+			name:  "key range with offset",
+			query: "KEYS FROM user:2 TO user:4 OFFSET 1",
+			keys:  []string{"user:3", "user:4"},
+		},
+		{
+			name:  "regex",
+			query: `KEYS REGEX '^user:\d$' LIMIT 2`,
+			keys:  []string{"user:1", "user:2"},
+		},
+		{
+			name:  "order by tag",
+			query: "KEYS user:* ORDER BY tag.age DESC LIMIT 3",
+			keys:  []string{"user:4", "user:3", "user:2"},
+		},
+		{
+			name:  "order by several tags with conditions",
+			query: "WHERE tag.city = 'Budapest' ORDER BY tag.active DESC, tag.age DESC",
+			keys:  []string{"user:4", "user:1", "user:2"},
+		},
+		{
+			name:  "empty query",
+			query: "",
+			keys:  []string{"account:1", "user:1", "user:2", "user:3", "user:4", "user:12"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := lemon.ParseQuery(tc.query)
+			require.NoError(t, err)
+
+			docs, err := db.Find(q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+		})
+	}
+
+	t.Run("cursor", func(t *testing.T) {
+		page, err := db.FindPage(lemon.Q().Match("user:*").Limit(3))
+		require.NoError(t, err)
+
+		q, err := lemon.ParseQuery("KEYS user:* AFTER '" + page.Next + "'")
+		require.NoError(t, err)
+
+		docs, err := db.Find(q)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:4", "user:12"}, keysOf(docs))
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		for query, msg := range map[string]string{
+			"WHERE tag.age >":                         "at position 15: expected a string, a number, true or false, got end of query",
+			"WHERE age > 30":                          "at position 6: expected tag.<name> or doc.<path>, got 'age'",
+			"WHERE (tag.age > 30":                     "at position 19: expected ')', got end of query",
+			"WHERE tag.city = 'Budapest":              "at position 17: string is not closed",
+			"WHERE tag.age ~ 1":                       "at position 14: unexpected character '~'",
+			"SELECT *":                                "at position 0: expected a clause like KEYS, WHERE, ORDER BY or LIMIT, got 'SELECT'",
+			"LIMIT 10 LIMIT 20":                       "at position 9: LIMIT clause is used more than once",
+			"LIMIT ten":                               "at position 6: expected a non-negative integer, got 'ten'",
+			"ORDER tag.age":                           "at position 6: expected BY, got 'tag.age'",
+			"ORDER BY KEY, tag.age":                   "at position 12: KEY must be the last sort key",
+			"KEYS FROM a user:9":                      "at position 12: expected TO, got 'user:9'",
+			"WHERE tag.age BETWEEN 1 OR 2":            "at position 24: expected AND, got 'OR'",
+			"WHERE tag.age IN (1 2)":                  "at position 20: expected ',' or ')', got '2'",
+			"WHERE tag.a = 1 OR doc.b = 2":            "at position 19: conditions on documents can only be combined with AND outside of OR and NOT",
+			"WHERE doc.name PREFIX 'A'":               "at position 15: expected an operator, IN, BETWEEN, CONTAINS or EXISTS, got 'PREFIX'",
+			"WHERE tag.city = 'Budapest' AND LIMIT 1": "at position 32: expected tag.<name> or doc.<path>, got 'LIMIT'",
+		} {
+			_, err := lemon.ParseQuery(query)
+			require.Error(t, err, query)
+			assert.True(t, errors.Is(err, lemon.ErrQuerySyntax), query)
+			assert.Equal(t, msg+": query syntax error", err.Error(), query)
+		}
+	})
+
+	t.Run("invalid query options", func(t *testing.T) {
+		_, err := lemon.ParseQuery("WHERE doc.age > true")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+	})
+}
@@ -0,0 +1,295 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDB_Refs(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("customer:1", lemon.M{"name": "Alice"}))
+	require.NoError(t, db.Insert("customer:2", lemon.M{"name": "Bob"}))
+	require.NoError(t, db.Insert("seller:1", lemon.M{"name": "Shop"}))
+
+	require.NoError(t, db.Insert("order:1", lemon.M{"total": 10}, lemon.WithRef("customer", "customer:1"), lemon.WithRef("seller", "seller:1")))
+	require.NoError(t, db.Insert("order:2", lemon.M{"total": 20}, lemon.WithRef("customer", "customer:2")))
+	require.NoError(t, db.Insert("order:3", lemon.M{"total": 30}, lemon.WithRef("customer", "customer:1")))
+	require.NoError(t, db.Insert("order:4", lemon.M{"total": 40}, lemon.WithRef("customer", "customer:9")))
+	require.NoError(t, db.Insert("review:1", lemon.M{"stars": 5}, lemon.WithRef("author", "customer:1")))
+
+	t.Run("document refs", func(t *testing.T) {
+		d, err := db.Get("order:1")
+		require.NoError(t, err)
+		assert.Equal(t, "customer:1", d.Ref("customer"))
+		assert.Equal(t, "", d.Ref("unknown"))
+		assert.Equal(t, map[string]string{"customer": "customer:1", "seller": "seller:1"}, d.Refs())
+		assert.Empty(t, d.Tags())
+		assert.Nil(t, d.Populated("customer"))
+	})
+
+	t.Run("populate", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().Match("order:*").Populate("customer", "seller"))
+		require.NoError(t, err)
+		require.Len(t, docs, 4)
+
+		require.NotNil(t, docs[0].Populated("customer"))
+		assert.Equal(t, "customer:1", docs[0].Populated("customer").Key())
+		assert.Equal(t, "Alice", refName(docs[0].Populated("customer")))
+		require.NotNil(t, docs[0].Populated("seller"))
+		assert.Equal(t, "Shop", refName(docs[0].Populated("seller")))
+
+		assert.Equal(t, "Bob", refName(docs[1].Populated("customer")))
+		assert.Nil(t, docs[1].Populated("seller"))
+		assert.Equal(t, "Alice", refName(docs[2].Populated("customer")))
+
+		// references to missing documents are left out
+		assert.Equal(t, "customer:9", docs[3].Ref("customer"))
+		assert.Nil(t, docs[3].Populated("customer"))
+	})
+
+	t.Run("populate with iterator and without values", func(t *testing.T) {
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			it := tx.Iterate(lemon.Q().Match("order:*").WithoutValues().Populate("customer").Limit(2))
+			defer it.Close()
+
+			var names []string
+			for it.Next() {
+				d := it.Document()
+				assert.Empty(t, d.Value())
+				names = append(names, refName(d.Populated("customer")))
+			}
+
+			assert.Equal(t, []string{"Alice", "Bob"}, names)
+			return it.Err()
+		}))
+	})
+
+	t.Run("query by reference tag", func(t *testing.T) {
+		docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().StrTagEq(lemon.RefTag("customer"), "customer:1")))
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "order:1", docs[0].Key())
+		assert.Equal(t, "order:3", docs[1].Key())
+	})
+
+	t.Run("referenced by", func(t *testing.T) {
+		docs, err := db.ReferencedBy("customer:1")
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+		assert.Equal(t, "order:1", docs[0].Key())
+		assert.Equal(t, "order:3", docs[1].Key())
+		assert.Equal(t, "review:1", docs[2].Key())
+
+		docs, err = db.ReferencedBy("customer:1", lemon.Q().Match("order:*").Populate("seller"))
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "Shop", refName(docs[0].Populated("seller")))
+		assert.Nil(t, docs[1].Populated("seller"))
+
+		docs, err = db.ReferencedBy("seller:1")
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "order:1", docs[0].Key())
+
+		docs, err = db.ReferencedBy("customer:3")
+		require.NoError(t, err)
+		assert.Empty(t, docs)
+	})
+
+	t.Run("references follow updates and removals", func(t *testing.T) {
+		require.NoError(t, db.InsertOrReplace("order:3", lemon.M{"total": 35}, lemon.WithRef("customer", "customer:2")))
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.Remove("review:1")
+		}))
+
+		docs, err := db.ReferencedBy("customer:1")
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "order:1", docs[0].Key())
+
+		docs, err = db.ReferencedBy("customer:2")
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "order:2", docs[0].Key())
+		assert.Equal(t, "order:3", docs[1].Key())
+	})
+
+	t.Run("invalid refs", func(t *testing.T) {
+		err := db.Insert("order:5", lemon.M{"total": 50}, lemon.WithRef("customer", ""))
+		assert.True(t, errors.Is(err, lemon.ErrInvalidRef))
+		assert.False(t, db.Has("order:5"))
+
+		_, err = db.Find(lemon.Q().Populate(""))
+		assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+	})
+}
+
+func TestDB_ReferencedByQueryOptions(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("customer:1", lemon.M{"name": "Alice"}))
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, db.Insert(
+			fmt.Sprintf("order:%d", i),
+			lemon.M{"a": i % 2},
+			lemon.WithRef("customer", "customer:1"),
+			lemon.WithTags().Int("n", i),
+		))
+	}
+	require.NoError(t, db.Insert("order:5", lemon.M{"a": 1}, lemon.WithRef("customer", "customer:2"), lemon.WithTags().Int("n", 5)))
+
+	keys := func(docs []*lemon.Document) []string {
+		var result []string
+		for _, d := range docs {
+			result = append(result, d.Key())
+		}
+		return result
+	}
+
+	tt := []struct {
+		name string
+		q    *lemon.QueryOptions
+		keys []string
+	}{
+		{name: "tags", q: lemon.Q().HasAllTags(lemon.QT().IntTagGte("n", 3)), keys: []string{"order:3", "order:4"}},
+		{name: "where", q: lemon.Q().Where("a", lemon.Eq, 1), keys: []string{"order:1", "order:3"}},
+		{name: "limit", q: lemon.Q().Limit(1), keys: []string{"order:1"}},
+		{name: "offset", q: lemon.Q().Offset(3), keys: []string{"order:4"}},
+		{name: "order by", q: lemon.Q().OrderBy("n", lemon.DescOrder), keys: []string{"order:4", "order:3", "order:2", "order:1"}},
+		{
+			name: "combined",
+			q:    lemon.Q().Limit(1).HasAllTags(lemon.QT().IntTagEq("n", 3)).Where("a", lemon.Eq, 1),
+			keys: []string{"order:3"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.ReferencedBy("customer:1", tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keys(docs))
+		})
+	}
+
+	t.Run("query options are left untouched", func(t *testing.T) {
+		q := lemon.Q().HasAllTags(lemon.QT().IntTagGte("n", 4))
+
+		docs, err := db.ReferencedBy("customer:1", q)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"order:4"}, keys(docs))
+
+		docs, err = db.Find(q)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"order:4", "order:5"}, keys(docs))
+	})
+}
+
+func TestDB_RefsFromJSONPath(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("customer:1", lemon.M{"name": "Alice"}))
+	require.NoError(t, db.Insert("order:1", lemon.M{"total": 10, "customer_id": "customer:1"}))
+	require.NoError(t, db.CreateRef("customer", "customer_id"))
+	require.NoError(t, db.Insert("order:2", lemon.M{"total": 20, "customer_id": "customer:1"}))
+	require.NoError(t, db.Insert("order:3", lemon.M{"total": 30}))
+
+	docs, err := db.Find(lemon.Q().Match("order:*").Populate("customer"))
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	assert.Equal(t, "Alice", refName(docs[0].Populated("customer")))
+	assert.Equal(t, "Alice", refName(docs[1].Populated("customer")))
+	assert.Nil(t, docs[2].Populated("customer"))
+
+	docs, err = db.ReferencedBy("customer:1")
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "order:1", docs[0].Key())
+	assert.Equal(t, "order:2", docs[1].Key())
+
+	err = db.CreateRef("customer", "customer_id")
+	assert.True(t, errors.Is(err, lemon.ErrIndexAlreadyExists))
+
+	require.NoError(t, db.DropIndex(lemon.RefTag("customer")))
+
+	docs, err = db.ReferencedBy("customer:1")
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+}
+
+func TestDB_RefsPersistence(t *testing.T) {
+	fixture := "./__fixtures__/refs_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	open := func() (*lemon.DB, lemon.Closer) {
+		db, closer, err := lemon.Open(fixture, &lemon.Config{
+			DisableAutoVacuum:   true,
+			PersistenceStrategy: lemon.Sync,
+		})
+
+		require.NoError(t, err)
+		return db, closer
+	}
+
+	db, closer := open()
+	require.NoError(t, db.Insert("customer:1", lemon.M{"name": "Alice"}))
+	require.NoError(t, db.Insert("order:1", lemon.M{"total": 10}, lemon.WithRef("customer", "customer:1")))
+	require.NoError(t, db.Insert("order:2", lemon.M{"total": 20}, lemon.WithRef("customer", "customer:1")))
+	require.NoError(t, closer())
+
+	db, closer = open()
+	defer func() {
+		require.NoError(t, closer())
+	}()
+
+	docs, err := db.Find(lemon.Q().Match("order:*").Populate("customer"))
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "Alice", refName(docs[1].Populated("customer")))
+
+	docs, err = db.ReferencedBy("customer:1")
+	require.NoError(t, err)
+	assert.Len(t, docs, 2)
+}
+
+func refName(d *lemon.Document) string {
+	if d == nil {
+		return ""
+	}
+
+	name, _ := d.JSON().String("name")
+	return name
+}
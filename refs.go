@@ -0,0 +1,135 @@
+package lemon
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// refTagPrefix - references are string meta tags named after the reference,
+// so they are persisted and indexed the same way as any other tag
+const refTagPrefix = "_ref:"
+
+var ErrInvalidRef = errors.New("invalid reference")
+
+// RefTag - name of the meta tag holding a reference, it can be used in tag queries,
+// e.g. `lemon.QT().StrTagEq(lemon.RefTag("customer"), "customer:1")`
+func RefTag(name string) string {
+	return refTagPrefix + name
+}
+
+type refApplier struct {
+	name string
+	key  string
+}
+
+// WithRef - document references another document by its key under the given name,
+// e.g. `WithRef("customer", "customer:1")`, references are loaded by query options Populate
+func WithRef(name, key string) MetaApplier {
+	return &refApplier{name: name, key: key}
+}
+
+func (ra *refApplier) applyTo(e *entry) error {
+	if ra.name == "" || ra.key == "" {
+		return errors.Wrap(ErrInvalidRef, "reference name and key cannot be empty")
+	}
+
+	if e.tags == nil {
+		e.tags = newTags()
+	}
+
+	e.tags[RefTag(ra.name)] = &tag{dt: strDataType, data: ra.key}
+
+	return nil
+}
+
+// Populate - documents referenced under the given names are loaded in the same transaction
+// and are available through Document.Populated, missing and expired references are left out
+func (qo *QueryOptions) Populate(names ...string) *QueryOptions {
+	qo.populate = append(qo.populate, names...)
+	return qo
+}
+
+func (qo *QueryOptions) validatePopulate() error {
+	for _, name := range qo.populate {
+		if name == "" {
+			return errors.Wrap(ErrInvalidQueryOptions, "populated reference name cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+// populate - loads documents referenced by the document
+func (x *Tx) populate(q *QueryOptions, d *Document) {
+	if q == nil || len(q.populate) == 0 || d == nil {
+		return
+	}
+
+	d.populated = make(map[string]*Document, len(q.populate))
+	for _, name := range q.populate {
+		key := d.Ref(name)
+		if key == "" {
+			continue
+		}
+
+		if ref, err := x.Get(key); err == nil {
+			d.populated[name] = ref
+		}
+	}
+}
+
+// ReferencedBy - documents referencing the given key under any reference name,
+// the references are matched as tag conditions added to the query options, so the rest
+// of the options filter, order, limit and populate the documents the same way Find does
+func (x *Tx) ReferencedBy(key string, qo *QueryOptions) ([]*Document, error) {
+	if qo == nil {
+		qo = Q()
+	}
+
+	if x.ee == nil {
+		return nil, ErrTxAlreadyClosed
+	}
+
+	names, err := x.ee.RefTagNames()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, qo.Validate()
+	}
+
+	refs := make([]*QueryTags, len(names))
+	for i, name := range names {
+		refs[i] = QT().StrTagEq(name, key)
+	}
+
+	// query options of the caller are left untouched
+	rq := *qo
+	rq.tags = QT()
+	if qo.tags != nil {
+		rq.tags.groups = append(rq.tags.groups, qo.tags)
+	}
+	rq.tags.groups = append(rq.tags.groups, Or(refs...))
+
+	return x.Find(&rq)
+}
+
+// RefTagNames - sorted names of indexed reference tags
+func (ee *defaultEngine) RefTagNames() ([]string, error) {
+	if ee.closed {
+		return nil, ErrDatabaseAlreadyClosed
+	}
+
+	var names []string
+	for name, idx := range ee.tags.data {
+		if strings.HasPrefix(name, refTagPrefix) && idx.dt == strDataType {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -5,14 +5,23 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"strconv"
+	"strings"
 )
 
 const (
-	setCommand      = "set"
-	delCommand      = "del"
-	untagCommand    = "untag"
-	tagCommand      = "tag"
-	flushAllCommand = "flushall"
+	setCommand       = "set"
+	delCommand       = "del"
+	untagCommand     = "untag"
+	tagCommand       = "tag"
+	flushAllCommand  = "flushall"
+	incrCommand      = "incr"
+	indexCommand     = "index"
+	dropIndexCommand = "dropindex"
+	textIndexCommand = "textindex"
+
+	compositeIndexCommand = "compositeindex"
+
+	uniqueTagCommand = "unique"
 )
 
 type respSerializer struct {
@@ -32,7 +41,7 @@ func (rs *respSerializer) serializeSetCommand(ent *entry) error {
 
 	ent.pos = position{
 		size:   uint64(len(ent.value)),
-		offset: uint64(rs.pos + prefix + 1),
+		offset: uint64(rs.pos + prefix),
 	}
 
 	rs.pos += total
@@ -64,12 +73,11 @@ func (rs *respSerializer) serializeDelCommand(cmd *deleteCmd) error {
 	rs.pos += writeRespArray(2, &rs.buf)
 	rs.pos += writeRespSimpleString([]byte(delCommand), &rs.buf)
 	rs.pos += writeRespKeyString(cmd.key.Bytes(), &rs.buf)
-	rs.pos += 1
 	return nil
 }
 
 func (rs *respSerializer) serializeUntagCommand(cmd *untagCmd) error {
-	segments := len(cmd.names)
+	segments := 2 + len(cmd.names)
 	rs.pos += writeRespArray(segments, &rs.buf)
 	rs.pos += writeRespSimpleString([]byte(untagCommand), &rs.buf)
 	rs.pos += writeRespKeyString(cmd.key.Bytes(), &rs.buf)
@@ -108,6 +116,87 @@ func (rs *respSerializer) serializeTagCommand(cmd *tagCmd) error {
 	return nil
 }
 
+func (rs *respSerializer) serializeIncrCommand(cmd *incrCmd) error {
+	rs.pos += writeRespArray(3, &rs.buf)
+	rs.pos += writeRespSimpleString([]byte(incrCommand), &rs.buf)
+	rs.pos += writeRespKeyString(cmd.ent.key.Bytes(), &rs.buf)
+	prefix, total := writeRespBlob(cmd.ent.value, &rs.buf)
+
+	cmd.ent.pos = position{
+		size:   uint64(len(cmd.ent.value)),
+		offset: uint64(rs.pos + prefix),
+	}
+
+	rs.pos += total
+
+	return nil
+}
+
+func (rs *respSerializer) serializeIndexCommand(fi *fieldIndex) error {
+	rs.pos += writeRespArray(4, &rs.buf)
+	rs.pos += writeRespSimpleString([]byte(indexCommand), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(fi.name), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(fi.path), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(fi.ft.String()), &rs.buf)
+	return nil
+}
+
+func (rs *respSerializer) serializeTextIndexCommand(ti *textIndex) error {
+	stemming := "false"
+	if ti.stemming {
+		stemming = "true"
+	}
+
+	rs.pos += writeRespArray(4+len(ti.fields), &rs.buf)
+	rs.pos += writeRespSimpleString([]byte(textIndexCommand), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(ti.name), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(stemming), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(strings.Join(ti.stopWords, " ")), &rs.buf)
+
+	for _, f := range ti.fields {
+		rs.pos += writeRespKeyString([]byte(f), &rs.buf)
+	}
+
+	return nil
+}
+
+func (rs *respSerializer) serializeCompositeIndexCommand(ci *compositeIndex) error {
+	rs.pos += writeRespArray(2+len(ci.fields), &rs.buf)
+	rs.pos += writeRespSimpleString([]byte(compositeIndexCommand), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(ci.name), &rs.buf)
+
+	for _, f := range ci.fields {
+		rs.pos += writeRespKeyString([]byte(f), &rs.buf)
+	}
+
+	return nil
+}
+
+// serializeUniqueTagCommand - the key pattern is written only when the constraint is scoped
+func (rs *respSerializer) serializeUniqueTagCommand(ut *uniqueTag) error {
+	segments := 2
+	if ut.pattern != "" {
+		segments++
+	}
+
+	rs.pos += writeRespArray(segments, &rs.buf)
+	rs.pos += writeRespSimpleString([]byte(uniqueTagCommand), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(ut.name), &rs.buf)
+
+	if ut.pattern != "" {
+		rs.pos += writeRespKeyString([]byte(ut.pattern), &rs.buf)
+	}
+
+	return nil
+}
+
+func (rs *respSerializer) serializeDropIndexCommand(cmd *dropIndexCmd) error {
+	rs.pos += writeRespArray(2, &rs.buf)
+	rs.pos += writeRespSimpleString([]byte(dropIndexCommand), &rs.buf)
+	rs.pos += writeRespKeyString([]byte(cmd.name), &rs.buf)
+	return nil
+}
+
 func (rs *respSerializer) serializeFlushAllCommand() error {
 	rs.pos += writeRespArray(1, &rs.buf)
 	rs.pos += writeRespSimpleString([]byte(flushAllCommand), &rs.buf)
@@ -156,7 +245,7 @@ func writeRespKeyString(b []byte, buf *bytes.Buffer) int {
 	n, _ := buf.Write(b)
 	buf.WriteRune('\r')
 	buf.WriteRune('\n')
-	return 4 + l + n
+	return 5 + l + n
 }
 
 func writeRespFunc(fn []byte, buf *bytes.Buffer) int {
@@ -0,0 +1,133 @@
+package lemon_test
+
+import (
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func keysOf(docs []*lemon.Document) []string {
+	keys := make([]string, 0, len(docs))
+	for _, d := range docs {
+		keys = append(keys, d.Key())
+	}
+
+	return keys
+}
+
+func TestQueryTags_Groups(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	users := []struct {
+		key    string
+		city   string
+		active bool
+		plan   string
+		age    int
+	}{
+		{key: "user:1", city: "Budapest", active: true, plan: "pro", age: 30},
+		{key: "user:2", city: "Budapest", active: true, plan: "free", age: 41},
+		{key: "user:3", city: "Budapest", active: false, plan: "team", age: 25},
+		{key: "user:4", city: "Vienna", active: true, plan: "team", age: 52},
+		{key: "user:5", city: "Budapest", active: true, plan: "team", age: 19},
+		{key: "user:6", city: "Prague", active: false, plan: "free", age: 33},
+	}
+
+	for _, u := range users {
+		require.NoError(t, db.Insert(u.key, lemon.M{"age": u.age}, lemon.WithTags().
+			Str("city", u.city).
+			Bool("active", u.active).
+			Str("plan", u.plan).
+			Int("age", u.age),
+		))
+	}
+
+	require.NoError(t, db.Insert("user:7", lemon.M{"age": 70}))
+
+	tt := []struct {
+		name string
+		q    *lemon.QueryOptions
+		keys []string
+	}{
+		{
+			name: "all tags must match",
+			q:    lemon.Q().HasAllTags(lemon.QT().StrTagEq("city", "Budapest").BoolTagEq("active", true)),
+			keys: []string{"user:1", "user:2", "user:5"},
+		},
+		{
+			name: "and with or group",
+			q: lemon.Q().HasAllTags(lemon.QT().
+				StrTagEq("city", "Budapest").
+				BoolTagEq("active", true).
+				Group(lemon.Or(lemon.QT().StrTagEq("plan", "pro"), lemon.QT().StrTagEq("plan", "team"))),
+			),
+			keys: []string{"user:1", "user:5"},
+		},
+		{
+			name: "has any tags combined with has all tags",
+			q: lemon.Q().
+				HasAllTags(lemon.QT().BoolTagEq("active", true)).
+				HasAnyTags(lemon.QT().StrTagEq("plan", "pro").StrTagEq("plan", "team")),
+			keys: []string{"user:1", "user:4", "user:5"},
+		},
+		{
+			name: "not",
+			q:    lemon.Q().HasAllTags(lemon.Not(lemon.QT().StrTagEq("city", "Budapest"))),
+			keys: []string{"user:4", "user:6", "user:7"},
+		},
+		{
+			name: "not narrows down other conditions",
+			q: lemon.Q().HasAllTags(lemon.QT().
+				StrTagEq("city", "Budapest").
+				Group(lemon.Not(lemon.QT().StrTagEq("plan", "free")), lemon.Not(lemon.QT().IntTagLt("age", 20))),
+			),
+			keys: []string{"user:1", "user:3"},
+		},
+		{
+			name: "nested groups",
+			q: lemon.Q().HasAllTags(lemon.Or(
+				lemon.And(lemon.QT().StrTagEq("city", "Vienna"), lemon.QT().IntTagGt("age", 50)),
+				lemon.QT().StrTagEq("city", "Prague"),
+			)),
+			keys: []string{"user:4", "user:6"},
+		},
+		{
+			name: "non existent tag value matches nothing",
+			q:    lemon.Q().HasAllTags(lemon.QT().StrTagEq("city", "Berlin")),
+			keys: []string{},
+		},
+		{
+			name: "non existent tag name matches nothing",
+			q:    lemon.Q().HasAllTags(lemon.QT().StrTagEq("city", "Budapest").StrTagEq("country", "HU")),
+			keys: []string{},
+		},
+		{
+			name: "descending order",
+			q: lemon.Q().
+				KeyOrder(lemon.DescOrder).
+				HasAnyTags(lemon.QT().StrTagEq("city", "Vienna").IntTagGt("age", 40)),
+			keys: []string{"user:4", "user:2"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.Find(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+		})
+	}
+
+	t.Run("invalid tag type", func(t *testing.T) {
+		_, err := db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagEq("city", 1)))
+		require.Error(t, err)
+	})
+}
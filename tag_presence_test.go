@@ -0,0 +1,163 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestQueryTags_Presence(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("user:1", lemon.M{"name": "Alice"}, lemon.WithTags().Str("email", "a@example.com").Int("age", 30)))
+	require.NoError(t, db.Insert("user:2", lemon.M{"name": "Bob"}, lemon.WithTags().Int("age", 41)))
+	require.NoError(t, db.Insert("user:3", lemon.M{"name": "Carol"}, lemon.WithTags().Str("email", "c@example.com")))
+	require.NoError(t, db.Insert("session:1", "token", lemon.WithTTL(time.Hour)))
+	require.NoError(t, db.Insert("product:1", lemon.M{"price": 9.5}, lemon.WithTags().Float("price", 9.5)))
+
+	tt := []struct {
+		name string
+		q    *lemon.QueryOptions
+		keys []string
+	}{
+		{
+			name: "has tag",
+			q:    lemon.Q().HasAllTags(lemon.QT().HasTag("email")),
+			keys: []string{"user:1", "user:3"},
+		},
+		{
+			name: "missing tag",
+			q:    lemon.Q().Match("user:*").HasAllTags(lemon.QT().MissingTag("email")),
+			keys: []string{"user:2"},
+		},
+		{
+			name: "has and missing",
+			q:    lemon.Q().HasAllTags(lemon.QT().HasTag("age").MissingTag("email")),
+			keys: []string{"user:2"},
+		},
+		{
+			name: "has any",
+			q:    lemon.Q().HasAnyTags(lemon.QT().HasTag("email").HasTag("price")),
+			keys: []string{"product:1", "user:1", "user:3"},
+		},
+		{
+			name: "unknown tag is missing everywhere",
+			q:    lemon.Q().Match("user:*").HasAllTags(lemon.QT().MissingTag("phone")),
+			keys: []string{"user:1", "user:2", "user:3"},
+		},
+		{
+			name: "unknown tag is never present",
+			q:    lemon.Q().HasAllTags(lemon.QT().HasTag("phone")),
+			keys: []string{},
+		},
+		{
+			name: "tag of type",
+			q:    lemon.Q().HasAllTags(lemon.QT().TagOfType("price", lemon.FloatTagType)),
+			keys: []string{"product:1"},
+		},
+		{
+			name: "tag of other type",
+			q:    lemon.Q().HasAllTags(lemon.QT().TagOfType("price", lemon.IntTagType)),
+			keys: []string{},
+		},
+		{
+			name: "meta tags",
+			q: lemon.Q().HasAllTags(lemon.QT().
+				HasTag(lemon.ExpiresAt).
+				TagOfType(lemon.ContentType, lemon.StrTagType)),
+			keys: []string{"session:1"},
+		},
+		{
+			name: "missing meta tag",
+			q:    lemon.Q().HasAllTags(lemon.QT().MissingTag(lemon.ExpiresAt).HasTag("age")),
+			keys: []string{"user:1", "user:2"},
+		},
+		{
+			name: "checked while scanning a key range",
+			q:    lemon.Q().KeyRange("user:1", "user:2").HasAllTags(lemon.QT().HasTag("email")),
+			keys: []string{"user:1"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.Find(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+		})
+	}
+
+	t.Run("presence is estimated from the tag index", func(t *testing.T) {
+		e, err := db.Explain(lemon.Q().HasAllTags(lemon.QT().HasTag("email")))
+		require.NoError(t, err)
+		assert.Equal(t, lemon.TagIndexScan, e.Strategy)
+		assert.Equal(t, []string{"email"}, e.Indexes)
+		assert.Equal(t, 2, e.EstimatedRows)
+		assert.Equal(t, 2, e.ActualRows)
+	})
+
+	t.Run("counts follow untag and removal", func(t *testing.T) {
+		require.NoError(t, db.Untag("user:1", "email"))
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.Remove("user:3")
+		}))
+
+		e, err := db.Explain(lemon.Q().HasAllTags(lemon.QT().HasTag("age")))
+		require.NoError(t, err)
+		assert.Equal(t, 2, e.EstimatedRows)
+
+		docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().HasTag("email")))
+		require.NoError(t, err)
+		assert.Empty(t, docs)
+	})
+
+	t.Run("invalid tag type", func(t *testing.T) {
+		_, err := db.Find(lemon.Q().HasAllTags(lemon.QT().TagOfType("age", "date")))
+		assert.True(t, errors.Is(err, lemon.ErrInvalidTagType))
+	})
+}
+
+func TestQueryTags_PresenceAfterBulkLoad(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	var items []lemon.BulkItem
+	for i := 1; i <= 10; i++ {
+		tags := lemon.WithTags().Int("n", i)
+		if i%3 == 0 {
+			tags = tags.Bool("third", true)
+		}
+
+		items = append(items, lemon.BulkItem{Key: fmt.Sprintf("item:%02d", i), Data: lemon.M{"n": i}, Meta: []lemon.MetaApplier{tags}})
+	}
+
+	_, err = db.BulkLoad(context.Background(), lemon.NewSliceBulkIterator(items))
+	require.NoError(t, err)
+
+	e, err := db.Explain(lemon.Q().HasAllTags(lemon.QT().HasTag("third")))
+	require.NoError(t, err)
+	assert.Equal(t, 3, e.EstimatedRows)
+	assert.Equal(t, 3, e.ActualRows)
+
+	count, err := db.CountByQuery(lemon.Q().HasAllTags(lemon.QT().MissingTag("third")))
+	require.NoError(t, err)
+	assert.Equal(t, 7, count)
+}
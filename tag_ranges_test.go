@@ -0,0 +1,86 @@
+package lemon_test
+
+import (
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestQueryTags_Ranges(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	products := []struct {
+		key   string
+		name  string
+		qty   int
+		price float64
+		sale  bool
+	}{
+		{key: "product:1", name: "apple", qty: 10, price: 1.5, sale: true},
+		{key: "product:2", name: "apricot", qty: 20, price: 2.25, sale: false},
+		{key: "product:3", name: "banana", qty: 30, price: 0.99, sale: false},
+		{key: "product:4", name: "blueberry", qty: 40, price: 7.5, sale: true},
+		{key: "product:5", name: "cherry", qty: 50, price: 12.0, sale: false},
+	}
+
+	for _, p := range products {
+		require.NoError(t, db.Insert(p.key, lemon.M{"name": p.name}, lemon.WithTags().
+			Str("name", p.name).
+			Int("qty", p.qty).
+			Float("price", p.price).
+			Bool("sale", p.sale),
+		))
+	}
+
+	tt := []struct {
+		name string
+		qt   *lemon.QueryTags
+		keys []string
+	}{
+		{name: "int gt", qt: lemon.QT().IntTagGt("qty", 30), keys: []string{"product:4", "product:5"}},
+		{name: "int gte", qt: lemon.QT().IntTagGte("qty", 30), keys: []string{"product:3", "product:4", "product:5"}},
+		{name: "int lt", qt: lemon.QT().IntTagLt("qty", 20), keys: []string{"product:1"}},
+		{name: "int lte", qt: lemon.QT().IntTagLte("qty", 20), keys: []string{"product:1", "product:2"}},
+		{name: "int between", qt: lemon.QT().IntTagBetween("qty", 20, 40), keys: []string{"product:2", "product:3", "product:4"}},
+		{name: "int between reversed", qt: lemon.QT().IntTagBetween("qty", 40, 20), keys: []string{}},
+		{name: "int in", qt: lemon.QT().IntTagIn("qty", 10, 50, 60), keys: []string{"product:1", "product:5"}},
+		{name: "float lt", qt: lemon.QT().FloatTagLt("price", 1.5), keys: []string{"product:3"}},
+		{name: "float lte", qt: lemon.QT().FloatTagLte("price", 1.5), keys: []string{"product:1", "product:3"}},
+		{name: "float gte", qt: lemon.QT().FloatTagGte("price", 7.5), keys: []string{"product:4", "product:5"}},
+		{name: "float between", qt: lemon.QT().FloatTagBetween("price", 1, 7.5), keys: []string{"product:1", "product:2", "product:4"}},
+		{name: "float in", qt: lemon.QT().FloatTagIn("price", 0.99, 12.0), keys: []string{"product:3", "product:5"}},
+		{name: "str gt", qt: lemon.QT().StrTagGt("name", "blueberry"), keys: []string{"product:5"}},
+		{name: "str gte", qt: lemon.QT().StrTagGte("name", "blueberry"), keys: []string{"product:4", "product:5"}},
+		{name: "str lt", qt: lemon.QT().StrTagLt("name", "apricot"), keys: []string{"product:1"}},
+		{name: "str lte", qt: lemon.QT().StrTagLte("name", "apricot"), keys: []string{"product:1", "product:2"}},
+		{name: "str between", qt: lemon.QT().StrTagBetween("name", "apricot", "blueberry"), keys: []string{"product:2", "product:3", "product:4"}},
+		{name: "str prefix", qt: lemon.QT().StrTagPrefix("name", "ap"), keys: []string{"product:1", "product:2"}},
+		{name: "str prefix no match", qt: lemon.QT().StrTagPrefix("name", "kiwi"), keys: []string{}},
+		{name: "str in", qt: lemon.QT().StrTagIn("name", "banana", "cherry", "kiwi"), keys: []string{"product:3", "product:5"}},
+		{name: "bool in", qt: lemon.QT().BoolTagIn("sale", true, false), keys: []string{"product:1", "product:2", "product:3", "product:4", "product:5"}},
+		{name: "combined", qt: lemon.QT().IntTagGte("qty", 20).FloatTagLt("price", 10).BoolTagEq("sale", false), keys: []string{"product:2", "product:3"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.Find(lemon.Q().HasAllTags(tc.qt))
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+		})
+	}
+
+	t.Run("value type must match tag type", func(t *testing.T) {
+		_, err := db.Find(lemon.Q().HasAllTags(lemon.QT().IntTagGt("sale", 1)))
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrInvalidTagType))
+	})
+}
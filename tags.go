@@ -133,7 +133,19 @@ type TagApplier struct {
 }
 
 func (ta *TagApplier) applyTo(e *entry) error {
-	e.tags = ta.tags
+	if ta.err != nil {
+		return ta.err
+	}
+
+	if e.tags == nil {
+		e.tags = newTags()
+	}
+
+	// other meta appliers like timestamps may have already set their tags
+	for name, t := range ta.tags {
+		e.tags[name] = t
+	}
+
 	return nil
 }
 
@@ -180,6 +192,21 @@ func (t tags) removeByName(name string) {
 	}
 }
 
+// clone - copies tags into a new map, so that tags of the copy
+// can be replaced without affecting the original
+func (t tags) clone() tags {
+	if t == nil {
+		return nil
+	}
+
+	cp := make(tags, len(t))
+	for name, tg := range t {
+		cp[name] = tg
+	}
+
+	return cp
+}
+
 func (t tags) count() int {
 	return len(t)
 }
@@ -261,6 +288,10 @@ func newBoolTag(value bool) *boolTag {
 	}
 }
 
+func (t *boolTag) getValue() interface{} {
+	return t.value
+}
+
 type strTag struct {
 	value string
 	entries
@@ -273,6 +304,10 @@ func newStrTag(value string) *strTag {
 	}
 }
 
+func (t *strTag) getValue() interface{} {
+	return t.value
+}
+
 type intTag struct {
 	value int
 	entries
@@ -285,11 +320,16 @@ func newIntTag(value int) *intTag {
 	}
 }
 
+func (t *intTag) getValue() interface{} {
+	return t.value
+}
+
 type entryContainer interface {
 	setEntry(ent *entry)
 	getEntry(key string) *entry
 	hasEntry(key string) bool
 	getEntries() map[string]*entry
+	getValue() interface{}
 	remove(key string)
 }
 
@@ -304,3 +344,7 @@ func newFloatTag(value float64) *floatTag {
 		entries: make(entries),
 	}
 }
+
+func (t *floatTag) getValue() interface{} {
+	return t.value
+}
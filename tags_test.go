@@ -3,6 +3,7 @@ package lemon_test
 import (
 	"context"
 	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"os"
@@ -407,3 +408,53 @@ func seedTaggedCars(t *testing.T, db *lemon.DB, wg *sync.WaitGroup) {
 		t.Fatal(err)
 	}
 }
+
+func TestTx_TagReplacesValue(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("product:1", lemon.M{"name": "shoes"}, lemon.M{"color": "red"}))
+	require.NoError(t, db.Insert("product:2", lemon.M{"name": "hat"}, lemon.M{"color": "red"}))
+	require.NoError(t, db.Tag("product:1", lemon.M{"color": "blue"}))
+
+	docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "red")))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "product:2", docs[0].Key())
+
+	docs, err = db.Find(lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "blue")))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "product:1", docs[0].Key())
+}
+
+func TestTx_InsertOrReplaceReplacesTags(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("product:1", lemon.M{"name": "shoes"}, lemon.M{"color": "red"}))
+	require.NoError(t, db.Insert("product:2", lemon.M{"name": "hat"}, lemon.M{"color": "red"}))
+	require.NoError(t, db.InsertOrReplace("product:1", lemon.M{"name": "boots"}, lemon.M{"color": "green"}))
+
+	docs, err := db.Find(lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "red")))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "product:2", docs[0].Key())
+
+	docs, err = db.Find(lemon.Q().HasAllTags(lemon.QT().StrTagEq("color", "green")))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "product:1", docs[0].Key())
+}
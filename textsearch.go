@@ -0,0 +1,439 @@
+package lemon
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// EnglishStopWords - common English words that are usually not worth indexing
+var EnglishStopWords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in", "into", "is", "it",
+	"no", "not", "of", "on", "or", "such", "that", "the", "their", "then", "there", "these",
+	"they", "this", "to", "was", "will", "with",
+}
+
+// TextIndexOptions - configuration of a full-text index
+type TextIndexOptions struct {
+	// Fields - JSON paths of string fields of JSON documents,
+	// entire String documents are indexed when there are no fields
+	Fields []JSONPath
+	// Stemming - reduces English words to their stems, so that e.g. cafes matches cafe
+	Stemming bool
+	// StopWords - words left out of both documents and queries, see EnglishStopWords
+	StopWords []string
+}
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type textDoc struct {
+	ent    *entry
+	terms  map[string]int
+	length int
+}
+
+// textIndex - inverted index of words of documents, only its definition is persisted,
+// postings are rebuilt from documents when the database is loaded
+type textIndex struct {
+	name      string
+	fields    []JSONPath
+	stemming  bool
+	stopWords []string
+
+	stops    map[string]struct{}
+	docs     map[string]*textDoc
+	postings map[string]map[string]int
+	totalLen int
+}
+
+func newTextIndex(name string, opts *TextIndexOptions) *textIndex {
+	ti := &textIndex{
+		name:     name,
+		fields:   opts.Fields,
+		stemming: opts.Stemming,
+		stops:    make(map[string]struct{}, len(opts.StopWords)),
+	}
+
+	for _, w := range opts.StopWords {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if _, ok := ti.stops[w]; w == "" || ok {
+			continue
+		}
+
+		ti.stops[w] = struct{}{}
+		ti.stopWords = append(ti.stopWords, w)
+	}
+
+	sort.Strings(ti.stopWords)
+	ti.reset()
+
+	return ti
+}
+
+func (ti *textIndex) reset() {
+	ti.docs = make(map[string]*textDoc)
+	ti.postings = make(map[string]map[string]int)
+	ti.totalLen = 0
+}
+
+// tokenize - splits text into lowercased words leaving out stop words, stems them when configured
+func (ti *textIndex) tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	tokens := words[:0]
+	for _, w := range words {
+		if _, ok := ti.stops[w]; ok {
+			continue
+		}
+
+		if ti.stemming {
+			w = stem(w)
+		}
+
+		tokens = append(tokens, w)
+	}
+
+	return tokens
+}
+
+// accepts - entry is of the kind of documents the index is built from
+func (ti *textIndex) accepts(ent *entry) bool {
+	if len(ti.fields) > 0 {
+		return isJSONEntry(ent)
+	}
+
+	ct, ok := ent.tags[ContentType]
+	return ok && ct.data == string(String)
+}
+
+// text - words of the document, strings of configured fields are joined,
+// arrays of strings are joined as well
+func (ti *textIndex) text(v []byte) string {
+	if len(ti.fields) == 0 {
+		return string(v)
+	}
+
+	var sb strings.Builder
+	add := func(res gjson.Result) {
+		if res.Type == gjson.String {
+			sb.WriteString(res.Str)
+			sb.WriteByte(' ')
+		}
+	}
+
+	for _, path := range ti.fields {
+		res := gjson.GetBytes(v, string(path))
+		if res.IsArray() {
+			for _, item := range res.Array() {
+				add(item)
+			}
+		} else {
+			add(res)
+		}
+	}
+
+	return sb.String()
+}
+
+func (ti *textIndex) add(ent *entry, v []byte) {
+	key := ent.key.String()
+	ti.remove(key)
+
+	tokens := ti.tokenize(ti.text(v))
+	if len(tokens) == 0 {
+		return
+	}
+
+	doc := &textDoc{ent: ent, terms: make(map[string]int), length: len(tokens)}
+	for _, t := range tokens {
+		doc.terms[t]++
+	}
+
+	for t, freq := range doc.terms {
+		if ti.postings[t] == nil {
+			ti.postings[t] = make(map[string]int)
+		}
+
+		ti.postings[t][key] = freq
+	}
+
+	ti.docs[key] = doc
+	ti.totalLen += doc.length
+}
+
+func (ti *textIndex) remove(key string) {
+	doc, ok := ti.docs[key]
+	if !ok {
+		return
+	}
+
+	for t := range doc.terms {
+		delete(ti.postings[t], key)
+		if len(ti.postings[t]) == 0 {
+			delete(ti.postings, t)
+		}
+	}
+
+	delete(ti.docs, key)
+	ti.totalLen -= doc.length
+}
+
+type textHit struct {
+	ent   *entry
+	score float64
+}
+
+// search - documents containing at least one word of the query ranked by BM25,
+// documents with equal scores are ordered by keys
+func (ti *textIndex) search(query string) []textHit {
+	if len(ti.docs) == 0 {
+		return nil
+	}
+
+	n := float64(len(ti.docs))
+	avgLen := float64(ti.totalLen) / n
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+
+	for _, t := range ti.tokenize(query) {
+		if seen[t] {
+			continue
+		}
+
+		seen[t] = true
+
+		postings := ti.postings[t]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for key, freq := range postings {
+			tf := float64(freq)
+			norm := 1 - bm25B + bm25B*float64(ti.docs[key].length)/avgLen
+			scores[key] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	hits := make([]textHit, 0, len(scores))
+	for key, score := range scores {
+		hits = append(hits, textHit{ent: ti.docs[key].ent, score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+
+		return hits[i].ent.key.Less(hits[j].ent.key)
+	})
+
+	return hits
+}
+
+func (ti *textIndex) serialize(rs *respSerializer) error {
+	return rs.serializeTextIndexCommand(ti)
+}
+
+func (ti *textIndex) deserialize(e executionEngine) error {
+	return e.DefineTextIndex(ti)
+}
+
+// stem - light English stemmer stripping the most common inflectional suffixes,
+// it is only meant to make different forms of a word match each other
+func stem(w string) string {
+	if len(w) <= 3 {
+		return w
+	}
+
+	switch {
+	case strings.HasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case strings.HasSuffix(w, "ies"):
+		w = w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "ss"), strings.HasSuffix(w, "us"), strings.HasSuffix(w, "is"):
+	case strings.HasSuffix(w, "s"):
+		w = w[:len(w)-1]
+	}
+
+	for _, suffix := range []string{"ingly", "edly", "ing", "ed", "ly"} {
+		base := strings.TrimSuffix(w, suffix)
+		if base == w || len(base) < 3 || !strings.ContainsAny(base, "aeiouy") {
+			continue
+		}
+
+		// running -> run, stopped -> stop
+		if l := len(base); base[l-1] == base[l-2] && !strings.ContainsRune("aeiouylsz", rune(base[l-1])) {
+			base = base[:l-1]
+		}
+
+		return base
+	}
+
+	return w
+}
+
+// CreateTextIndex - builds a full-text index from existing documents, from now on it is maintained
+// on every insert, replace and removal, only the definition is persisted and the index is rebuilt
+// from documents when the database is reopened
+func (ee *defaultEngine) CreateTextIndex(name string, opts *TextIndexOptions) error {
+	ee.Lock()
+	defer ee.Unlock()
+
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if name == "" {
+		return errors.Wrap(ErrInvalidIndexType, "index name cannot be empty")
+	}
+
+	if opts == nil {
+		opts = &TextIndexOptions{}
+	}
+
+	if _, ok := ee.textIndexes[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "%s", name)
+	}
+
+	if _, ok := ee.fieldIndexes[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "%s", name)
+	}
+
+	if _, ok := ee.compositeIndexes[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "%s", name)
+	}
+
+	ti := newTextIndex(name, opts)
+	if err := ee.buildTextIndex(ti); err != nil {
+		return errors.Wrapf(err, "could not build text index %s", name)
+	}
+
+	if err := ee.Persist([]serializable{ti}); err != nil {
+		return err
+	}
+
+	ee.textIndexes[name] = ti
+
+	return nil
+}
+
+// DefineTextIndex - registers a text index, it is built after the whole log is loaded
+func (ee *defaultEngine) DefineTextIndex(ti *textIndex) error {
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	ee.textIndexes[ti.name] = ti
+	return nil
+}
+
+func (ee *defaultEngine) buildTextIndex(ti *textIndex) error {
+	ti.reset()
+
+	var loadErr error
+	ee.pks.Ascend(nil, func(item interface{}) bool {
+		if loadErr = ee.indexTextOf(ti, item.(*entry)); loadErr != nil {
+			return false
+		}
+
+		return true
+	})
+
+	return loadErr
+}
+
+func (ee *defaultEngine) rebuildTextIndexes() error {
+	for name, ti := range ee.textIndexes {
+		if err := ee.buildTextIndex(ti); err != nil {
+			return errors.Wrapf(err, "could not build text index %s", name)
+		}
+	}
+
+	return nil
+}
+
+// indexText - puts words of the entry into text indexes replacing its previous words,
+// text indexes are rebuilt after the log is replayed, so nothing is done while loading
+func (ee *defaultEngine) indexText(ent *entry) error {
+	if ee.replaying {
+		return nil
+	}
+
+	for _, ti := range ee.textIndexes {
+		if err := ee.indexTextOf(ti, ent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ee *defaultEngine) indexTextOf(ti *textIndex, ent *entry) error {
+	if !ti.accepts(ent) {
+		ti.remove(ent.key.String())
+		return nil
+	}
+
+	if ent.value != nil {
+		ti.add(ent, ent.value)
+		return nil
+	}
+
+	if err := ee.LoadEntryValue(ent); err != nil {
+		return err
+	}
+
+	ti.add(ent, ent.value)
+
+	// values of lazily loaded entries should not stay in memory
+	if ee.cfg.ValueLoadStrategy != EagerLoad {
+		ent.value = nil
+	}
+
+	return nil
+}
+
+func (ee *defaultEngine) unindexText(ent *entry) {
+	for _, ti := range ee.textIndexes {
+		if doc, ok := ti.docs[ent.key.String()]; ok && doc.ent == ent {
+			ti.remove(ent.key.String())
+		}
+	}
+}
+
+// planTextSearch - candidates are documents found by a text index in the order of their scores,
+// tags are checked on every candidate
+func (ee *defaultEngine) planTextSearch(q *QueryOptions) (*queryPlan, error) {
+	ti, ok := ee.textIndexes[q.text.index]
+	if !ok {
+		return nil, errors.Wrapf(ErrIndexNotFound, "text index %s", q.text.index)
+	}
+
+	p := &queryPlan{strategy: TextIndexScan, indexes: []string{ti.name}, sink: newFilteredEntriesSink(q)}
+
+	if q.tags != nil && !q.tags.empty() {
+		// validates types of tag conditions
+		if _, err := newTagMatcher(ee.tags, ee.allEntries, ee.pks.Len()).estimate(q.tags); err != nil {
+			return nil, err
+		}
+
+		p.tags = q.tags
+	}
+
+	for _, hit := range ti.search(q.text.query) {
+		p.sink.add(hit.ent)
+	}
+
+	p.estimated = len(p.sink.keys)
+
+	return p, nil
+}
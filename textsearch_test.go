@@ -0,0 +1,171 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDB_TextSearch(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("note:1", "Coffee in a small cafe near the Danube in Budapest"))
+	require.NoError(t, db.Insert("note:2", "Budapest, Budapest! Thermal baths and ruin bars of Budapest"))
+	require.NoError(t, db.Insert("note:3", "Vienna has the best cafes and cakes"))
+	require.NoError(t, db.Insert("note:4", "Walking along the river"))
+	require.NoError(t, db.Insert("place:1", lemon.M{"title": "Central Cafe", "tags": []string{"budapest", "coffee"}},
+		lemon.WithTags().Bool("open", true)))
+	require.NoError(t, db.Insert("place:2", lemon.M{"title": "Sacher", "description": "Famous cafe in Vienna"},
+		lemon.WithTags().Bool("open", false)))
+
+	require.NoError(t, db.CreateTextIndex("notes", &lemon.TextIndexOptions{
+		Stemming:  true,
+		StopWords: lemon.EnglishStopWords,
+	}))
+	require.NoError(t, db.CreateTextIndex("places", &lemon.TextIndexOptions{
+		Fields: []lemon.JSONPath{"title", "description", "tags"},
+	}))
+
+	search := func(qo *lemon.QueryOptions) []string {
+		docs, err := db.Find(qo)
+		require.NoError(t, err)
+		return keysOf(docs)
+	}
+
+	t.Run("results are ranked by relevance", func(t *testing.T) {
+		assert.Equal(t, []string{"note:2", "note:1"}, search(lemon.Q().MatchText("notes", "budapest")))
+		assert.Equal(t, []string{"note:1", "note:2", "note:3"}, search(lemon.Q().MatchText("notes", "Budapest CAFE")))
+	})
+
+	t.Run("stemming and stop words", func(t *testing.T) {
+		assert.Equal(t, []string{"note:3", "note:1"}, search(lemon.Q().MatchText("notes", "cafes")))
+		assert.Equal(t, []string{"note:4"}, search(lemon.Q().MatchText("notes", "walked")))
+		assert.Equal(t, []string{}, search(lemon.Q().MatchText("notes", "the and of")))
+	})
+
+	t.Run("fields of JSON documents", func(t *testing.T) {
+		assert.Equal(t, []string{"place:1", "place:2"}, search(lemon.Q().MatchText("places", "cafe")))
+		assert.Equal(t, []string{"place:1"}, search(lemon.Q().MatchText("places", "coffee")))
+		assert.Equal(t, []string{}, search(lemon.Q().MatchText("places", "cafes")))
+	})
+
+	t.Run("combined with other filters", func(t *testing.T) {
+		qo := lemon.Q().MatchText("places", "cafe").HasAllTags(lemon.QT().BoolTagEq("open", false))
+		assert.Equal(t, []string{"place:2"}, search(qo))
+
+		assert.Equal(t, []string{"note:2"}, search(lemon.Q().MatchText("notes", "budapest cafe").Limit(1).Offset(1)))
+
+		e, err := db.Explain(lemon.Q().MatchText("notes", "budapest"))
+		require.NoError(t, err)
+		assert.Equal(t, lemon.TextIndexScan, e.Strategy)
+		assert.Equal(t, []string{"notes"}, e.Indexes)
+		assert.Equal(t, 2, e.ActualRows)
+	})
+
+	t.Run("index is maintained on writes", func(t *testing.T) {
+		require.NoError(t, db.Insert("note:5", "Budapest at night"))
+		require.NoError(t, db.InsertOrReplace("note:2", "Nothing to see here"))
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.Remove("note:1")
+		}))
+
+		assert.Equal(t, []string{"note:5"}, search(lemon.Q().MatchText("notes", "budapest")))
+
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.InsertOrReplace("note:5", "Prague at night"); err != nil {
+				return err
+			}
+
+			return errors.New("abort")
+		})
+
+		require.Error(t, err)
+		assert.Equal(t, []string{"note:5"}, search(lemon.Q().MatchText("notes", "budapest")))
+		assert.Equal(t, []string{}, search(lemon.Q().MatchText("notes", "prague")))
+	})
+
+	t.Run("invalid text queries", func(t *testing.T) {
+		_, err := db.Find(lemon.Q().MatchText("unknown", "budapest"))
+		assert.True(t, errors.Is(err, lemon.ErrIndexNotFound))
+
+		_, err = db.Find(lemon.Q().MatchText("notes", "budapest").ByTagName("open"))
+		assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+
+		assert.True(t, errors.Is(db.CreateTextIndex("notes", nil), lemon.ErrIndexAlreadyExists))
+	})
+
+	t.Run("drop text index", func(t *testing.T) {
+		require.NoError(t, db.DropIndex("places"))
+
+		_, err := db.Find(lemon.Q().MatchText("places", "cafe"))
+		assert.True(t, errors.Is(err, lemon.ErrIndexNotFound))
+	})
+}
+
+func TestDB_TextSearch_Persistence(t *testing.T) {
+	for _, vls := range []lemon.ValueLoadStrategy{lemon.EagerLoad, lemon.LazyLoad} {
+		t.Run(string(vls), func(t *testing.T) {
+			fixture := fmt.Sprintf("./__fixtures__/text_%s_db1.ldb", vls)
+			_ = os.Remove(fixture)
+
+			defer func() {
+				if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+					t.Errorf("ERROR: %v", err)
+				}
+			}()
+
+			open := func(disableVacuum bool) (*lemon.DB, lemon.Closer) {
+				db, closer, err := lemon.Open(fixture, &lemon.Config{
+					DisableAutoVacuum:   disableVacuum,
+					PersistenceStrategy: lemon.Sync,
+					ValueLoadStrategy:   vls,
+				})
+
+				require.NoError(t, err)
+				return db, closer
+			}
+
+			db, closer := open(true)
+			require.NoError(t, db.Insert("note:1", "Lunch in Budapest"))
+			require.NoError(t, db.CreateTextIndex("notes", &lemon.TextIndexOptions{
+				Stemming:  true,
+				StopWords: []string{"in"},
+			}))
+			require.NoError(t, db.Insert("note:2", "Dinners in Budapest and Vienna"))
+			require.NoError(t, closer())
+
+			// the index is rebuilt from documents on load
+			db, closer = open(false)
+			docs, err := db.Find(lemon.Q().MatchText("notes", "budapest dinner"))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"note:2", "note:1"}, keysOf(docs))
+
+			require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+				return tx.Remove("note:1")
+			}))
+			require.NoError(t, closer())
+
+			// and its definition survives vacuum
+			db, closer = open(true)
+			defer func() {
+				require.NoError(t, closer())
+			}()
+
+			docs, err = db.Find(lemon.Q().MatchText("notes", "budapest in"))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"note:2"}, keysOf(docs))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package lemon
+
+import (
+	"time"
+)
+
+// ExpiresAt - meta tag that holds expiration time of a document in unix milliseconds
+const ExpiresAt = "_ea"
+
+// Clock - source of current time for expiration of keys,
+// can be replaced in Config e.g. for tests
+type Clock interface {
+	Now() time.Time
+}
+
+type timedMetaApplier interface {
+	MetaApplier
+	applyAt(e *entry, now time.Time) error
+}
+
+type expirationApplier struct {
+	ttl time.Duration
+	at  time.Time
+}
+
+// WithTTL - document expires after given duration since it was written
+func WithTTL(d time.Duration) MetaApplier {
+	return &expirationApplier{ttl: d}
+}
+
+// WithExpireAt - document expires at given time
+func WithExpireAt(t time.Time) MetaApplier {
+	return &expirationApplier{at: t}
+}
+
+func (ea *expirationApplier) applyTo(e *entry) error {
+	return ea.applyAt(e, time.Now())
+}
+
+func (ea *expirationApplier) applyAt(e *entry, now time.Time) error {
+	if e.tags == nil {
+		e.tags = newTags()
+	}
+
+	e.tags[ExpiresAt] = &tag{dt: intDataType, data: int(ea.resolve(now).UnixMilli())}
+
+	return nil
+}
+
+func (ea *expirationApplier) resolve(now time.Time) time.Time {
+	if !ea.at.IsZero() {
+		return ea.at
+	}
+
+	return now.Add(ea.ttl)
+}
+
+func (ent *entry) expired(now time.Time) bool {
+	if ent.tags == nil {
+		return false
+	}
+
+	t, ok := ent.tags[ExpiresAt]
+	if !ok || t.dt != intDataType {
+		return false
+	}
+
+	return t.data.(int) <= int(now.UnixMilli())
+}
+
+// Expire sets time to live of an existing document
+func (x *Tx) Expire(key string, d time.Duration) error {
+	if x.ee == nil {
+		return ErrTxAlreadyClosed
+	}
+
+	return x.ExpireAt(key, x.ee.Now().Add(d))
+}
+
+// ExpireAt sets expiration time of an existing document
+func (x *Tx) ExpireAt(key string, t time.Time) error {
+	if x.ee == nil {
+		return ErrTxAlreadyClosed
+	}
+
+	return x.Tag(key, M{ExpiresAt: int(t.UnixMilli())})
+}
+
+// Persist removes expiration from a document,
+// nothing is changed if the document does not expire
+func (x *Tx) Persist(key string) error {
+	if x.readOnly {
+		return ErrTxIsReadOnly
+	}
+
+	if x.ee == nil {
+		return ErrTxAlreadyClosed
+	}
+
+	ent, err := x.find(key)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ent.tags[ExpiresAt]; !ok {
+		return nil
+	}
+
+	return x.Untag(key, ExpiresAt)
+}
+
+// TTL returns time left until a document expires,
+// false is returned for documents without expiration
+func (x *Tx) TTL(key string) (time.Duration, bool, error) {
+	if x.ee == nil {
+		return 0, false, ErrTxAlreadyClosed
+	}
+
+	ent, err := x.find(key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	t, ok := ent.tags[ExpiresAt]
+	if !ok {
+		return 0, false, nil
+	}
+
+	return time.UnixMilli(int64(t.data.(int))).Sub(x.ee.Now()), true, nil
+}
+
+func (ee *defaultEngine) scheduleReaper(d time.Duration) {
+	t := time.NewTicker(d)
+
+	for {
+		select {
+		case <-ee.stopCh:
+			t.Stop()
+			return
+		case <-t.C:
+			ee.Lock()
+			if err := ee.reapExpiredUnderLock(); err != nil {
+				ee.lg.Error(err)
+			}
+			ee.Unlock()
+		}
+	}
+}
+
+// reapExpiredUnderLock - removes expired entries using expiration index
+// and writes del commands for them
+func (ee *defaultEngine) reapExpiredUnderLock() error {
+	if ee.closed {
+		return nil
+	}
+
+	idx, ok := ee.tags.data[ExpiresAt]
+	if !ok || idx.dt != intDataType {
+		return nil
+	}
+
+	now := int(ee.Now().UnixMilli())
+
+	var expired []*entry
+	idx.btr.Ascend(nil, func(item interface{}) bool {
+		it := item.(*intTag)
+		if it.value > now {
+			return false
+		}
+
+		for _, ent := range it.entries {
+			expired = append(expired, ent)
+		}
+
+		return true
+	})
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	commands := make([]serializable, len(expired))
+	for i, ent := range expired {
+		commands[i] = &deleteCmd{key: ent.key, pos: ent.pos}
+	}
+
+	if err := ee.Persist(commands); err != nil {
+		return err
+	}
+
+	for _, ent := range expired {
+		ee.RemoveEntryUnderLock(ent)
+		ee.totalDeletes++
+	}
+
+	return nil
+}
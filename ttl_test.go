@@ -0,0 +1,181 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+}
+
+func TestTx_ExpiringKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)}
+
+	db, closer, err := lemon.Open(lemon.InMemory, &lemon.Config{
+		Clock:                    clock,
+		DisableExpiredKeysReaper: true,
+	})
+
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("session:1", lemon.M{"user": 1}, lemon.WithTTL(time.Minute)))
+	require.NoError(t, db.Insert("session:2", lemon.M{"user": 2}, lemon.WithExpireAt(clock.Now().Add(time.Hour))))
+	require.NoError(t, db.Insert("session:3", lemon.M{"user": 3}, lemon.WithTags().Str("kind", "session")))
+
+	t.Run("expiration time is available on document", func(t *testing.T) {
+		doc, err := db.Get("session:1")
+		require.NoError(t, err)
+		assert.Equal(t, clock.Now().Add(time.Minute).UnixMilli(), doc.ExpiresAt().UnixMilli())
+
+		doc, err = db.Get("session:3")
+		require.NoError(t, err)
+		assert.True(t, doc.ExpiresAt().IsZero())
+	})
+
+	t.Run("expired documents are invisible", func(t *testing.T) {
+		clock.advance(2 * time.Minute)
+
+		_, err := db.Get("session:1")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrKeyDoesNotExist))
+		assert.False(t, db.Has("session:1"))
+
+		docs, err := db.Find(lemon.Q().KeyOrder(lemon.AscOrder))
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "session:2", docs[0].Key())
+		assert.Equal(t, "session:3", docs[1].Key())
+
+		mDocs, err := db.MGet("session:1", "session:2")
+		require.NoError(t, err)
+		assert.Len(t, mDocs, 1)
+
+		assert.Equal(t, 2, db.Count())
+
+		count, err := db.CountByQuery(lemon.Q())
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("expired key can be inserted again", func(t *testing.T) {
+		require.NoError(t, db.Insert("session:1", lemon.M{"user": 11}))
+
+		doc, err := db.Get("session:1")
+		require.NoError(t, err)
+		assert.Equal(t, 11, doc.JSON().IntOrDefault("user", 0))
+		assert.True(t, doc.ExpiresAt().IsZero())
+	})
+
+	t.Run("expire and persist existing keys", func(t *testing.T) {
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.Expire("session:3", time.Second); err != nil {
+				return err
+			}
+
+			return tx.Persist("session:2")
+		}))
+
+		doc, err := db.Get("session:2")
+		require.NoError(t, err)
+		assert.True(t, doc.ExpiresAt().IsZero())
+
+		require.NoError(t, db.View(context.Background(), func(tx *lemon.Tx) error {
+			ttl, ok, err := tx.TTL("session:3")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, time.Second, ttl)
+			return nil
+		}))
+
+		clock.advance(time.Second)
+		assert.False(t, db.Has("session:3"))
+		assert.True(t, db.Has("session:2"))
+	})
+}
+
+func TestDB_ExpiredKeysReaper(t *testing.T) {
+	fixture := "./__fixtures__/ttl_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	clock := &fakeClock{now: time.Now()}
+	cfg := func() *lemon.Config {
+		return &lemon.Config{
+			DisableAutoVacuum:        true,
+			PersistenceStrategy:      lemon.Sync,
+			Clock:                    clock,
+			ExpiredKeysReapIntervals: 10 * time.Millisecond,
+		}
+	}
+
+	db, closer, err := lemon.Open(fixture, cfg())
+	require.NoError(t, err)
+
+	require.NoError(t, db.Insert("cache:1", "foo", lemon.WithTTL(time.Minute)))
+	require.NoError(t, db.Insert("cache:2", "bar", lemon.WithTTL(time.Hour)))
+	require.NoError(t, db.Insert("cache:3", "baz"))
+	require.NoError(t, closer())
+
+	// expiration survives restart
+	db, closer, err = lemon.Open(fixture, cfg())
+	require.NoError(t, err)
+
+	doc, err := db.Get("cache:2")
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(time.Hour).UnixMilli(), doc.ExpiresAt().UnixMilli())
+
+	clock.advance(2 * time.Minute)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, 2, db.Count())
+	require.NoError(t, closer())
+
+	contents := string(loadFixtureContents(t, fixture))
+	assert.Equal(t, 1, strings.Count(contents, "+del"))
+
+	db, closer, err = lemon.Open(fixture, cfg())
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	assert.False(t, db.Has("cache:1"))
+	assert.True(t, db.Has("cache:2"))
+	assert.True(t, db.Has("cache:3"))
+}
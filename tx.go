@@ -4,11 +4,14 @@ import (
 	"context"
 	"github.com/denismitr/glog"
 	"github.com/pkg/errors"
+	"strconv"
+	"time"
 )
 
 var ErrKeyDoesNotExist = errors.New("key does not exist in DB")
 var ErrTxIsReadOnly = errors.New("transaction is read only")
 var ErrTxAlreadyClosed = errors.New("transaction already closed")
+var ErrInvalidContentType = errors.New("invalid content type")
 
 type Tx struct {
 	readOnly        bool
@@ -19,6 +22,10 @@ type Tx struct {
 	replaced        []*entry
 	added           []*entry
 	lg              glog.Logger
+	changes         *changeTracker
+	onCommit        []func()
+	onRollback      []func()
+	iterators       []*Iterator
 }
 
 func (x *Tx) lock() {
@@ -42,18 +49,59 @@ func (x *Tx) Commit() error {
 		return ErrTxAlreadyClosed
 	}
 
-	defer func() {
-		x.unlock()
-		x.ee = nil
-		x.persistCommands = nil
-		x.replaced = nil
-		x.added = nil
-	}()
+	cfg := x.ee.Cfg()
+	if !x.readOnly && cfg.BeforeCommit != nil {
+		if err := cfg.BeforeCommit(x); err != nil {
+			if rbErr := x.Rollback(); rbErr != nil {
+				return errors.Wrapf(rbErr, "before commit hook failed: %s", err.Error())
+			}
+
+			return errors.Wrap(err, "before commit hook failed. rolled back")
+		}
+	}
+
+	// changes must be collected while the transaction still holds the lock
+	var changes []Change
+	if !x.readOnly && cfg.AfterCommit != nil {
+		changes = x.Changes()
+	}
+
+	onCommit := x.onCommit
+	onRollback := x.onRollback
 
+	// changes that could not be persisted must not stay visible in memory
+	if err := x.commitUnderLock(); err != nil {
+		if rbErr := x.rollbackUnderLock(); rbErr != nil {
+			return errors.Wrapf(rbErr, "could not persist transaction: %s", err.Error())
+		}
+
+		for _, fn := range onRollback {
+			fn()
+		}
+
+		return err
+	}
+
+	if len(changes) > 0 {
+		cfg.AfterCommit(changes)
+	}
+
+	for _, fn := range onCommit {
+		fn()
+	}
+
+	return nil
+}
+
+// commitUnderLock - the transaction is left open when its commands could not be persisted,
+// so that it can still be rolled back
+func (x *Tx) commitUnderLock() error {
 	if err := x.ee.Persist(x.persistCommands); err != nil {
 		return err
 	}
 
+	defer x.close()
+
 	for i := range x.updated {
 		x.updated[i].committed = true
 	}
@@ -70,26 +118,41 @@ func (x *Tx) Rollback() error {
 		return ErrTxAlreadyClosed
 	}
 
-	defer func() {
-		x.unlock()
-		x.ee = nil
-		x.persistCommands = nil
-		x.replaced = nil
-		x.added = nil
-	}()
+	onRollback := x.onRollback
+
+	if err := x.rollbackUnderLock(); err != nil {
+		return err
+	}
+
+	for _, fn := range onRollback {
+		fn()
+	}
+
+	return nil
+}
+
+func (x *Tx) rollbackUnderLock() error {
+	defer x.close()
 
 	if x.readOnly {
 		return nil
 	}
 
-	for _, ent := range x.replaced {
-		if err := x.ee.Put(ent, true); err != nil {
+	for _, ent := range x.added {
+		// key could have been removed later in the same transaction
+		if err := x.ee.Remove(ent.key); err != nil && !errors.Is(err, ErrKeyDoesNotExist) {
 			return err
 		}
 	}
 
-	for _, ent := range x.added {
-		if err := x.ee.Remove(ent.key); err != nil {
+	// only committed state is restored, and in reverse order,
+	// so that the earliest copy of an entry wins
+	for i := len(x.replaced) - 1; i >= 0; i-- {
+		if !x.replaced[i].committed {
+			continue
+		}
+
+		if err := x.ee.Put(x.replaced[i], true); err != nil {
 			return err
 		}
 	}
@@ -97,6 +160,24 @@ func (x *Tx) Rollback() error {
 	return nil
 }
 
+func (x *Tx) close() {
+	// scanners of iterators must not outlive the lock
+	for _, it := range x.iterators {
+		it.stop()
+	}
+
+	x.unlock()
+	x.ee = nil
+	x.persistCommands = nil
+	x.updated = nil
+	x.replaced = nil
+	x.added = nil
+	x.changes = nil
+	x.onCommit = nil
+	x.onRollback = nil
+	x.iterators = nil
+}
+
 func (x *Tx) FlushAll() error {
 	if x.readOnly {
 		return ErrTxIsReadOnly
@@ -105,6 +186,8 @@ func (x *Tx) FlushAll() error {
 	x.persistCommands = append(x.persistCommands, &flushAllCmd{})
 
 	return x.ee.FlushAll(func(ent *entry) {
+		x.touch(ent.key.String(), ent)
+
 		if ent.committed {
 			x.replaced = append(x.replaced, ent)
 		}
@@ -112,39 +195,54 @@ func (x *Tx) FlushAll() error {
 }
 
 func (x *Tx) Has(key string) bool {
-	return x.ee.Exists(key)
+	_, err := x.find(key)
+	return err == nil
 }
 
 func (x *Tx) Get(key string) (*Document, error) {
-	ent, err := x.ee.FindByKey(key)
+	ent, err := x.find(key)
 	if err != nil {
 		return nil, err
 	}
 
-	if ent.value == nil { // todo: check value strategy
-		if err := x.ee.LoadEntryValue(ent); err != nil {
-			return nil, err
-		}
+	ent, err = x.withValue(ent)
+	if err != nil {
+		return nil, err
 	}
 
 	return newDocumentFromEntry(ent), nil
 }
 
+// GetByUniqueTag - gets a document by the value of a unique tag
+func (x *Tx) GetByUniqueTag(name string, value interface{}) (*Document, error) {
+	ent, err := x.ee.FindByUniqueTag(name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return x.Get(ent.key.String())
+}
+
 // MGetContext - multi get by keys with context
 func (x *Tx) MGetContext(ctx context.Context, keys ...string) (map[string]*Document, error) {
 	docs := make(map[string]*Document, len(keys))
+	now := x.ee.Now()
 	if err := x.ee.IterateByKeys(keys, func(ent *entry) bool {
 		if ctx.Err() != nil {
 			return false
 		}
 
-		if ent.value == nil {
-			if err := x.ee.LoadEntryValue(ent); err != nil {
-				x.lg.Error(err)
-			}
+		if ent.expired(now) {
+			return true
+		}
+
+		withValue, err := x.withValue(ent)
+		if err != nil {
+			x.lg.Error(err)
+			withValue = ent
 		}
 
-		docs[ent.key.String()] = newDocumentFromEntry(ent)
+		docs[ent.key.String()] = newDocumentFromEntry(withValue)
 
 		return true
 	}); err != nil {
@@ -177,16 +275,27 @@ func (x *Tx) Insert(key string, data interface{}, metaAppliers ...MetaApplier) e
 
 	ent := newEntry(key, v)
 	ent.tags = newTags()
-	for _, applier := range metaAppliers {
-		if err := applier.applyTo(ent); err != nil {
-			return err
-		}
+	if err := x.applyMeta(ent, metaAppliers); err != nil {
+		return err
+	}
+
+	if err := x.ee.IndexFields(ent); err != nil {
+		return err
+	}
+
+	if err := x.ee.CheckUnique(ent.key, ent.tags); err != nil {
+		return err
+	}
+
+	if err := x.removeExpired(key); err != nil {
+		return err
 	}
 
 	if err := x.ee.Insert(ent); err != nil {
 		return err
 	}
 
+	x.touch(key, nil)
 	x.persistCommands = append(x.persistCommands, ent)
 	x.added = append(x.added, ent)
 
@@ -207,10 +316,20 @@ func (x *Tx) InsertOrReplace(key string, data interface{}, metaAppliers ...MetaA
 
 	newEnt := newEntry(key, v)
 	newEnt.tags = newTags()
-	for _, applier := range metaAppliers {
-		if err := applier.applyTo(newEnt); err != nil {
-			return err
-		}
+	if err := x.applyMeta(newEnt, metaAppliers); err != nil {
+		return err
+	}
+
+	if err := x.ee.IndexFields(newEnt); err != nil {
+		return err
+	}
+
+	if err := x.ee.CheckUnique(newEnt.key, newEnt.tags); err != nil {
+		return err
+	}
+
+	if err := x.removeExpired(key); err != nil {
+		return err
 	}
 
 	existingEnt, err := x.ee.FindByKey(key)
@@ -218,25 +337,35 @@ func (x *Tx) InsertOrReplace(key string, data interface{}, metaAppliers ...MetaA
 		return err
 	}
 
+	x.touch(key, existingEnt)
+
 	if existingEnt != nil {
 		preserveCreatedAt(existingEnt, newEnt)
+		return x.replace(existingEnt, newEnt)
+	}
 
-		if updateErr := x.ee.Put(newEnt, true); updateErr != nil {
-			return updateErr
-		}
+	if insertErr := x.ee.Put(newEnt, false); insertErr != nil {
+		return insertErr
+	}
 
-		x.updated = append(x.updated, newEnt)
-		if existingEnt.committed {
-			delCmd := &deleteCmd{key: existingEnt.key, pos: existingEnt.pos}
-			x.persistCommands = append(x.persistCommands, delCmd)
-			x.replaced = append(x.replaced, existingEnt)
-		}
-	} else {
-		if insertErr := x.ee.Put(newEnt, false); insertErr != nil {
-			return insertErr
-		}
+	x.added = append(x.added, newEnt)
+	x.persistCommands = append(x.persistCommands, newEnt)
+
+	return nil
+}
+
+// replace - puts a new version of an existing entry and
+// keeps the existing one in case of rollback
+func (x *Tx) replace(existingEnt, newEnt *entry) error {
+	if err := x.ee.Put(newEnt, true); err != nil {
+		return err
+	}
 
-		x.added = append(x.added, newEnt)
+	x.updated = append(x.updated, newEnt)
+	if existingEnt.committed {
+		delCmd := &deleteCmd{key: existingEnt.key, pos: existingEnt.pos}
+		x.persistCommands = append(x.persistCommands, delCmd)
+		x.replaced = append(x.replaced, existingEnt)
 	}
 
 	x.persistCommands = append(x.persistCommands, newEnt)
@@ -244,6 +373,30 @@ func (x *Tx) InsertOrReplace(key string, data interface{}, metaAppliers ...MetaA
 	return nil
 }
 
+// applyMeta - applies meta appliers to a new entry, time dependent
+// appliers receive current time of the database clock
+func (x *Tx) applyMeta(ent *entry, metaAppliers []MetaApplier) error {
+	return applyMetaAt(ent, metaAppliers, x.ee.Now())
+}
+
+func applyMetaAt(ent *entry, metaAppliers []MetaApplier, now time.Time) error {
+	for _, applier := range metaAppliers {
+		if ta, ok := applier.(timedMetaApplier); ok {
+			if err := ta.applyAt(ent, now); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := applier.applyTo(ent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func preserveCreatedAt(existingEnt, newEnt *entry) {
 	if existingEnt.tags == nil {
 		return
@@ -262,11 +415,22 @@ func (x *Tx) Tag(key string, m M) error {
 		return ErrTxIsReadOnly
 	}
 
-	ent, err := x.ee.FindByKey(key)
+	ent, err := x.find(key)
 	if err != nil {
 		return err
 	}
 
+	nt, err := newTagsFromMap(m)
+	if err != nil {
+		return err
+	}
+
+	if err := x.ee.CheckUnique(ent.key, nt); err != nil {
+		return err
+	}
+
+	x.touch(key, ent)
+
 	// save a copy of the updated entry in case of rollback
 	x.replaced = append(x.replaced, ent.clone())
 
@@ -276,15 +440,124 @@ func (x *Tx) Tag(key string, m M) error {
 		}
 	}
 
-	nt, err := newTagsFromMap(m)
+	// on commit commands should be persisted in order
+	x.persistCommands = append(x.persistCommands, &tagCmd{newPK(key), nt})
+
+	return nil
+}
+
+// Incr increments an integer document by delta and returns the resulting value,
+// if the key does not exist a new integer document is created with delta as its value
+func (x *Tx) Incr(key string, delta int) (int, error) {
+	if x.readOnly {
+		return 0, ErrTxIsReadOnly
+	}
+
+	if x.ee == nil {
+		return 0, ErrTxAlreadyClosed
+	}
+
+	existingEnt, err := x.find(key)
+	if err != nil && !errors.Is(err, ErrKeyDoesNotExist) {
+		return 0, err
+	}
+
+	if existingEnt == nil {
+		if err := x.Insert(key, delta); err != nil {
+			return 0, err
+		}
+
+		return delta, nil
+	}
+
+	if ct, ok := existingEnt.tags[ContentType]; !ok || ct.data != string(Integer) {
+		return 0, errors.Wrapf(ErrInvalidContentType, "key %s does not contain an integer", key)
+	}
+
+	if existingEnt.value == nil {
+		if err := x.ee.LoadEntryValue(existingEnt); err != nil {
+			return 0, err
+		}
+	}
+
+	current, err := strconv.Atoi(string(existingEnt.value))
+	if err != nil {
+		return 0, errors.Wrapf(ErrInvalidContentType, "key %s does not contain a valid integer", key)
+	}
+
+	result := current + delta
+	newEnt := newEntry(key, []byte(strconv.Itoa(result)))
+	newEnt.tags = existingEnt.tags.clone()
+
+	x.touch(key, existingEnt)
+
+	if err := x.ee.Put(newEnt, true); err != nil {
+		return 0, err
+	}
+
+	x.updated = append(x.updated, newEnt)
+	if existingEnt.committed {
+		x.replaced = append(x.replaced, existingEnt)
+	}
+
+	// only the new value is persisted, tags stay untouched
+	x.persistCommands = append(x.persistCommands, &incrCmd{ent: newEnt, prev: existingEnt.pos})
+
+	return result, nil
+}
+
+// IncrTag increments an int or float tag of a document by delta,
+// if the document does not have the tag yet it is created with delta as its value
+func (x *Tx) IncrTag(key, name string, delta interface{}) error {
+	if x.readOnly {
+		return ErrTxIsReadOnly
+	}
+
+	if x.ee == nil {
+		return ErrTxAlreadyClosed
+	}
+
+	ent, err := x.find(key)
 	if err != nil {
 		return err
 	}
 
-	// on commit commands should be persisted in order
-	x.persistCommands = append(x.persistCommands, &tagCmd{newPK(key), nt})
+	var result interface{}
+	existing := ent.tags[name]
 
-	return nil
+	switch typedDelta := delta.(type) {
+	case int:
+		if existing == nil {
+			result = typedDelta
+			break
+		}
+
+		switch v := existing.data.(type) {
+		case int:
+			result = v + typedDelta
+		case float64:
+			result = v + float64(typedDelta)
+		default:
+			return errors.Wrapf(ErrInvalidTagType, "tag %s of key %s is not a number", name, key)
+		}
+	case float64:
+		if existing == nil {
+			result = typedDelta
+			break
+		}
+
+		v, ok := existing.data.(float64)
+		if !ok {
+			return errors.Wrapf(ErrInvalidTagType, "tag %s of key %s is not a float", name, key)
+		}
+
+		result = v + typedDelta
+	default:
+		return errors.Wrapf(ErrInvalidTagType, "delta must be int or float64, %T given", delta)
+	}
+
+	// tag command already contains only the changed tag
+	return x.Tag(key, M{name: result})
 }
 
 func (x *Tx) Untag(key string, tagNames ...string) error {
@@ -292,11 +565,13 @@ func (x *Tx) Untag(key string, tagNames ...string) error {
 		return ErrTxIsReadOnly
 	}
 
-	ent, err := x.ee.FindByKey(key)
+	ent, err := x.find(key)
 	if err != nil {
 		return err
 	}
 
+	x.touch(key, ent)
+
 	// save a copy of the updated entry in case of rollback
 	x.replaced = append(x.replaced, ent.clone())
 	x.updated = append(x.updated, ent)
@@ -315,13 +590,7 @@ func (x *Tx) Untag(key string, tagNames ...string) error {
 
 func (x *Tx) Scan(opts *QueryOptions, cb func(d *Document) bool) error {
 	ir := func(ent *entry) bool {
-		if ent.value == nil {
-			if err := x.ee.LoadEntryValue(ent); err != nil {
-				// fixme: log
-			}
-		}
-		d := newDocumentFromEntry(ent)
-		return cb(d)
+		return cb(x.document(opts, ent))
 	}
 
 	if err := x.applyScanner(x.ctx, opts, ir); err != nil {
@@ -332,6 +601,23 @@ func (x *Tx) Scan(opts *QueryOptions, cb func(d *Document) bool) error {
 }
 
 func (x *Tx) CountByQuery(opts *QueryOptions) (int, error) {
+	if opts == nil {
+		opts = Q()
+	}
+
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+
+	if opts.order == "" {
+		opts.order = AscOrder
+	}
+
+	// most queries are counted from indexes and primary keys without executing them
+	if count, ok, err := x.ee.CountByQuery(opts); err != nil || ok {
+		return count, err
+	}
+
 	var counter int
 
 	ir := func(_ *entry) bool {
@@ -350,12 +636,7 @@ func (x *Tx) CountByQuery(opts *QueryOptions) (int, error) {
 func (x *Tx) Find(q *QueryOptions) ([]*Document, error) {
 	var result []*Document
 	ir := func(ent *entry) bool {
-		if ent.value == nil {
-			if err := x.ee.LoadEntryValue(ent); err != nil {
-				// fixme: log
-			}
-		}
-		result = append(result, newDocumentFromEntry(ent))
+		result = append(result, x.document(q, ent))
 		return true
 	}
 
@@ -366,44 +647,189 @@ func (x *Tx) Find(q *QueryOptions) ([]*Document, error) {
 	return result, nil
 }
 
+// Keys finds keys of documents matched by query options without loading their values
+func (x *Tx) Keys(q *QueryOptions) ([]string, error) {
+	var keys []string
+	ir := func(ent *entry) bool {
+		keys = append(keys, ent.key.String())
+		return true
+	}
+
+	if err := x.applyScanner(x.ctx, q, ir); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ScanMeta iterates keys and tags of documents matched by query options without loading their values
+func (x *Tx) ScanMeta(q *QueryOptions, cb func(key string, tags M) bool) error {
+	ir := func(ent *entry) bool {
+		tags, _ := createMapFromTags(ent.tags)
+		return cb(ent.key.String(), tags)
+	}
+
+	return x.applyScanner(x.ctx, q, ir)
+}
+
+// document - creates a document of a matched entry, the value is loaded
+// unless query options ask for documents without values
+func (x *Tx) document(q *QueryOptions, ent *entry) *Document {
+	if q == nil || !q.withoutValues {
+		withValue, err := x.withValue(ent)
+		if err != nil {
+			x.lg.Error(err)
+		} else {
+			ent = withValue
+		}
+	}
+
+	d := newDocumentFromQuery(q, ent)
+	x.populate(q, d)
+
+	return d
+}
+
+// withValue - the entry itself when it holds its value, otherwise a copy of it with the value
+// read from cache or disk, entries are shared by concurrent read transactions, so they are never written to
+func (x *Tx) withValue(ent *entry) (*entry, error) {
+	if ent.value != nil {
+		return ent, nil
+	}
+
+	v, err := x.ee.ReadEntryValue(ent)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load value of %s", ent.key.String())
+	}
+
+	cp := *ent
+	cp.value = v
+
+	return &cp, nil
+}
+
+// FindPage finds a page of documents limited by query options Limit,
+// the returned cursor can be passed to After in order to get the next page
+func (x *Tx) FindPage(q *QueryOptions) (*Page, error) {
+	if q == nil {
+		q = Q()
+	}
+
+	// one extra document tells whether there is a next page
+	pq := *q
+	if q.limit > 0 {
+		pq.limit = q.limit + 1
+	}
+
+	docs, err := x.Find(&pq)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Documents: docs}
+	if q.limit > 0 && len(docs) > q.limit {
+		page.Documents = docs[:q.limit]
+		page.Next = encodeCursor(docs[q.limit-1].Key())
+	}
+
+	return page, nil
+}
+
+// limitIterator - skips first offset entries and stops iteration after limit entries
+func limitIterator(limit, offset int, it entryIterator) entryIterator {
+	var skipped, taken int
+
+	return func(ent *entry) bool {
+		if skipped < offset {
+			skipped++
+			return true
+		}
+
+		taken++
+		if !it(ent) {
+			return false
+		}
+
+		return limit == 0 || taken < limit
+	}
+}
+
+// whereIterator - skips entries not satisfying JSON path predicates, lazily loaded values
+// are read into a copy of the entry in order to be matched, so they do not stay in memory,
+// a value that cannot be loaded stops the iteration and the error is stored in failed
+func (x *Tx) whereIterator(predicates []wherePredicate, it entryIterator, failed *error) entryIterator {
+	return func(ent *entry) bool {
+		withValue, err := x.withValue(ent)
+		if err != nil {
+			*failed = err
+			return false
+		}
+
+		if !matchWhere(withValue, predicates) {
+			return true
+		}
+
+		return it(ent)
+	}
+}
+
 func (x *Tx) applyScanner(ctx context.Context, qo *QueryOptions, it entryIterator) error {
+	_, err := x.executePlan(ctx, qo, it, false)
+	return err
+}
+
+// executePlan - plans the query and passes matching entries to the iterator,
+// estimate makes the planner estimate rows even when there is nothing to choose from
+func (x *Tx) executePlan(ctx context.Context, qo *QueryOptions, it entryIterator, estimate bool) (*queryPlan, error) {
 	if qo == nil {
 		qo = Q()
 	}
 
 	if err := qo.Validate(); err != nil {
-		return err
+		return nil, err
 	}
 
-	if qo.order == "" {
-		qo.order = AscOrder
+	if qo.limit > 0 || qo.offset > 0 {
+		it = limitIterator(qo.limit, qo.offset, it)
 	}
 
-	fe, err := x.ee.FilterEntriesByTags(qo)
-	if err != nil {
-		return err
+	// values that could not be loaded for predicates fail the query instead of skipping documents
+	var loadErr error
+	if len(qo.where) > 0 {
+		it = x.whereIterator(qo.where, it, &loadErr)
 	}
 
-	// if we have entries chosen by secondary indexes
-	// and filtered by primary key patterns
-	// we can just sort by keys, iterate and return
-	if fe != nil && !fe.empty() {
-		fe.iterate(qo, it)
-		return nil
+	// expired entries are invisible until reaped
+	now := x.ee.Now()
+	visible := it
+	it = func(ent *entry) bool {
+		if ent.expired(now) {
+			return true
+		}
+
+		return visible(ent)
 	}
 
-	// scanner is a function that is chosen dynamically depending
-	// on the query options
-	sc, err := x.ee.ChooseBestScanner(qo)
+	if qo.order == "" {
+		qo.order = AscOrder
+	}
+
+	// plan is chosen dynamically depending on the query options
+	// and cardinalities of tag indexes
+	p, err := x.ee.Plan(qo, estimate)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := sc(ctx, qo, it); err != nil {
-		return err
+	if err := p.execute(ctx, qo, it); err != nil {
+		return nil, err
 	}
 
-	return nil
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	return p, nil
 }
 
 func (x *Tx) Remove(keys ...string) error {
@@ -412,22 +838,57 @@ func (x *Tx) Remove(keys ...string) error {
 	}
 
 	for _, k := range keys {
-		found, err := x.ee.FindByKey(k)
+		found, err := x.find(k)
 		if err != nil {
 			return err
 		}
 
-		if err := x.ee.Remove(found.key); err != nil {
+		if err := x.remove(found); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
 
-		x.replaced = append(x.replaced, found)
-		x.persistCommands = append(x.persistCommands, &deleteCmd{key: found.key, pos: found.pos})
+func (x *Tx) remove(ent *entry) error {
+	x.touch(ent.key.String(), ent)
+
+	if err := x.ee.Remove(ent.key); err != nil {
+		return err
 	}
 
+	x.replaced = append(x.replaced, ent)
+	x.persistCommands = append(x.persistCommands, &deleteCmd{key: ent.key, pos: ent.pos})
+
 	return nil
 }
 
+// find - finds an entry by key, expired entries are treated as non-existent
+func (x *Tx) find(key string) (*entry, error) {
+	ent, err := x.ee.FindByKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if ent.expired(x.ee.Now()) {
+		return nil, errors.Wrapf(ErrKeyDoesNotExist, "key %s has expired", key)
+	}
+
+	return ent, nil
+}
+
+// removeExpired - removes an expired entry that was not reaped yet,
+// so that the key can be written again
+func (x *Tx) removeExpired(key string) error {
+	ent, err := x.ee.FindByKey(key)
+	if err != nil || !ent.expired(x.ee.Now()) {
+		return nil
+	}
+
+	return x.remove(ent)
+}
+
 func (x *Tx) Count() int {
 	return x.ee.Count()
 }
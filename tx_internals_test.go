@@ -0,0 +1,77 @@
+package lemon
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestTx_CommitPersistFailure(t *testing.T) {
+	fixture := "./__fixtures__/tx_persist_failure_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	db, closer, err := Open(fixture, &Config{
+		DisableAutoVacuum:   true,
+		PersistenceStrategy: Sync,
+	})
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("product:1", M{"price": 10}, WithTags().Str("color", "red")))
+
+	// writes into a read only handle of the database file fail
+	p := db.e.(*defaultEngine).persistence
+	readOnly, err := os.Open(fixture)
+	require.NoError(t, err)
+
+	original := p.f
+	p.f = readOnly
+
+	var committed, rolledBack bool
+	err = db.Update(context.Background(), func(tx *Tx) error {
+		tx.OnCommit(func() { committed = true })
+		tx.OnRollback(func() { rolledBack = true })
+
+		if err := tx.InsertOrReplace("product:1", M{"price": 20}, WithTags().Str("color", "blue")); err != nil {
+			return err
+		}
+
+		return tx.Insert("product:2", M{"price": 30})
+	})
+
+	p.f = original
+	require.NoError(t, readOnly.Close())
+
+	assert.True(t, errors.Is(err, ErrDbFileWriteFailed))
+	assert.False(t, committed)
+	assert.True(t, rolledBack)
+
+	assert.False(t, db.Has("product:2"))
+
+	doc, err := db.Get("product:1")
+	require.NoError(t, err)
+	assert.Equal(t, `{"price":10}`, doc.RawString())
+
+	docs, err := db.Find(Q().HasAllTags(QT().StrTagEq("color", "red")))
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "product:1", docs[0].Key())
+
+	docs, err = db.Find(Q().HasAllTags(QT().StrTagEq("color", "blue")))
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+}
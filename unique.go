@@ -0,0 +1,244 @@
+package lemon
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+var ErrUniqueViolation = errors.New("unique constraint violation")
+
+// uniqueTag - a tag name whose values cannot repeat across keys matching the pattern,
+// only its definition is persisted, values are rebuilt from tags when the database is loaded
+type uniqueTag struct {
+	name     string
+	pattern  string
+	patterns []string
+	values   map[interface{}]*entry
+	byKey    map[string]interface{}
+}
+
+func newUniqueTag(name, pattern string) *uniqueTag {
+	ut := &uniqueTag{name: name, pattern: pattern}
+	if pattern != "" {
+		ut.patterns = strings.Split(pattern, ":")
+	}
+
+	ut.reset()
+
+	return ut
+}
+
+func (ut *uniqueTag) reset() {
+	ut.values = make(map[interface{}]*entry)
+	ut.byKey = make(map[string]interface{})
+}
+
+// covers - the constraint applies only to keys matching its pattern
+func (ut *uniqueTag) covers(key PK) bool {
+	return key.Match(ut.patterns)
+}
+
+// add - remembers the current value of the tag of the entry replacing the previous one
+func (ut *uniqueTag) add(ent *entry) {
+	ut.remove(ent)
+
+	t, ok := ent.tags[ut.name]
+	if !ok || !ut.covers(ent.key) {
+		return
+	}
+
+	ut.values[t.data] = ent
+	ut.byKey[ent.key.String()] = t.data
+}
+
+// remove - forgets the value of the entry unless it already belongs to another entry
+func (ut *uniqueTag) remove(ent *entry) {
+	key := ent.key.String()
+	v, ok := ut.byKey[key]
+	if !ok {
+		return
+	}
+
+	delete(ut.byKey, key)
+	if holder, ok := ut.values[v]; ok && holder.key.String() == key {
+		delete(ut.values, v)
+	}
+}
+
+func (ut *uniqueTag) serialize(rs *respSerializer) error {
+	return rs.serializeUniqueTagCommand(ut)
+}
+
+func (ut *uniqueTag) deserialize(e executionEngine) error {
+	return e.DefineUniqueTag(ut)
+}
+
+// CreateUniqueTag - declares a tag name unique across keys matching the pattern, all keys when it is empty,
+// existing documents must not violate the constraint already
+func (ee *defaultEngine) CreateUniqueTag(name, pattern string) error {
+	ee.Lock()
+	defer ee.Unlock()
+
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if name == "" {
+		return errors.Wrap(ErrInvalidTagType, "unique tag name cannot be empty")
+	}
+
+	if _, ok := ee.uniqueTags[name]; ok {
+		return errors.Wrapf(ErrIndexAlreadyExists, "unique tag %s", name)
+	}
+
+	ut := newUniqueTag(name, pattern)
+
+	var err error
+	now := ee.Now()
+	ee.pks.Ascend(nil, func(item interface{}) bool {
+		ent := item.(*entry)
+		if ent.expired(now) {
+			return true
+		}
+
+		if t, ok := ent.tags[name]; ok && ut.covers(ent.key) {
+			if holder, ok := ut.values[t.data]; ok {
+				err = errors.Wrapf(
+					ErrUniqueViolation,
+					"tag %s with value %v is used by keys %s and %s",
+					name, t.data, holder.key.String(), ent.key.String(),
+				)
+				return false
+			}
+		}
+
+		ut.add(ent)
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := ee.Persist([]serializable{ut}); err != nil {
+		return err
+	}
+
+	ee.uniqueTags[name] = ut
+
+	return nil
+}
+
+// DefineUniqueTag - registers a unique tag, its values are collected after the whole log is loaded
+func (ee *defaultEngine) DefineUniqueTag(ut *uniqueTag) error {
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	ee.uniqueTags[ut.name] = ut
+	return nil
+}
+
+func (ee *defaultEngine) rebuildUniqueTags() {
+	for _, ut := range ee.uniqueTags {
+		ut.reset()
+	}
+
+	if len(ee.uniqueTags) == 0 {
+		return
+	}
+
+	ee.pks.Ascend(nil, func(item interface{}) bool {
+		ee.indexUnique(item.(*entry))
+		return true
+	})
+}
+
+// CheckUnique - checks that none of the tags is used by another live document under a unique constraint,
+// it must be called before any changes are made, so that a failed operation leaves nothing to undo
+func (ee *defaultEngine) CheckUnique(key PK, tags tags) error {
+	if ee.closed {
+		return ErrDatabaseAlreadyClosed
+	}
+
+	if len(ee.uniqueTags) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		if _, ok := ee.uniqueTags[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	now := ee.Now()
+	for _, name := range names {
+		ut := ee.uniqueTags[name]
+		if !ut.covers(key) {
+			continue
+		}
+
+		holder, ok := ut.values[tags[name].data]
+		if !ok || holder.key.String() == key.String() || holder.expired(now) {
+			continue
+		}
+
+		return errors.Wrapf(
+			ErrUniqueViolation,
+			"tag %s with value %v is already used by key %s",
+			name, tags[name].data, holder.key.String(),
+		)
+	}
+
+	return nil
+}
+
+// FindByUniqueTag - finds an entry holding the value of a unique tag
+func (ee *defaultEngine) FindByUniqueTag(name string, value interface{}) (*entry, error) {
+	if ee.closed {
+		return nil, ErrDatabaseAlreadyClosed
+	}
+
+	ut, ok := ee.uniqueTags[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrTagKeyNotFound, "%s is not a unique tag", name)
+	}
+
+	// values are kept under the same types tags are created with
+	switch value.(type) {
+	case int, float64, string, bool:
+	default:
+		return nil, errors.Wrapf(ErrInvalidTagType, "%T", value)
+	}
+
+	ent, ok := ut.values[value]
+	if !ok {
+		return nil, errors.Wrapf(ErrKeyDoesNotExist, "no key with tag %s equal to %v", name, value)
+	}
+
+	return ent, nil
+}
+
+// indexUnique - remembers values of unique tags of the entry,
+// unique tags are rebuilt after the log is replayed, so nothing is done while loading
+func (ee *defaultEngine) indexUnique(ent *entry) {
+	if ee.replaying {
+		return
+	}
+
+	for _, ut := range ee.uniqueTags {
+		ut.add(ent)
+	}
+}
+
+func (ee *defaultEngine) unindexUnique(ent *entry) {
+	for _, ut := range ee.uniqueTags {
+		if v, ok := ut.byKey[ent.key.String()]; ok && ut.values[v] == ent {
+			ut.remove(ent)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package lemon_test
+
+import (
+	"context"
+	"errors"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDB_UniqueTags(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.Insert("user:1", lemon.M{"name": "Alice"}, lemon.WithTags().Str("email", "alice@example.com")))
+	require.NoError(t, db.CreateUniqueTag("email", "user:*"))
+
+	t.Run("insert", func(t *testing.T) {
+		err := db.Insert("user:2", lemon.M{"name": "Fake"}, lemon.WithTags().Str("email", "alice@example.com"))
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+		assert.Contains(t, err.Error(), "user:1")
+		assert.False(t, db.Has("user:2"))
+
+		require.NoError(t, db.Insert("user:2", lemon.M{"name": "Bob"}, lemon.WithTags().Str("email", "bob@example.com")))
+	})
+
+	t.Run("keys outside of the pattern are not constrained", func(t *testing.T) {
+		require.NoError(t, db.Insert("admin:1", lemon.M{"name": "Alice"}, lemon.WithTags().Str("email", "alice@example.com")))
+	})
+
+	t.Run("insert or replace", func(t *testing.T) {
+		require.NoError(t, db.InsertOrReplace("user:2", lemon.M{"name": "Bobby"}, lemon.WithTags().Str("email", "bob@example.com")))
+
+		err := db.InsertOrReplace("user:3", lemon.M{"name": "Fake"}, lemon.WithTags().Str("email", "bob@example.com"))
+		assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+		assert.False(t, db.Has("user:3"))
+	})
+
+	t.Run("tag rolls back the transaction", func(t *testing.T) {
+		err := db.Update(context.Background(), func(tx *lemon.Tx) error {
+			if err := tx.Insert("user:3", lemon.M{"name": "Carol"}, lemon.WithTags().Str("email", "carol@example.com")); err != nil {
+				return err
+			}
+
+			if err := tx.Tag("user:1", lemon.M{"email": "new@example.com"}); err != nil {
+				return err
+			}
+
+			return tx.Tag("user:2", lemon.M{"email": "carol@example.com"})
+		})
+
+		assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+		assert.Contains(t, err.Error(), "user:3")
+		assert.False(t, db.Has("user:3"))
+
+		d, err := db.GetByUniqueTag("email", "alice@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "user:1", d.Key())
+
+		_, err = db.GetByUniqueTag("email", "new@example.com")
+		assert.True(t, errors.Is(err, lemon.ErrKeyDoesNotExist))
+
+		d, err = db.GetByUniqueTag("email", "bob@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "user:2", d.Key())
+	})
+
+	t.Run("values are released by untag and removal", func(t *testing.T) {
+		require.NoError(t, db.Untag("user:1", "email"))
+		require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+			return tx.Remove("user:2")
+		}))
+
+		require.NoError(t, db.Insert("user:4", lemon.M{"name": "Alice"}, lemon.WithTags().Str("email", "alice@example.com")))
+		require.NoError(t, db.Tag("user:4", lemon.M{"email": "bob@example.com"}))
+
+		d, err := db.GetByUniqueTag("email", "bob@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "user:4", d.Key())
+
+		_, err = db.GetByUniqueTag("email", "alice@example.com")
+		assert.True(t, errors.Is(err, lemon.ErrKeyDoesNotExist))
+	})
+
+	t.Run("bulk load", func(t *testing.T) {
+		_, err := db.BulkLoad(context.Background(), lemon.NewSliceBulkIterator([]lemon.BulkItem{
+			{Key: "user:5", Data: lemon.M{"name": "Eve"}, Meta: []lemon.MetaApplier{lemon.WithTags().Str("email", "eve@example.com")}},
+			{Key: "user:6", Data: lemon.M{"name": "Fake"}, Meta: []lemon.MetaApplier{lemon.WithTags().Str("email", "eve@example.com")}},
+		}))
+
+		assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+		assert.Contains(t, err.Error(), "user:5")
+		assert.False(t, db.Has("user:5"))
+		assert.False(t, db.Has("user:6"))
+	})
+
+	t.Run("definition", func(t *testing.T) {
+		err := db.CreateUniqueTag("email", "")
+		assert.True(t, errors.Is(err, lemon.ErrIndexAlreadyExists))
+
+		_, err = db.GetByUniqueTag("name", "Alice")
+		assert.True(t, errors.Is(err, lemon.ErrTagKeyNotFound))
+
+		require.NoError(t, db.Insert("product:1", lemon.M{}, lemon.WithTags().Str("sku", "A-1")))
+		require.NoError(t, db.Insert("product:2", lemon.M{}, lemon.WithTags().Str("sku", "A-1")))
+
+		err = db.CreateUniqueTag("sku", "")
+		assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+
+		require.NoError(t, db.Tag("product:2", lemon.M{"sku": "A-2"}))
+		require.NoError(t, db.CreateUniqueTag("sku", ""))
+
+		err = db.Insert("other:1", lemon.M{}, lemon.WithTags().Str("sku", "A-2"))
+		assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+
+		_, err = db.GetByUniqueTag("sku", []string{"A-2"})
+		assert.True(t, errors.Is(err, lemon.ErrInvalidTagType))
+
+		_, err = db.GetByUniqueTag("sku", int64(2))
+		assert.True(t, errors.Is(err, lemon.ErrInvalidTagType))
+	})
+}
+
+func TestDB_UniqueFieldIndexes(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	require.NoError(t, db.CreateIndex("email", lemon.JSONPath("email"), lemon.StrIndex))
+	require.NoError(t, db.CreateUniqueTag("email", ""))
+	require.NoError(t, db.Insert("user:1", lemon.M{"email": "a@x"}))
+	require.NoError(t, db.Insert("user:2", lemon.M{"email": "b@x"}))
+
+	err = db.Insert("user:3", lemon.M{"email": "a@x"})
+	assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+
+	err = db.Update(context.Background(), func(tx *lemon.Tx) error {
+		return tx.SetPath("user:2", "email", "a@x")
+	})
+	assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+
+	err = db.Update(context.Background(), func(tx *lemon.Tx) error {
+		return tx.Patch("user:2", lemon.M{"email": "a@x"})
+	})
+	assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+
+	d, err := db.Get("user:2")
+	require.NoError(t, err)
+	email, err := d.JSON().String("email")
+	require.NoError(t, err)
+	assert.Equal(t, "b@x", email)
+
+	d, err = db.GetByUniqueTag("email", "a@x")
+	require.NoError(t, err)
+	assert.Equal(t, "user:1", d.Key())
+
+	require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+		return tx.SetPath("user:2", "email", "c@x")
+	}))
+
+	d, err = db.GetByUniqueTag("email", "c@x")
+	require.NoError(t, err)
+	assert.Equal(t, "user:2", d.Key())
+}
+
+func TestDB_UniqueTagsPersistence(t *testing.T) {
+	fixture := "./__fixtures__/unique_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	open := func() (*lemon.DB, lemon.Closer) {
+		db, closer, err := lemon.Open(fixture, &lemon.Config{
+			DisableAutoVacuum:   true,
+			PersistenceStrategy: lemon.Sync,
+		})
+
+		require.NoError(t, err)
+		return db, closer
+	}
+
+	db, closer := open()
+	require.NoError(t, db.CreateUniqueTag("email", "user:*"))
+	require.NoError(t, db.Insert("user:1", lemon.M{"name": "Alice"}, lemon.WithTags().Str("email", "alice@example.com")))
+	require.NoError(t, db.Insert("user:2", lemon.M{"name": "Bob"}, lemon.WithTags().Str("email", "bob@example.com")))
+	require.NoError(t, db.Tag("user:2", lemon.M{"email": "robert@example.com"}))
+	require.NoError(t, closer())
+
+	check := func(db *lemon.DB) {
+		d, err := db.GetByUniqueTag("email", "robert@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "user:2", d.Key())
+
+		err = db.Insert("user:3", lemon.M{"name": "Fake"}, lemon.WithTags().Str("email", "alice@example.com"))
+		assert.True(t, errors.Is(err, lemon.ErrUniqueViolation))
+
+		require.NoError(t, db.Insert("admin:1", lemon.M{"name": "Alice"}, lemon.WithTags().Str("email", "alice@example.com")))
+	}
+
+	db, closer = open()
+	check(db)
+	require.NoError(t, db.Vacuum(context.Background()))
+	require.NoError(t, db.Update(context.Background(), func(tx *lemon.Tx) error {
+		return tx.Remove("admin:1")
+	}))
+	require.NoError(t, closer())
+
+	db, closer = open()
+	defer func() {
+		require.NoError(t, closer())
+	}()
+
+	check(db)
+}
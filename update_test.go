@@ -665,7 +665,9 @@ func Test_MassiveBufferedWrites(t *testing.T) {
 		}
 	}
 
-	assert.Equal(t, expectEvictedAfterReplaceAndGet, evictedKeys)
+	// loaded values are not kept in entries, so reading in reverse order goes through the cache again
+	const expectEvictedAfterReplaceAndGetInReverseOrder = 47463 + expectEvictedAfterReplaceAndGet
+	assert.Equal(t, expectEvictedAfterReplaceAndGetInReverseOrder, evictedKeys)
 
 	const additionalChecks = 100
 	// additional checks with adding extra keys
@@ -686,7 +688,7 @@ func Test_MassiveBufferedWrites(t *testing.T) {
 
 	// expect all additional keys to cause evictions
 	//assert.Equal(t, expectEvictedAfterReplaceAndGet + additionalChecks, evictedKeys)
-	assert.Equal(t, 145962, evictedKeys)
+	assert.Equal(t, 193426, evictedKeys)
 
 	for i := insertKeys; i < insertKeys+additionalChecks; i++ {
 		key := fmt.Sprintf("item:%d", i)
@@ -700,7 +702,7 @@ func Test_MassiveBufferedWrites(t *testing.T) {
 	}
 
 	//assert.Equal(t, expectEvictedAfterReplaceAndGet + additionalChecks, evictedKeys)
-	assert.Equal(t, 145962, evictedKeys)
+	assert.Equal(t, 193426, evictedKeys)
 
 	require.NoError(t, db.FlushAll())
 
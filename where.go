@@ -0,0 +1,284 @@
+package lemon
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"reflect"
+	"strings"
+)
+
+// Operator - compares a value found by JSON path inside a document
+type Operator uint8
+
+const (
+	// Eq - value at path is equal to the given one
+	Eq Operator = iota + 1
+	// Ne - value at path is missing or not equal to the given one
+	Ne
+	// Gt - value at path is greater than the given number or string
+	Gt
+	// Gte - value at path is greater than or equal to the given number or string
+	Gte
+	// Lt - value at path is less than the given number or string
+	Lt
+	// Lte - value at path is less than or equal to the given number or string
+	Lte
+	// Exists - path exists in the document, no values expected
+	Exists
+	// In - value at path is equal to one of the given values
+	In
+	// Contains - string at path contains the given substring
+	// or array at path contains the given element
+	Contains
+)
+
+func (op Operator) String() string {
+	switch op {
+	case Eq:
+		return "eq"
+	case Ne:
+		return "ne"
+	case Gt:
+		return "gt"
+	case Gte:
+		return "gte"
+	case Lt:
+		return "lt"
+	case Lte:
+		return "lte"
+	case Exists:
+		return "exists"
+	case In:
+		return "in"
+	case Contains:
+		return "contains"
+	}
+
+	return "unknown"
+}
+
+type wherePredicate struct {
+	path   string
+	op     Operator
+	values []interface{}
+}
+
+// Where - documents must be JSON and the value at path must satisfy the operator,
+// numbers, strings, booleans and nil can be compared, In accepts several values or a slice
+func (qo *QueryOptions) Where(path string, op Operator, values ...interface{}) *QueryOptions {
+	if op == In && len(values) == 1 {
+		values = expandSlice(values[0])
+	}
+
+	p := wherePredicate{path: path, op: op, values: make([]interface{}, 0, len(values))}
+	for _, v := range values {
+		p.values = append(p.values, normalizeWhereValue(v))
+	}
+
+	qo.where = append(qo.where, p)
+	return qo
+}
+
+func (p wherePredicate) validate() error {
+	if p.path == "" {
+		return errors.Wrap(ErrInvalidQueryOptions, "where path cannot be empty")
+	}
+
+	for _, v := range p.values {
+		switch v.(type) {
+		case nil, bool, float64, string:
+		default:
+			return errors.Wrapf(ErrInvalidQueryOptions, "unsupported where value %v of type %T at %s", v, v, p.path)
+		}
+	}
+
+	switch p.op {
+	case Exists:
+		if len(p.values) != 0 {
+			return errors.Wrapf(ErrInvalidQueryOptions, "%s does not accept values at %s", p.op, p.path)
+		}
+	case In:
+		if len(p.values) == 0 {
+			return errors.Wrapf(ErrInvalidQueryOptions, "%s requires at least one value at %s", p.op, p.path)
+		}
+	case Eq, Ne, Contains:
+		if len(p.values) != 1 {
+			return errors.Wrapf(ErrInvalidQueryOptions, "%s requires exactly one value at %s", p.op, p.path)
+		}
+	case Gt, Gte, Lt, Lte:
+		if len(p.values) != 1 {
+			return errors.Wrapf(ErrInvalidQueryOptions, "%s requires exactly one value at %s", p.op, p.path)
+		}
+
+		switch p.values[0].(type) {
+		case float64, string:
+		default:
+			return errors.Wrapf(ErrInvalidQueryOptions, "%s requires a number or a string at %s", p.op, p.path)
+		}
+	default:
+		return errors.Wrapf(ErrInvalidQueryOptions, "unknown operator %d at %s", p.op, p.path)
+	}
+
+	return nil
+}
+
+func (p wherePredicate) match(v []byte) bool {
+	res := gjson.GetBytes(v, p.path)
+
+	switch p.op {
+	case Exists:
+		return res.Exists()
+	case Eq:
+		return jsonEqual(res, p.values[0])
+	case Ne:
+		return !jsonEqual(res, p.values[0])
+	case In:
+		for _, value := range p.values {
+			if jsonEqual(res, value) {
+				return true
+			}
+		}
+
+		return false
+	case Contains:
+		return jsonContains(res, p.values[0])
+	case Gt:
+		c, ok := jsonCompare(res, p.values[0])
+		return ok && c > 0
+	case Gte:
+		c, ok := jsonCompare(res, p.values[0])
+		return ok && c >= 0
+	case Lt:
+		c, ok := jsonCompare(res, p.values[0])
+		return ok && c < 0
+	case Lte:
+		c, ok := jsonCompare(res, p.values[0])
+		return ok && c <= 0
+	}
+
+	return false
+}
+
+// matchWhere - entry value must be a JSON document satisfying all the predicates
+func matchWhere(ent *entry, predicates []wherePredicate) bool {
+	if !isJSONEntry(ent) {
+		return false
+	}
+
+	for _, p := range predicates {
+		if !p.match(ent.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func jsonEqual(res gjson.Result, value interface{}) bool {
+	if !res.Exists() {
+		return false
+	}
+
+	switch typedValue := value.(type) {
+	case nil:
+		return res.Type == gjson.Null
+	case bool:
+		return (typedValue && res.Type == gjson.True) || (!typedValue && res.Type == gjson.False)
+	case float64:
+		return res.Type == gjson.Number && res.Num == typedValue
+	case string:
+		return res.Type == gjson.String && res.Str == typedValue
+	}
+
+	return false
+}
+
+// jsonCompare - compares numbers with numbers and strings with strings,
+// false is returned when types do not match
+func jsonCompare(res gjson.Result, value interface{}) (int, bool) {
+	switch typedValue := value.(type) {
+	case float64:
+		if res.Type != gjson.Number {
+			return 0, false
+		}
+
+		switch {
+		case res.Num < typedValue:
+			return -1, true
+		case res.Num > typedValue:
+			return 1, true
+		}
+
+		return 0, true
+	case string:
+		if res.Type != gjson.String {
+			return 0, false
+		}
+
+		return strings.Compare(res.Str, typedValue), true
+	}
+
+	return 0, false
+}
+
+func jsonContains(res gjson.Result, value interface{}) bool {
+	if res.IsArray() {
+		found := false
+		res.ForEach(func(_, el gjson.Result) bool {
+			found = jsonEqual(el, value)
+			return !found
+		})
+
+		return found
+	}
+
+	if s, ok := value.(string); ok && res.Type == gjson.String {
+		return strings.Contains(res.Str, s)
+	}
+
+	return false
+}
+
+// normalizeWhereValue - all numbers are compared as float64 the same way gjson stores them
+func normalizeWhereValue(v interface{}) interface{} {
+	switch typedValue := v.(type) {
+	case int:
+		return float64(typedValue)
+	case int8:
+		return float64(typedValue)
+	case int16:
+		return float64(typedValue)
+	case int32:
+		return float64(typedValue)
+	case int64:
+		return float64(typedValue)
+	case uint:
+		return float64(typedValue)
+	case uint8:
+		return float64(typedValue)
+	case uint16:
+		return float64(typedValue)
+	case uint32:
+		return float64(typedValue)
+	case uint64:
+		return float64(typedValue)
+	case float32:
+		return float64(typedValue)
+	}
+
+	return v
+}
+
+func expandSlice(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return []interface{}{v}
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values[i] = rv.Index(i).Interface()
+	}
+
+	return values
+}
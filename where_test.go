@@ -0,0 +1,240 @@
+package lemon_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/denismitr/lemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestQueryOptions_Where(t *testing.T) {
+	db, closer, err := lemon.Open(lemon.InMemory)
+	require.NoError(t, err)
+
+	defer func() {
+		if err := closer(); err != nil {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	users := []struct {
+		key  string
+		data lemon.M
+		vip  bool
+	}{
+		{key: "user:1", vip: true, data: lemon.M{
+			"name": "Alice", "age": 30, "active": true, "roles": []string{"admin", "dev"},
+			"address": lemon.M{"city": "Budapest", "zip": "1011"},
+		}},
+		{key: "user:2", data: lemon.M{
+			"name": "Bob", "age": 41, "active": false, "roles": []string{"dev"},
+			"address": lemon.M{"city": "Vienna"},
+		}},
+		{key: "user:3", vip: true, data: lemon.M{
+			"name": "Carol", "age": 25, "active": true, "roles": []string{},
+			"address": lemon.M{"city": "Budapest"},
+		}},
+		{key: "user:4", data: lemon.M{
+			"name": "Dave", "age": 52.5, "manager": nil,
+			"address": lemon.M{"city": "Prague"},
+		}},
+		{key: "user:5", vip: true, data: lemon.M{
+			"name": "Eve", "age": "unknown",
+			"address": lemon.M{"city": "Budapest"},
+		}},
+	}
+
+	for _, u := range users {
+		require.NoError(t, db.Insert(u.key, u.data, lemon.WithTags().Bool("vip", u.vip)))
+	}
+
+	require.NoError(t, db.Insert("user:6", "Budapest"))
+	require.NoError(t, db.Insert("city:1", lemon.M{"address": lemon.M{"city": "Budapest"}}))
+
+	tt := []struct {
+		name string
+		q    *lemon.QueryOptions
+		keys []string
+	}{
+		{
+			name: "equal nested string",
+			q:    lemon.Q().Where("address.city", lemon.Eq, "Budapest"),
+			keys: []string{"city:1", "user:1", "user:3", "user:5"},
+		},
+		{
+			name: "not equal includes missing path",
+			q:    lemon.Q().Match("user:*").Where("active", lemon.Ne, true),
+			keys: []string{"user:2", "user:4", "user:5"},
+		},
+		{
+			name: "greater than number",
+			q:    lemon.Q().Where("age", lemon.Gt, 30),
+			keys: []string{"user:2", "user:4"},
+		},
+		{
+			name: "between with two predicates",
+			q:    lemon.Q().Where("age", lemon.Gte, 25).Where("age", lemon.Lte, 41),
+			keys: []string{"user:1", "user:2", "user:3"},
+		},
+		{
+			name: "less than string",
+			q:    lemon.Q().Where("name", lemon.Lt, "Carol"),
+			keys: []string{"user:1", "user:2"},
+		},
+		{
+			name: "exists",
+			q:    lemon.Q().Where("address.zip", lemon.Exists),
+			keys: []string{"user:1"},
+		},
+		{
+			name: "null value exists and equals nil",
+			q:    lemon.Q().Where("manager", lemon.Exists).Where("manager", lemon.Eq, nil),
+			keys: []string{"user:4"},
+		},
+		{
+			name: "in with values",
+			q:    lemon.Q().Where("address.city", lemon.In, "Vienna", "Prague", "Berlin"),
+			keys: []string{"user:2", "user:4"},
+		},
+		{
+			name: "in with a slice",
+			q:    lemon.Q().Where("age", lemon.In, []int{25, 41}),
+			keys: []string{"user:2", "user:3"},
+		},
+		{
+			name: "contains array element",
+			q:    lemon.Q().Where("roles", lemon.Contains, "dev"),
+			keys: []string{"user:1", "user:2"},
+		},
+		{
+			name: "contains substring",
+			q:    lemon.Q().Where("name", lemon.Contains, "o"),
+			keys: []string{"user:2", "user:3"},
+		},
+		{
+			name: "bool equal",
+			q:    lemon.Q().Where("active", lemon.Eq, false),
+			keys: []string{"user:2"},
+		},
+		{
+			name: "combined with prefix and descending order",
+			q:    lemon.Q().KeyOrder(lemon.DescOrder).Prefix("user").Where("address.city", lemon.Eq, "Budapest"),
+			keys: []string{"user:5", "user:3", "user:1"},
+		},
+		{
+			name: "combined with key range",
+			q:    lemon.Q().KeyRange("user:2", "user:4").Where("address.city", lemon.Ne, "Vienna"),
+			keys: []string{"user:3", "user:4"},
+		},
+		{
+			name: "combined with tags",
+			q: lemon.Q().
+				HasAllTags(lemon.QT().BoolTagEq("vip", true)).
+				Where("address.city", lemon.Eq, "Budapest").
+				Where("age", lemon.Lt, 30),
+			keys: []string{"user:3"},
+		},
+		{
+			name: "combined with tags and key range",
+			q: lemon.Q().
+				HasAllTags(lemon.QT().BoolTagEq("vip", true)).
+				KeyRange("user:2", "user:5").
+				Where("address.city", lemon.Eq, "Budapest"),
+			keys: []string{"user:3", "user:5"},
+		},
+		{
+			name: "limit counts only matching documents",
+			q:    lemon.Q().Where("address.city", lemon.Eq, "Budapest").Offset(1).Limit(2),
+			keys: []string{"user:1", "user:3"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.Find(tc.q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.keys, keysOf(docs))
+		})
+	}
+
+	t.Run("count by query", func(t *testing.T) {
+		count, err := db.CountByQuery(lemon.Q().Where("roles", lemon.Exists))
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("invalid predicates", func(t *testing.T) {
+		for _, q := range []*lemon.QueryOptions{
+			lemon.Q().Where("age", lemon.Gt, true),
+			lemon.Q().Where("age", lemon.Eq),
+			lemon.Q().Where("age", lemon.Exists, 1),
+			lemon.Q().Where("age", lemon.In),
+			lemon.Q().Where("", lemon.Eq, 1),
+			lemon.Q().Where("age", lemon.Eq, struct{}{}),
+		} {
+			_, err := db.Find(q)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, lemon.ErrInvalidQueryOptions))
+		}
+	})
+}
+
+func TestQueryOptions_WhereLazyLoad(t *testing.T) {
+	fixture := "./__fixtures__/where_lazy_db1.ldb"
+	_ = os.Remove(fixture)
+
+	defer func() {
+		if err := os.Remove(fixture); err != nil && !os.IsNotExist(err) {
+			t.Errorf("ERROR: %v", err)
+		}
+	}()
+
+	open := func() (*lemon.DB, lemon.Closer) {
+		db, closer, err := lemon.Open(fixture, &lemon.Config{
+			DisableAutoVacuum:   true,
+			PersistenceStrategy: lemon.Sync,
+			ValueLoadStrategy:   lemon.LazyLoad,
+		})
+
+		require.NoError(t, err)
+		return db, closer
+	}
+
+	db, closer := open()
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, db.Insert(fmt.Sprintf("user:%d", i), lemon.M{"age": i * 10}))
+	}
+	require.NoError(t, closer())
+
+	db, closer = open()
+	defer func() {
+		require.NoError(t, closer())
+	}()
+
+	q := lemon.Q().Where("age", lemon.Gte, 30)
+
+	docs, err := db.Find(q)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "user:3", docs[0].Key())
+	assert.Equal(t, "user:4", docs[1].Key())
+
+	age, err := docs[1].JSON().Int("age")
+	require.NoError(t, err)
+	assert.Equal(t, 40, age)
+
+	t.Run("values that cannot be loaded fail the query", func(t *testing.T) {
+		require.NoError(t, os.Truncate(fixture, 0))
+
+		docs, err := db.Find(q)
+		assert.True(t, errors.Is(err, lemon.ErrStorageFailed))
+		assert.Nil(t, docs)
+
+		n, err := db.CountByQuery(q)
+		assert.True(t, errors.Is(err, lemon.ErrStorageFailed))
+		assert.Equal(t, 0, n)
+	})
+}